@@ -5,6 +5,7 @@ package commands
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/juju/cmd"
 	"github.com/juju/errors"
@@ -21,9 +22,9 @@ upgrade-agents commands.
 
 It removes any imported model on the target controller as long as the
 model hasn't yet been activated. It also rolls back the agent upgrade
-on machines in the environment: removing Juju 2 tools, setting
-symlinks back to the previous tools and reverting changes to agent
-configurations.
+on the machines upgrade-agents has upgraded: removing Juju 2 tools,
+setting symlinks back to the previous tools and reverting changes to
+agent configurations.
 
 `
 
@@ -147,11 +148,47 @@ func (c *abortImplCommand) rollbackAgents(ctx *cmd.Context) error {
 	if err != nil {
 		return errors.Annotate(err, "unable to get addresses for machines")
 	}
-	targets := flatMachineExecTargets(machines...)
-	results, err := parallelExec(targets, "python3 ~/1.25-agent-upgrade/agent-upgrade.py rollback")
+	// Only the machines that upgrade-agents ran the upgrade script on
+	// have anything to roll back. Without a record of them (if the
+	// agents were upgraded by an older plugin) all are rolled back.
+	upgraded, err := loadUpgradedMachines()
+	recorded := err == nil
+	if recorded {
+		var rollback []FlatMachine
+		for _, machine := range machines {
+			if upgraded.Contains(machine.ID) {
+				rollback = append(rollback, machine)
+			}
+		}
+		machines = rollback
+	} else if !os.IsNotExist(errors.Cause(err)) {
+		return errors.Annotate(err, "loading upgraded machines")
+	}
+	if len(machines) == 0 {
+		fmt.Fprintln(ctx.Stdout, "no machines to roll back")
+		return nil
+	}
+
+	upgraders, err := machineAgentUpgraders(machines)
 	if err != nil {
 		return errors.Trace(err)
 	}
+	results, err := agentUpgradeExec("rollback", machines, upgraders, agentUpgrader.rollbackScript)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if recorded {
+		// Forget the machines that were rolled back, so running
+		// abort again only retries the failures.
+		for i, result := range results {
+			if result.Code == 0 {
+				upgraded.Remove(machines[i].ID)
+			}
+		}
+		if err := saveUpgradedMachines(upgraded); err != nil {
+			return errors.Annotate(err, "recording rolled back machines")
+		}
+	}
 	if err := reportResults(ctx, "rollback", machines, results); err != nil {
 		return errors.Trace(err)
 	}
@@ -172,11 +209,11 @@ func (c *abortImplCommand) downgradeTags(ctx *cmd.Context) error {
 }
 
 func getModelUUIDEitherVersion() (string, error) {
-	tag, err := getCurrentMachineTag(dataDir)
+	configPath, done, err := apiServerAgentConfigPath()
 	if err != nil {
 		return "", errors.Trace(err)
 	}
-	configPath := agent2.ConfigPath(dataDir, tag)
+	defer done()
 	// Try both formats of config - this command might be run before
 	// or after upgrading the agent config.
 	uuid, err := getModelUUIDVersion2(configPath)
@@ -20,6 +20,9 @@ The activate command enables the newly-imported model in the target
 controller. It should only be run after upgrading the agents (which
 includes a check that each agent can connect to the new model's API).
 
+Before activating the model, the target controller checks that it is
+consistent and that all of its charms and tools have been uploaded.
+
 `
 
 func newActivateCommand() cmd.Command {
@@ -100,6 +103,19 @@ func (c *activateImplCommand) Run(ctx *cmd.Context) error {
 		return errors.Annotate(err, "getting model UUID")
 	}
 
+	// Make sure the target controller has everything the model
+	// needs before making it live.
+	problems, err := targetAPI.ValidateImport(modelUUID)
+	if err != nil {
+		return errors.Annotate(err, "validating imported model")
+	}
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			logger.Errorf("%v", problem)
+		}
+		return errors.Errorf("imported model failed validation")
+	}
+
 	err = targetAPI.Activate(modelUUID)
 	if err != nil {
 		return errors.Annotate(err, "activating new model")
@@ -115,13 +131,14 @@ func (c *activateImplCommand) Run(ctx *cmd.Context) error {
 }
 
 func getModelUUID() (string, error) {
-	tag, err := getCurrentMachineTag(dataDir)
+	configPath, done, err := apiServerAgentConfigPath()
 	if err != nil {
 		return "", errors.Trace(err)
 	}
+	defer done()
 	// Use the juju2 agent code to read the config, since this should
 	// be run after upgrading the agents.
-	config, err := agent.ReadConfig(agent.ConfigPath(dataDir, tag))
+	config, err := agent.ReadConfig(configPath)
 	if err != nil {
 		return "", errors.Trace(err)
 	}
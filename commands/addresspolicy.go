@@ -0,0 +1,438 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/utils"
+	"github.com/juju/utils/set"
+
+	"github.com/juju/1.25-upgrade/juju1/network"
+	"github.com/juju/1.25-upgrade/juju1/state"
+)
+
+// addressPolicy chooses the address used to reach each machine. By
+// default that's the machine's preferred private address, falling back
+// to its public one. The policy can limit the candidates to the
+// addresses in some spaces, CIDRs or scopes, and can pick the first
+// candidate that accepts SSH connections from the API server machine.
+type addressPolicy struct {
+	spaces []string
+	cidrs  []string
+	scopes []string
+	probe  bool
+
+	// spaceNets holds the subnets of the spaces, loaded from state
+	// by loadSpaces.
+	spaceNets []spaceNet
+
+	mu sync.Mutex
+	// reachable records the addresses that have been probed, and
+	// whether they accepted SSH connections.
+	reachable map[string]bool
+}
+
+// spaceNet is a subnet in one of the address policy's spaces.
+type spaceNet struct {
+	space string
+	net   *net.IPNet
+}
+
+// addressSelection is set by the address flags of the client and
+// remote commands.
+var addressSelection = &addressPolicy{}
+
+// probeTimeout is how long to wait for an address to accept an SSH
+// connection when probing.
+const probeTimeout = 3 * time.Second
+
+// setAddressFlags adds the flags for the address policy. The client
+// passes them on to the remote command with addressFlagArgs.
+func setAddressFlags(f *gnuflag.FlagSet) {
+	p := addressSelection
+	f.Var(listValue{&p.spaces, nil}, "address-space", "Reach machines by their addresses in these comma-separated spaces")
+	f.Var(listValue{&p.cidrs, validateCIDR}, "address-cidr", "Reach machines by their addresses in these comma-separated CIDRs")
+	f.Var(listValue{&p.scopes, validateScope}, "address-scope", "Reach machines by their addresses with these comma-separated scopes (public, local-cloud)")
+	f.BoolVar(&p.probe, "probe-addresses", false, "Reach machines by the first of their addresses that accepts SSH connections")
+}
+
+// addressFlagArgs returns the flags for passing the address policy on
+// to the remote command.
+func addressFlagArgs() []string {
+	p := addressSelection
+	var args []string
+	for _, flag := range []struct {
+		name   string
+		values []string
+	}{
+		{"--address-space", p.spaces},
+		{"--address-cidr", p.cidrs},
+		{"--address-scope", p.scopes},
+	} {
+		if len(flag.values) > 0 {
+			args = append(args, flag.name, utils.ShQuote(strings.Join(flag.values, ",")))
+		}
+	}
+	if p.probe {
+		args = append(args, "--probe-addresses")
+	}
+	return args
+}
+
+func validateCIDR(value string) error {
+	_, _, err := net.ParseCIDR(value)
+	return err
+}
+
+func validateScope(value string) error {
+	switch network.Scope(value) {
+	case network.ScopePublic, network.ScopeCloudLocal, network.ScopeMachineLocal, network.ScopeLinkLocal:
+		return nil
+	}
+	return errors.Errorf("unknown scope %q", value)
+}
+
+// listValue is a gnuflag.Value for a comma-separated list, with each
+// item checked by validate if it's set.
+type listValue struct {
+	values   *[]string
+	validate func(string) error
+}
+
+// String is part of gnuflag.Value.
+func (v listValue) String() string {
+	return strings.Join(*v.values, ",")
+}
+
+// Set is part of gnuflag.Value.
+func (v listValue) Set(value string) error {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return errors.Errorf("empty item in %q", value)
+		}
+		if v.validate != nil {
+			if err := v.validate(item); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		values = append(values, item)
+	}
+	*v.values = values
+	return nil
+}
+
+// isSet returns whether anything other than the default policy has
+// been asked for.
+func (p *addressPolicy) isSet() bool {
+	return len(p.spaces) > 0 || len(p.cidrs) > 0 || len(p.scopes) > 0 || p.probe
+}
+
+// validate checks that the policy's flags can be used together with
+// the SSH flags.
+func (p *addressPolicy) validate() error {
+	if p.probe && len(machineSSH.JumpHosts) > 0 {
+		return errors.New("can't probe addresses of machines reached through bastion hosts")
+	}
+	return nil
+}
+
+// loadSpaces reads the subnets of the policy's spaces from state. It
+// needs to be called before choosing machine addresses.
+func (p *addressPolicy) loadSpaces(st *state.State) error {
+	if len(p.spaces) == 0 {
+		return nil
+	}
+	subnets, err := st.AllSubnets()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	wanted := set.NewStrings(p.spaces...)
+	found := set.NewStrings()
+	p.spaceNets = nil
+	for _, subnet := range subnets {
+		if !wanted.Contains(subnet.SpaceName()) {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(subnet.CIDR())
+		if err != nil {
+			return errors.Annotatef(err, "subnet %q", subnet.CIDR())
+		}
+		p.spaceNets = append(p.spaceNets, spaceNet{space: subnet.SpaceName(), net: ipNet})
+		found.Add(subnet.SpaceName())
+	}
+	if missing := wanted.Difference(found); !missing.IsEmpty() {
+		return errors.Errorf("no subnets in space(s) %s", strings.Join(missing.SortedValues(), ", "))
+	}
+	return nil
+}
+
+// addressCandidate is an address that a machine might be reached by.
+type addressCandidate struct {
+	address network.Address
+
+	// reason describes why the address is a candidate, such as
+	// "private" or "space db".
+	reason string
+}
+
+// machineAddressCandidates returns the machine's addresses in order of
+// preference: the preferred private address, the preferred public
+// address, then any others.
+func machineAddressCandidates(m *state.Machine) []addressCandidate {
+	var candidates []addressCandidate
+	seen := set.NewStrings()
+	add := func(address network.Address, reason string) {
+		if address.Value != "" && !seen.Contains(address.Value) {
+			seen.Add(address.Value)
+			candidates = append(candidates, addressCandidate{address, reason})
+		}
+	}
+	if private, err := m.PrivateAddress(); err == nil {
+		add(private, "private")
+	}
+	if public, err := m.PublicAddress(); err == nil {
+		add(public, "public")
+	}
+	for _, address := range m.Addresses() {
+		add(address, "other")
+	}
+	return candidates
+}
+
+// machineAddress returns the address to reach the machine by, and why
+// it was chosen. Containers are reached through their hosts, so their
+// addresses aren't probed.
+func (p *addressPolicy) machineAddress(m *state.Machine) (string, string, error) {
+	candidates := machineAddressCandidates(m)
+	if !p.isSet() {
+		if len(candidates) == 0 || candidates[0].reason == "other" {
+			return "", "", errors.New("no private nor public address")
+		}
+		return candidates[0].address.Value, candidates[0].reason, nil
+	}
+	_, isContainer := m.ParentId()
+	chosen, err := p.choose(candidates, p.probe && !isContainer)
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	return chosen.address.Value, chosen.reason, nil
+}
+
+// choose returns the first of the candidates allowed by the policy,
+// and that accepts SSH connections if probe is true.
+func (p *addressPolicy) choose(candidates []addressCandidate, probe bool) (addressCandidate, error) {
+	allowed := p.filter(candidates)
+	if len(allowed) == 0 {
+		return addressCandidate{}, errors.Errorf("none of the addresses %s match the address policy", candidateValues(candidates))
+	}
+	if !probe {
+		return allowed[0], nil
+	}
+	reachable := p.probeAddresses(candidateValues(allowed))
+	for _, candidate := range allowed {
+		if reachable[candidate.address.Value] {
+			candidate.reason += ", reachable"
+			return candidate, nil
+		}
+	}
+	return addressCandidate{}, errors.Errorf("none of the addresses %s accept SSH connections", candidateValues(allowed))
+}
+
+// filter returns the candidates in the policy's spaces, CIDRs and
+// scopes, with their reasons describing the matches.
+func (p *addressPolicy) filter(candidates []addressCandidate) []addressCandidate {
+	var result []addressCandidate
+	for _, candidate := range candidates {
+		var reasons []string
+		ip := net.ParseIP(candidate.address.Value)
+		if len(p.spaces) > 0 {
+			space := p.spaceOf(ip)
+			if space == "" {
+				continue
+			}
+			reasons = append(reasons, "space "+space)
+		}
+		if len(p.cidrs) > 0 {
+			cidr := matchCIDR(ip, p.cidrs)
+			if cidr == "" {
+				continue
+			}
+			reasons = append(reasons, "cidr "+cidr)
+		}
+		if len(p.scopes) > 0 {
+			scope := string(candidate.address.Scope)
+			if !set.NewStrings(p.scopes...).Contains(scope) {
+				continue
+			}
+			reasons = append(reasons, "scope "+scope)
+		}
+		if len(reasons) > 0 {
+			candidate.reason = strings.Join(reasons, ", ")
+		}
+		result = append(result, candidate)
+	}
+	return result
+}
+
+func (p *addressPolicy) spaceOf(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	for _, spaceNet := range p.spaceNets {
+		if spaceNet.net.Contains(ip) {
+			return spaceNet.space
+		}
+	}
+	return ""
+}
+
+func matchCIDR(ip net.IP, cidrs []string) string {
+	if ip == nil {
+		return ""
+	}
+	for _, cidr := range cidrs {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil && ipNet.Contains(ip) {
+			return cidr
+		}
+	}
+	return ""
+}
+
+func candidateValues(candidates []addressCandidate) string {
+	values := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		values[i] = candidate.address.Value
+	}
+	return strings.Join(values, ", ")
+}
+
+// apiAddress chooses the API server machine's address from the API
+// endpoints (host:port) in the environment's info. Only the CIDR and
+// scope parts of the policy apply, and probing is done from here.
+func (p *addressPolicy) apiAddress(hostPorts []string) (string, error) {
+	var candidates []addressCandidate
+	for _, hostPort := range hostPorts {
+		host, _, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			host = hostPort
+		}
+		candidates = append(candidates, addressCandidate{network.NewAddress(host), "api"})
+	}
+	if len(candidates) == 0 {
+		return "", errors.New("no API addresses")
+	}
+	policy := &addressPolicy{cidrs: p.cidrs, scopes: p.scopes}
+	probe := p.probe && len(apiServerSSH.JumpHosts) == 0
+	chosen, err := policy.choose(candidates, probe)
+	if err != nil {
+		return "", errors.Annotate(err, "choosing API server address")
+	}
+	logger.Debugf("using API server address %s (%s)", chosen.address.Value, chosen.reason)
+	return chosen.address.Value, nil
+}
+
+// probeMachines probes the candidate addresses of all of the machines
+// at once, so choosing their addresses doesn't wait on each in turn.
+func (p *addressPolicy) probeMachines(machines []*state.Machine) {
+	if !p.probe {
+		return
+	}
+	var addresses []string
+	for _, m := range machines {
+		if _, isContainer := m.ParentId(); isContainer {
+			continue
+		}
+		for _, candidate := range p.filter(machineAddressCandidates(m)) {
+			addresses = append(addresses, candidate.address.Value)
+		}
+	}
+	p.probeAddresses(addresses)
+}
+
+// probeAddresses returns which of the addresses accept SSH
+// connections, probing any that haven't been already.
+func (p *addressPolicy) probeAddresses(addresses []string) map[string]bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reachable == nil {
+		p.reachable = make(map[string]bool)
+	}
+	var unprobed []string
+	for _, address := range addresses {
+		if _, probed := p.reachable[address]; !probed {
+			unprobed = append(unprobed, address)
+		}
+	}
+	if len(unprobed) > 0 {
+		reachable, err := probeSSH(unprobed)
+		if err != nil {
+			logger.Warningf("probing addresses: %v", err)
+		}
+		for _, address := range unprobed {
+			p.reachable[address] = reachable.Contains(address)
+		}
+	}
+	result := make(map[string]bool)
+	for _, address := range addresses {
+		result[address] = p.reachable[address]
+	}
+	return result
+}
+
+// probeSSH returns the addresses that accept connections on the SSH
+// port. In client-driven mode they're probed from the API server
+// machine, since that's where the connections to them are made from.
+func probeSSH(addresses []string) (set.Strings, error) {
+	reachable := set.NewStrings()
+	if clientDriven() {
+		var script bytes.Buffer
+		for _, address := range addresses {
+			fmt.Fprintf(&script, "(timeout %d bash -c '</dev/tcp/%s/22' 2>/dev/null && echo %s) &\n",
+				int(probeTimeout/time.Second), address, address)
+		}
+		script.WriteString("wait\n")
+		var stdout bytes.Buffer
+		rc, err := runViaSSH(apiServerAddress, script.String(), withAPIServer(), withStdout(&stdout))
+		if err != nil {
+			return reachable, errors.Trace(err)
+		}
+		if rc != 0 {
+			return reachable, errors.Errorf("probe script exited %d", rc)
+		}
+		for _, address := range strings.Fields(stdout.String()) {
+			reachable.Add(address)
+		}
+		return reachable, nil
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, address := range addresses {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(address, "22"), probeTimeout)
+			if err != nil {
+				logger.Debugf("%s isn't reachable: %v", address, err)
+				return
+			}
+			conn.Close()
+			mu.Lock()
+			reachable.Add(address)
+			mu.Unlock()
+		}(address)
+	}
+	wg.Wait()
+	return reachable, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"net"
+
+	"github.com/juju/gnuflag"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju1/network"
+)
+
+type addressPolicySuite struct{}
+
+var _ = gc.Suite(&addressPolicySuite{})
+
+func (*addressPolicySuite) TearDownTest(c *gc.C) {
+	addressSelection = &addressPolicy{}
+}
+
+func candidates(values ...string) []addressCandidate {
+	result := make([]addressCandidate, len(values))
+	for i, value := range values {
+		result[i] = addressCandidate{network.NewAddress(value), "other"}
+	}
+	return result
+}
+
+func spaceNets(c *gc.C, spaces map[string]string) []spaceNet {
+	var result []spaceNet
+	for cidr, space := range spaces {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		c.Assert(err, jc.ErrorIsNil)
+		result = append(result, spaceNet{space: space, net: ipNet})
+	}
+	return result
+}
+
+func (*addressPolicySuite) TestChooseBySpace(c *gc.C) {
+	p := &addressPolicy{
+		spaces: []string{"db"},
+		spaceNets: spaceNets(c, map[string]string{
+			"10.20.0.0/16": "db",
+		}),
+	}
+	chosen, err := p.choose(candidates("10.0.0.5", "10.20.1.5"), false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(chosen.address.Value, gc.Equals, "10.20.1.5")
+	c.Assert(chosen.reason, gc.Equals, "space db")
+}
+
+func (*addressPolicySuite) TestChooseByCIDRAndScope(c *gc.C) {
+	p := &addressPolicy{
+		cidrs:  []string{"192.168.0.0/16", "10.0.0.0/8"},
+		scopes: []string{"local-cloud"},
+	}
+	chosen, err := p.choose(candidates("54.1.2.3", "10.0.0.5"), false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(chosen.address.Value, gc.Equals, "10.0.0.5")
+	c.Assert(chosen.reason, gc.Equals, "cidr 10.0.0.0/8, scope local-cloud")
+}
+
+func (*addressPolicySuite) TestChooseNoneMatch(c *gc.C) {
+	p := &addressPolicy{scopes: []string{"public"}}
+	_, err := p.choose(candidates("10.0.0.5", "fe80::1"), false)
+	c.Assert(err, gc.ErrorMatches, "none of the addresses 10.0.0.5, fe80::1 match the address policy")
+}
+
+func (*addressPolicySuite) TestAPIAddress(c *gc.C) {
+	address, err := addressSelection.apiAddress([]string{"54.1.2.3:17070", "[fd00::1]:17070"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(address, gc.Equals, "54.1.2.3")
+
+	// The spaces aren't known on the client, so only the CIDRs apply.
+	addressSelection.spaces = []string{"db"}
+	addressSelection.cidrs = []string{"fd00::/8"}
+	address, err = addressSelection.apiAddress([]string{"54.1.2.3:17070", "[fd00::1]:17070"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(address, gc.Equals, "fd00::1")
+}
+
+func (*addressPolicySuite) TestFlags(c *gc.C) {
+	f := gnuflag.NewFlagSet("test", gnuflag.ContinueOnError)
+	setAddressFlags(f)
+	err := f.Parse(true, []string{
+		"--address-space", "db, admin",
+		"--address-cidr", "10.0.0.0/8",
+		"--probe-addresses",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(addressSelection.spaces, jc.DeepEquals, []string{"db", "admin"})
+	c.Assert(addressFlagArgs(), jc.DeepEquals, []string{
+		"--address-space", "'db,admin'",
+		"--address-cidr", "'10.0.0.0/8'",
+		"--probe-addresses",
+	})
+
+	err = f.Parse(true, []string{"--address-cidr", "10.0.0.0"})
+	c.Assert(err, gc.ErrorMatches, `invalid value "10.0.0.0" for flag .*address-cidr: .*`)
+	err = f.Parse(true, []string{"--address-scope", "global"})
+	c.Assert(err, gc.ErrorMatches, `invalid value "global" for flag .*address-scope: unknown scope "global"`)
+}
+
+func (*addressPolicySuite) TestDefaultPolicyFlagArgs(c *gc.C) {
+	c.Assert(addressSelection.isSet(), jc.IsFalse)
+	c.Assert(addressFlagArgs(), gc.HasLen, 0)
+}
+
+func (*addressPolicySuite) TestValidate(c *gc.C) {
+	defer func(hosts []string) { machineSSH.JumpHosts = hosts }(machineSSH.JumpHosts)
+	p := &addressPolicy{probe: true}
+	c.Assert(p.validate(), jc.ErrorIsNil)
+
+	machineSSH.JumpHosts = []string{"bastion"}
+	c.Assert(p.validate(), gc.ErrorMatches, "can't probe addresses of machines reached through bastion hosts")
+
+	p.probe = false
+	c.Assert(p.validate(), jc.ErrorIsNil)
+}
@@ -4,6 +4,9 @@
 package commands
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 
 	"github.com/juju/errors"
@@ -28,7 +31,45 @@ func getCurrentMachineTag(datadir string) (names.MachineTag, error) {
 	}
 }
 
-func getConfig(tag names.MachineTag) (agent.ConfigSetterWriter, error) {
-	path := agent.ConfigPath("/var/lib/juju", tag)
-	return agent.ReadConfig(path)
+// apiServerAgentConfigPath returns the path of the machine agent's
+// config on the API server machine, and a function to call once it's
+// been read. In client-driven mode the config is copied from the
+// machine into a temporary file, which the function removes.
+func apiServerAgentConfigPath() (string, func(), error) {
+	if !clientDriven() {
+		tag, err := getCurrentMachineTag(dataDir)
+		if err != nil {
+			return "", nil, errors.Annotate(err, "finding machine tag")
+		}
+		return agent.ConfigPath(dataDir, tag), func() {}, nil
+	}
+
+	f, err := ioutil.TempFile("", "1.25-upgrade-agent-conf")
+	if err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	remove := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	script := fmt.Sprintf(`
+set -e
+cd %s/agents
+agents=$(ls -d machine-*)
+if [ $(echo $agents | wc -w) -ne 1 ]; then
+    echo "expected one machine agent, found: $agents" >&2
+    exit 1
+fi
+cat $agents/agent.conf
+`, dataDir)
+	rc, err := runViaSSH(apiServerAddress, script, withAPIServer(), withStdout(f))
+	if err != nil {
+		remove()
+		return "", nil, errors.Annotate(err, "reading agent config from API server machine")
+	}
+	if rc != 0 {
+		remove()
+		return "", nil, errors.Errorf("reading agent config from API server machine exited %d", rc)
+	}
+	return f.Name(), remove, nil
 }
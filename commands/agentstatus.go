@@ -11,6 +11,7 @@ import (
 
 	"github.com/juju/cmd"
 	"github.com/juju/errors"
+	"github.com/juju/utils/set"
 
 	"github.com/juju/1.25-upgrade/juju1/state"
 )
@@ -127,10 +128,14 @@ func loadSavedMachines() ([]FlatMachine, error) {
 }
 
 func getMachines(st *state.State) ([]FlatMachine, error) {
+	if err := addressSelection.loadSpaces(st); err != nil {
+		return nil, errors.Annotate(err, "loading address policy")
+	}
 	machines, err := st.AllMachines()
 	if err != nil {
 		return nil, errors.Annotate(err, "getting 1.25 machines")
 	}
+	addressSelection.probeMachines(machines)
 	result := make([]FlatMachine, len(machines))
 	for i, m := range machines {
 		fm, err := makeFlatMachine(st, m)
@@ -144,15 +149,16 @@ func getMachines(st *state.State) ([]FlatMachine, error) {
 }
 
 func makeFlatMachine(st *state.State, m *state.Machine) (FlatMachine, error) {
-	address, err := getMachineAddress(m)
+	address, source, err := addressSelection.machineAddress(m)
 	if err != nil {
 		return FlatMachine{}, errors.Annotatef(err, "address for machine %q", m.Id())
 	}
 	fm := FlatMachine{
-		Model:   st.EnvironUUID(),
-		Series:  m.Series(),
-		ID:      m.Id(),
-		Address: address,
+		Model:         st.EnvironUUID(),
+		Series:        m.Series(),
+		ID:            m.Id(),
+		Address:       address,
+		AddressSource: source,
 	}
 	if instanceId, err := m.InstanceId(); err == nil {
 		fm.InstanceID = string(instanceId)
@@ -164,6 +170,25 @@ func makeFlatMachine(st *state.State, m *state.Machine) (FlatMachine, error) {
 	} else if !errors.IsNotFound(err) {
 		return FlatMachine{}, errors.Trace(err)
 	}
+	if zone, err := m.AvailabilityZone(); err == nil {
+		fm.AvailabilityZone = zone
+	} else if !errors.IsNotProvisioned(err) {
+		return FlatMachine{}, errors.Trace(err)
+	}
+	if hw, err := m.HardwareCharacteristics(); err == nil && hw.Arch != nil {
+		fm.Arch = *hw.Arch
+	} else if err != nil && !errors.IsNotFound(err) {
+		return FlatMachine{}, errors.Trace(err)
+	}
+	units, err := m.Units()
+	if err != nil {
+		return FlatMachine{}, errors.Trace(err)
+	}
+	applications := set.NewStrings()
+	for _, unit := range units {
+		applications.Add(unit.ServiceName())
+	}
+	fm.Applications = applications.SortedValues()
 	if parentId, ok := m.ParentId(); ok {
 		host, err := st.Machine(parentId)
 		if err != nil {
@@ -174,20 +199,21 @@ func makeFlatMachine(st *state.State, m *state.Machine) (FlatMachine, error) {
 			return FlatMachine{}, errors.Trace(err)
 		}
 		fm.HostAddress = hostAddress
+		// Containers are in the same zone as their host.
+		if zone, err := host.AvailabilityZone(); err == nil {
+			fm.AvailabilityZone = zone
+		} else if !errors.IsNotProvisioned(err) {
+			return FlatMachine{}, errors.Trace(err)
+		}
 	}
 	return fm, nil
 }
 
+// getMachineAddress returns the address to reach the machine by,
+// chosen by the address policy. By default that's the private
+// address, which is more likely to be set, falling back to the public
+// address.
 func getMachineAddress(m *state.Machine) (string, error) {
-	// Start with the private address, which is more likely to be set
-	// fallback to the public address, and error out if they are both missing.
-	private, err := m.PrivateAddress()
-	if err == nil {
-		return private.Value, nil
-	}
-	public, err := m.PublicAddress()
-	if err != nil {
-		return "", errors.New("no private nor public address")
-	}
-	return public.Value, nil
+	address, _, err := addressSelection.machineAddress(m)
+	return address, errors.Trace(err)
 }
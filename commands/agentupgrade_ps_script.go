@@ -0,0 +1,167 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+// Generated code - do not edit.
+
+const agentUpgradePowerShellScript = `# Copyright 2017 Canonical Ltd.
+# Licensed under the AGPLv3, see LICENCE file for details.
+#
+# Upgrades the local agents on a Windows machine to use the new tools
+# in a directory beside this script. The agent configurations have
+# already been rewritten by the upgrade tool and are in the configs
+# directory beside this script. Keeps all changed files in
+# C:\Juju\lib\juju\1.25-upgrade-rollback so that they can be restored
+# if needed.
+param([switch]$Rollback)
+
+$ErrorActionPreference = "Stop"
+
+$BaseDir = "C:\Juju\lib\juju"
+$RollbackDir = Join-Path $BaseDir "1.25-upgrade-rollback"
+$ToolsDir = Join-Path $BaseDir "tools"
+$AgentsDir = Join-Path $BaseDir "agents"
+
+$UpgradeDir = $PSScriptRoot
+$ConfigsDir = Join-Path $UpgradeDir "configs"
+
+$HookTools = @(
+    "action-fail",
+    "action-get",
+    "action-set",
+    "add-metric",
+    "application-version-set",
+    "close-port",
+    "config-get",
+    "is-leader",
+    "juju-log",
+    "juju-reboot",
+    "leader-get",
+    "leader-set",
+    "network-get",
+    "opened-ports",
+    "open-port",
+    "payload-register",
+    "payload-status-set",
+    "payload-unregister",
+    "relation-get",
+    "relation-ids",
+    "relation-list",
+    "relation-set",
+    "resource-get",
+    "status-get",
+    "status-set",
+    "storage-add",
+    "storage-get",
+    "storage-list",
+    "unit-get"
+)
+
+function All-Agents {
+    return Get-ChildItem $AgentsDir | ForEach-Object { $_.Name }
+}
+
+function Find-NewTools {
+    $dirs = @(Get-ChildItem $UpgradeDir -Directory | Where-Object { $_.Name -ne "configs" })
+    if ($dirs.Count -ne 1) {
+        Throw "expected one tools directory, found: $($dirs | ForEach-Object { $_.Name })"
+    }
+    return $dirs[0]
+}
+
+function Remove-Link($linkPath) {
+    if (Test-Path $linkPath) {
+        # rmdir removes a directory symlink without touching the target.
+        cmd /c rmdir "$linkPath" | Out-Null
+    }
+}
+
+function New-DirLink($linkPath, $target) {
+    Remove-Link $linkPath
+    cmd /c mklink /D "$linkPath" "$target" | Out-Null
+    if ($LASTEXITCODE -ne 0) {
+        Throw "cannot link $linkPath to $target"
+    }
+}
+
+function Assert-AgentsStopped {
+    foreach ($agent in All-Agents) {
+        $query = sc.exe query "jujud-$agent" | Out-String
+        if ($query -notmatch "STOPPED") {
+            Throw "service jujud-$agent is not stopped"
+        }
+    }
+}
+
+function Save-RollbackInfo {
+    New-Item -ItemType Directory $RollbackDir | Out-Null
+    foreach ($agent in All-Agents) {
+        $link = Get-Item (Join-Path $ToolsDir $agent)
+        Set-Content (Join-Path $RollbackDir "$agent.target") $link.Target
+        Copy-Item (Join-Path $AgentsDir "$agent\agent.conf") (Join-Path $RollbackDir "$($agent)_agent.conf")
+    }
+}
+
+function Install-Tools {
+    $newTools = Find-NewTools
+    $destPath = Join-Path $ToolsDir $newTools.Name
+    Copy-Item -Recurse $newTools.FullName $destPath
+    $metadata = @{version = $newTools.Name; url = ""; size = 0} | ConvertTo-Json -Compress
+    Set-Content (Join-Path $destPath "downloaded-tools.txt") $metadata
+    # Make all the hook tools link to jujud.
+    $jujud = Join-Path $destPath "jujud.exe"
+    foreach ($tool in $HookTools) {
+        $toolPath = Join-Path $destPath "$tool.exe"
+        if (Test-Path $toolPath) {
+            Remove-Item $toolPath
+        }
+        cmd /c mklink "$toolPath" "$jujud" | Out-Null
+    }
+    # Make all of the agent tools dirs link to the new version.
+    foreach ($agent in All-Agents) {
+        New-DirLink (Join-Path $ToolsDir $agent) $destPath
+    }
+}
+
+function Update-Configs {
+    foreach ($agent in All-Agents) {
+        $newConfig = Join-Path $ConfigsDir "$agent.conf"
+        if (-not (Test-Path $newConfig)) {
+            Throw "no upgraded config found for $agent"
+        }
+        Copy-Item -Force $newConfig (Join-Path $AgentsDir "$agent\agent.conf")
+    }
+}
+
+function Invoke-Upgrade {
+    if (Test-Path $RollbackDir) {
+        Throw "saved rollback information found - aborting"
+    }
+    Assert-AgentsStopped
+    Save-RollbackInfo
+    Install-Tools
+    Update-Configs
+}
+
+function Invoke-Rollback {
+    if (-not (Test-Path $RollbackDir)) {
+        Throw "no rollback information found"
+    }
+    foreach ($agent in All-Agents) {
+        $target = (Get-Content (Join-Path $RollbackDir "$agent.target")).Trim()
+        New-DirLink (Join-Path $ToolsDir $agent) $target
+        Copy-Item -Force (Join-Path $RollbackDir "$($agent)_agent.conf") (Join-Path $AgentsDir "$agent\agent.conf")
+    }
+    $addedTools = Join-Path $ToolsDir (Find-NewTools).Name
+    Remove-Item -Recurse -Force $addedTools
+    Remove-Item -Recurse -Force $RollbackDir
+}
+
+if ($Rollback) {
+    Invoke-Rollback
+} else {
+    Invoke-Upgrade
+}
+exit 0
+`
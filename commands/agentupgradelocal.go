@@ -0,0 +1,667 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/utils/fs"
+	"github.com/juju/utils/series"
+	"github.com/juju/utils/tar"
+	"github.com/juju/version"
+	"github.com/kardianos/osext"
+	names2 "gopkg.in/juju/names.v2"
+
+	agent1 "github.com/juju/1.25-upgrade/juju1/agent"
+	agent2 "github.com/juju/1.25-upgrade/juju2/agent"
+	"github.com/juju/1.25-upgrade/juju2/service"
+	"github.com/juju/1.25-upgrade/juju2/state/multiwatcher"
+)
+
+const (
+	agentUpgradeConfigFile = "agent-upgrade.json"
+
+	upstartDir = "/etc/init"
+	systemdDir = "/etc/systemd/system"
+)
+
+// hookTools are the commands that are linked to jujud in the new
+// tools directory.
+var hookTools = []string{
+	"action-fail",
+	"action-get",
+	"action-set",
+	"add-metric",
+	"application-version-set",
+	"close-port",
+	"config-get",
+	"is-leader",
+	"juju-log",
+	"juju-reboot",
+	"leader-get",
+	"leader-set",
+	"network-get",
+	"opened-ports",
+	"open-port",
+	"payload-register",
+	"payload-status-set",
+	"payload-unregister",
+	"relation-get",
+	"relation-ids",
+	"relation-list",
+	"relation-set",
+	"resource-get",
+	"status-get",
+	"status-set",
+	"storage-add",
+	"storage-get",
+	"storage-list",
+	"unit-get",
+}
+
+// agentUpgradeConfig holds the details of the target controller
+// needed to rewrite the agent configs. It's written beside the
+// plugin binary by upgrade-agents.
+type agentUpgradeConfig struct {
+	ControllerTag string
+	CACert        string
+	APIAddresses  []string
+	Version       string
+}
+
+func newAgentUpgradeConfig(config *scriptConfig) agentUpgradeConfig {
+	return agentUpgradeConfig{
+		ControllerTag: config.ControllerTag,
+		CACert:        config.ControllerInfo.CACert,
+		APIAddresses:  config.ControllerInfo.Addrs,
+		Version:       config.Version.String(),
+	}
+}
+
+var agentUpgradeLocalDoc = `
+
+agent-upgrade-local is run by upgrade-agents and abort on each machine
+in the environment, from the directory the new tools were copied to.
+
+It installs the new tools and rewrites the agent configs to talk to
+the target controller, keeping all changed files in
+/var/lib/juju/1.25-upgrade-rollback so that they can be restored by
+running it again with --rollback.
+
+`
+
+func newAgentUpgradeLocalCommand() cmd.Command {
+	return &agentUpgradeLocalCommand{}
+}
+
+type agentUpgradeLocalCommand struct {
+	cmd.CommandBase
+
+	rollback bool
+}
+
+func (c *agentUpgradeLocalCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "agent-upgrade-local",
+		Purpose: "machine aspect of upgrade-agents",
+		Doc:     agentUpgradeLocalDoc,
+	}
+}
+
+func (c *agentUpgradeLocalCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.CommandBase.SetFlags(f)
+	f.BoolVar(&c.rollback, "rollback", false, "undo a previous upgrade")
+}
+
+func (c *agentUpgradeLocalCommand) Run(ctx *cmd.Context) error {
+	plugin, err := osext.Executable()
+	if err != nil {
+		return errors.Annotate(err, "finding plugin location")
+	}
+	hostSeries, err := series.HostSeries()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	initSystem, err := service.VersionInitSystem(hostSeries)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	upgrader := &localAgentUpgrader{
+		dataDir:    dataDir,
+		upgradeDir: filepath.Dir(plugin),
+		upstartDir: upstartDir,
+		systemdDir: systemdDir,
+		upstart:    initSystem == service.InitSystemUpstart,
+	}
+	if c.rollback {
+		return errors.Trace(upgrader.rollback())
+	}
+	return errors.Trace(upgrader.upgrade())
+}
+
+// localAgentUpgrader installs new tools for the agents on the current
+// machine and rewrites their configs, or rolls those changes back.
+// This does the same as agent-upgrade.py used to, without needing
+// Python on the machine.
+type localAgentUpgrader struct {
+	dataDir    string
+	upgradeDir string
+	upstartDir string
+	systemdDir string
+	upstart    bool
+}
+
+func (u *localAgentUpgrader) rollbackDir() string {
+	return filepath.Join(u.dataDir, "1.25-upgrade-rollback")
+}
+
+func (u *localAgentUpgrader) rollbackInitDir() string {
+	return filepath.Join(u.rollbackDir(), "init")
+}
+
+func (u *localAgentUpgrader) toolsDir() string {
+	return filepath.Join(u.dataDir, "tools")
+}
+
+func (u *localAgentUpgrader) agentsDir() string {
+	return filepath.Join(u.dataDir, "agents")
+}
+
+func (u *localAgentUpgrader) initDir() string {
+	return filepath.Join(u.dataDir, "init")
+}
+
+func (u *localAgentUpgrader) upgrade() error {
+	if _, err := os.Stat(u.rollbackDir()); err == nil {
+		return errors.New("saved rollback information found - aborting")
+	}
+	data, err := ioutil.ReadFile(filepath.Join(u.upgradeDir, agentUpgradeConfigFile))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var config agentUpgradeConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return errors.Annotate(err, "reading upgrade config")
+	}
+	if err := u.saveRollbackInfo(); err != nil {
+		return errors.Annotate(err, "saving rollback information")
+	}
+	if err := u.installTools(); err != nil {
+		return errors.Annotate(err, "installing tools")
+	}
+	return errors.Annotate(u.updateConfigs(config), "updating agent configs")
+}
+
+func (u *localAgentUpgrader) allAgents() ([]string, error) {
+	infos, err := ioutil.ReadDir(u.agentsDir())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	agents := make([]string, len(infos))
+	for i, info := range infos {
+		agents[i] = info.Name()
+	}
+	return agents, nil
+}
+
+func (u *localAgentUpgrader) saveRollbackInfo() error {
+	if err := os.MkdirAll(u.rollbackInitDir(), 0755); err != nil {
+		return errors.Trace(err)
+	}
+	agents, err := u.allAgents()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, agent := range agents {
+		target, err := os.Readlink(filepath.Join(u.toolsDir(), agent))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err := os.Symlink(target, filepath.Join(u.rollbackDir(), agent)); err != nil {
+			return errors.Trace(err)
+		}
+		if err := copyFile(
+			filepath.Join(u.rollbackDir(), agent+"_agent.conf"),
+			agentConfigPath(u.dataDir, agent),
+		); err != nil {
+			return errors.Trace(err)
+		}
+
+		if u.upstart {
+			conf := upstartConf(agent)
+			if err := copyFile(
+				filepath.Join(u.rollbackInitDir(), conf),
+				filepath.Join(u.upstartDir, conf),
+			); err != nil {
+				return errors.Trace(err)
+			}
+			continue
+		}
+		// Grab the service symlink...
+		serviceConf := systemdConf(agent)
+		target, err = os.Readlink(filepath.Join(u.systemdDir, serviceConf))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err := os.Symlink(target, filepath.Join(u.rollbackInitDir(), serviceConf)); err != nil {
+			return errors.Trace(err)
+		}
+		// ...And the init subdir.
+		dirname := "jujud-" + agent
+		if err := fs.Copy(
+			filepath.Join(u.initDir(), dirname),
+			filepath.Join(u.rollbackInitDir(), dirname),
+		); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// findNewTools returns the path of the tools tarball copied beside
+// the plugin.
+func (u *localAgentUpgrader) findNewTools() (string, error) {
+	files, err := filepath.Glob(filepath.Join(u.upgradeDir, "*.tgz"))
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if len(files) != 1 {
+		return "", errors.Errorf("expected one tools file, found %v", files)
+	}
+	return files[0], nil
+}
+
+func (u *localAgentUpgrader) installTools() error {
+	newToolsPath, err := u.findNewTools()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// get 2.2.3-xenial-amd64 from ~/1.25-agent-upgrade/2.2.3-xenial-amd64.tgz
+	toolsBase := strings.TrimSuffix(filepath.Base(newToolsPath), ".tgz")
+	destPath := filepath.Join(u.toolsDir(), toolsBase)
+	if err := os.Mkdir(destPath, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	if err := unpackTools(newToolsPath, destPath); err != nil {
+		return errors.Trace(err)
+	}
+	metadata, err := json.Marshal(map[string]interface{}{
+		"version": toolsBase,
+		"url":     "",
+		"size":    0,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := writeFile(
+		filepath.Join(destPath, toolsFile),
+		0644,
+		bytes.NewReader(metadata),
+	); err != nil {
+		return errors.Trace(err)
+	}
+	// Make all the hook tools link to jujud.
+	jujud := filepath.Join(destPath, "jujud")
+	for _, tool := range hookTools {
+		if err := forceSymlink(jujud, filepath.Join(destPath, tool)); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	// Make all of the agent tools dirs link to the new version.
+	agents, err := u.allAgents()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, agent := range agents {
+		_, agent = convertLXCAgent(agent)
+		if err := forceSymlink(destPath, filepath.Join(u.toolsDir(), agent)); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func (u *localAgentUpgrader) updateConfigs(config agentUpgradeConfig) error {
+	agents, err := u.allAgents()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	needInitReload := false
+	for _, agent := range agents {
+		if lxc, lxdAgent := convertLXCAgent(agent); lxc {
+			if err := os.Rename(
+				filepath.Join(u.agentsDir(), agent),
+				filepath.Join(u.agentsDir(), lxdAgent),
+			); err != nil {
+				return errors.Trace(err)
+			}
+			if err := u.updateInitScripts(agent, lxdAgent); err != nil {
+				return errors.Annotatef(err, "updating init scripts for %s", lxdAgent)
+			}
+			needInitReload = true
+			agent = lxdAgent
+		}
+		if err := upgradeLocalAgentConfig(agentConfigPath(u.dataDir, agent), config); err != nil {
+			return errors.Annotatef(err, "upgrading config for %s", agent)
+		}
+	}
+	if needInitReload {
+		return errors.Trace(u.reloadInit())
+	}
+	return nil
+}
+
+// upgradeLocalAgentConfig reads the 1.25 agent config at configPath
+// and writes a 2.x config for the agent pointing at the target
+// controller. Container machine agents are renamed from lxc to lxd,
+// so the new config is written to the directory for the new tag.
+func upgradeLocalAgentConfig(configPath string, config agentUpgradeConfig) error {
+	oldConfig, err := agent1.ReadConfig(configPath)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, tagString := convertLXCAgent(oldConfig.Tag().String())
+	tag, err := names2.ParseTag(tagString)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var jobs []multiwatcher.MachineJob
+	if tag.Kind() == names2.MachineTagKind {
+		// None of these machines will need to manage the environ anymore.
+		jobs = []multiwatcher.MachineJob{multiwatcher.JobHostUnits}
+	}
+	controllerTag, err := names2.ParseControllerTag(config.ControllerTag)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	upgradedToVersion, err := version.Parse(config.Version)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var apiPassword string
+	if apiInfo, ok := oldConfig.APIInfo(); ok {
+		apiPassword = apiInfo.Password
+	}
+	password := oldConfig.OldPassword()
+	if password == "" {
+		password = apiPassword
+	}
+
+	newConfig, err := agent2.NewAgentConfig(agent2.AgentConfigParams{
+		Paths: agent2.Paths{
+			DataDir: oldConfig.DataDir(),
+			LogDir:  oldConfig.LogDir(),
+		},
+		Jobs:              jobs,
+		UpgradedToVersion: upgradedToVersion,
+		Tag:               tag,
+		Password:          password,
+		Nonce:             oldConfig.Nonce(),
+		Controller:        controllerTag,
+		Model:             names2.NewModelTag(oldConfig.Environment().Id()),
+		APIAddresses:      config.APIAddresses,
+		CACert:            config.CACert,
+		Values:            oldConfig.AllValues(),
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if apiPassword != "" {
+		newConfig.SetPassword(apiPassword)
+	}
+	return errors.Trace(newConfig.Write())
+}
+
+func (u *localAgentUpgrader) updateInitScripts(lxcAgent, lxdAgent string) error {
+	if u.upstart {
+		lxcPath := filepath.Join(u.upstartDir, upstartConf(lxcAgent))
+		lxdPath := filepath.Join(u.upstartDir, upstartConf(lxdAgent))
+		if err := rewriteLXCToLXD(lxcPath, lxdPath); err != nil {
+			return errors.Trace(err)
+		}
+		return errors.Trace(safeUnlink(lxcPath))
+	}
+
+	lxcDir := filepath.Join(u.initDir(), "jujud-"+lxcAgent)
+	lxdDir := filepath.Join(u.initDir(), "jujud-"+lxdAgent)
+
+	// Create lxd versions of service file and exec-start script.
+	if err := os.Mkdir(lxdDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	lxdServicePath := filepath.Join(lxdDir, systemdConf(lxdAgent))
+	if err := rewriteLXCToLXD(
+		filepath.Join(lxcDir, systemdConf(lxcAgent)),
+		lxdServicePath,
+	); err != nil {
+		return errors.Trace(err)
+	}
+	lxdExecStart := filepath.Join(lxdDir, "exec-start.sh")
+	if err := rewriteLXCToLXD(filepath.Join(lxcDir, "exec-start.sh"), lxdExecStart); err != nil {
+		return errors.Trace(err)
+	}
+	if err := os.Chmod(lxdExecStart, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	if err := os.RemoveAll(lxcDir); err != nil {
+		return errors.Trace(err)
+	}
+
+	// Correct the link from /etc/systemd/system
+	if err := safeUnlink(filepath.Join(u.systemdDir, systemdConf(lxcAgent))); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(forceSymlink(lxdServicePath, filepath.Join(u.systemdDir, systemdConf(lxdAgent))))
+}
+
+func (u *localAgentUpgrader) reloadInit() error {
+	command := exec.Command("/bin/systemctl", "daemon-reload")
+	if u.upstart {
+		command = exec.Command("/sbin/initctl", "reload-configuration")
+	}
+	output, err := command.CombinedOutput()
+	if err != nil {
+		return errors.Annotatef(err, "reloading init configuration: %s", output)
+	}
+	return nil
+}
+
+func (u *localAgentUpgrader) rollback() error {
+	if _, err := os.Stat(u.rollbackDir()); err != nil {
+		return errors.New("no rollback information found")
+	}
+	agents, err := u.allAgents()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	needInitReload := false
+	for _, agent := range agents {
+		if lxd, lxcAgent := convertLXDAgent(agent); lxd {
+			// We need to rename the agent dir and get rid of the tools
+			// link for the lxd version of the agent.
+			if err := os.Rename(
+				filepath.Join(u.agentsDir(), agent),
+				filepath.Join(u.agentsDir(), lxcAgent),
+			); err != nil {
+				return errors.Trace(err)
+			}
+			if err := safeUnlink(filepath.Join(u.toolsDir(), agent)); err != nil {
+				return errors.Trace(err)
+			}
+			if err := u.rollbackInitFiles(agent, lxcAgent); err != nil {
+				return errors.Annotatef(err, "rolling back init files for %s", lxcAgent)
+			}
+			needInitReload = true
+			agent = lxcAgent
+		}
+
+		target, err := os.Readlink(filepath.Join(u.rollbackDir(), agent))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err := forceSymlink(target, filepath.Join(u.toolsDir(), agent)); err != nil {
+			return errors.Trace(err)
+		}
+		if err := copyFile(
+			agentConfigPath(u.dataDir, agent),
+			filepath.Join(u.rollbackDir(), agent+"_agent.conf"),
+		); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	newToolsPath, err := u.findNewTools()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	toolsBase := strings.TrimSuffix(filepath.Base(newToolsPath), ".tgz")
+	if err := os.RemoveAll(filepath.Join(u.toolsDir(), toolsBase)); err != nil {
+		return errors.Trace(err)
+	}
+	if err := os.RemoveAll(u.rollbackDir()); err != nil {
+		return errors.Trace(err)
+	}
+
+	if needInitReload {
+		return errors.Trace(u.reloadInit())
+	}
+	return nil
+}
+
+func (u *localAgentUpgrader) rollbackInitFiles(lxdAgent, lxcAgent string) error {
+	if u.upstart {
+		if err := safeUnlink(filepath.Join(u.upstartDir, upstartConf(lxdAgent))); err != nil {
+			return errors.Trace(err)
+		}
+		conf := upstartConf(lxcAgent)
+		return errors.Trace(copyFile(
+			filepath.Join(u.upstartDir, conf),
+			filepath.Join(u.rollbackInitDir(), conf),
+		))
+	}
+
+	// Get rid of any lxd version of the agent files under /var/lib/juju/init.
+	if err := os.RemoveAll(filepath.Join(u.initDir(), "jujud-"+lxdAgent)); err != nil {
+		return errors.Trace(err)
+	}
+
+	// Reinstate the lxc init files.
+	lxcInitDir := filepath.Join(u.initDir(), "jujud-"+lxcAgent)
+	if err := os.RemoveAll(lxcInitDir); err != nil {
+		return errors.Trace(err)
+	}
+	if err := fs.Copy(filepath.Join(u.rollbackInitDir(), "jujud-"+lxcAgent), lxcInitDir); err != nil {
+		return errors.Trace(err)
+	}
+
+	// Get rid of any lxd symlink from /etc/systemd/system.
+	if err := safeUnlink(filepath.Join(u.systemdDir, systemdConf(lxdAgent))); err != nil {
+		return errors.Trace(err)
+	}
+	// Reinstate the lxc link.
+	lxcAgentConf := systemdConf(lxcAgent)
+	return errors.Trace(forceSymlink(
+		filepath.Join(lxcInitDir, lxcAgentConf),
+		filepath.Join(u.systemdDir, lxcAgentConf),
+	))
+}
+
+func agentConfigPath(dataDir, agent string) string {
+	return filepath.Join(dataDir, "agents", agent, "agent.conf")
+}
+
+func upstartConf(agent string) string {
+	return "jujud-" + agent + ".conf"
+}
+
+func systemdConf(agent string) string {
+	return "jujud-" + agent + ".service"
+}
+
+func convertContainerAgent(agent, fromType, toType string) (bool, string) {
+	parts := strings.Split(agent, "-")
+	match := false
+	for i, part := range parts {
+		if part == fromType {
+			match = true
+			parts[i] = toType
+		}
+	}
+	return match, strings.Join(parts, "-")
+}
+
+func convertLXCAgent(agent string) (bool, string) {
+	return convertContainerAgent(agent, "lxc", "lxd")
+}
+
+func convertLXDAgent(agent string) (bool, string) {
+	return convertContainerAgent(agent, "lxd", "lxc")
+}
+
+// rewriteLXCToLXD copies the contents of lxcPath into lxdPath,
+// converting lxc to lxd on the way.
+func rewriteLXCToLXD(lxcPath, lxdPath string) error {
+	data, err := ioutil.ReadFile(lxcPath)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	updated := strings.Replace(string(data), "lxc", "lxd", -1)
+	return errors.Trace(ioutil.WriteFile(lxdPath, []byte(updated), 0644))
+}
+
+// safeUnlink removes the file at location, if there is one.
+func safeUnlink(location string) error {
+	err := os.Remove(location)
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+	return errors.Trace(err)
+}
+
+func forceSymlink(target, dest string) error {
+	if err := safeUnlink(dest); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(os.Symlink(target, dest))
+}
+
+// copyFile copies source to dest, keeping the file mode - agent
+// configs contain passwords.
+func copyFile(dest, source string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	return errors.Trace(writeFile(dest, info.Mode(), f))
+}
+
+// unpackTools extracts the tools tarball at toolsPath into destDir.
+func unpackTools(toolsPath, destDir string) error {
+	f, err := os.Open(toolsPath)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.Annotatef(err, "reading %s", toolsPath)
+	}
+	defer gzr.Close()
+	return errors.Annotatef(tar.UntarFiles(gzr, destDir), "unpacking %s", toolsPath)
+}
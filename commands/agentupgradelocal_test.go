@@ -0,0 +1,172 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/names"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	agent1 "github.com/juju/1.25-upgrade/juju1/agent"
+	version1 "github.com/juju/1.25-upgrade/juju1/version"
+	agent2 "github.com/juju/1.25-upgrade/juju2/agent"
+)
+
+type localAgentUpgraderSuite struct {
+	upgrader *localAgentUpgrader
+}
+
+var _ = gc.Suite(&localAgentUpgraderSuite{})
+
+const testEnvironUUID = "deadbeef-0bad-400d-8000-4b1d0d06f00d"
+
+func (s *localAgentUpgraderSuite) SetUpTest(c *gc.C) {
+	root := c.MkDir()
+	s.upgrader = &localAgentUpgrader{
+		dataDir:    filepath.Join(root, "var", "lib", "juju"),
+		upgradeDir: filepath.Join(root, "upgrade"),
+		upstartDir: filepath.Join(root, "etc", "init"),
+		systemdDir: filepath.Join(root, "etc", "systemd"),
+	}
+	for _, dir := range []string{
+		s.upgrader.upgradeDir,
+		s.upgrader.systemdDir,
+		filepath.Join(s.upgrader.toolsDir(), "1.25.13-trusty-amd64"),
+		filepath.Join(s.upgrader.initDir(), "jujud-unit-mysql-0"),
+	} {
+		c.Assert(os.MkdirAll(dir, 0755), jc.ErrorIsNil)
+	}
+
+	// An installed 1.25 unit agent.
+	config, err := agent1.NewAgentConfig(agent1.AgentConfigParams{
+		DataDir:           s.upgrader.dataDir,
+		LogDir:            "/var/log/juju",
+		Tag:               names.NewUnitTag("mysql/0"),
+		Password:          "sekrit",
+		Nonce:             "nonce",
+		Environment:       names.NewEnvironTag(testEnvironUUID),
+		StateAddresses:    []string{"10.0.0.9:37017"},
+		APIAddresses:      []string{"10.0.0.9:17070"},
+		CACert:            "old-ca-cert",
+		UpgradedToVersion: version1.MustParse("1.25.13"),
+		Values:            map[string]string{"PROVIDER_TYPE": "maas"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(config.Write(), jc.ErrorIsNil)
+	err = os.Symlink(
+		filepath.Join(s.upgrader.toolsDir(), "1.25.13-trusty-amd64"),
+		filepath.Join(s.upgrader.toolsDir(), "unit-mysql-0"),
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	servicePath := filepath.Join(s.upgrader.initDir(), "jujud-unit-mysql-0", "jujud-unit-mysql-0.service")
+	c.Assert(ioutil.WriteFile(servicePath, []byte("[Unit]\n"), 0644), jc.ErrorIsNil)
+	err = os.Symlink(servicePath, filepath.Join(s.upgrader.systemdDir, "jujud-unit-mysql-0.service"))
+	c.Assert(err, jc.ErrorIsNil)
+
+	// The files copied over by upgrade-agents.
+	writeTestTools(c, filepath.Join(s.upgrader.upgradeDir, "2.2.4-trusty-amd64.tgz"))
+	data, err := json.Marshal(agentUpgradeConfig{
+		ControllerTag: "controller-" + testEnvironUUID,
+		CACert:        "new-ca-cert",
+		APIAddresses:  []string{"10.0.0.1:17070"},
+		Version:       "2.2.4",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	err = ioutil.WriteFile(filepath.Join(s.upgrader.upgradeDir, agentUpgradeConfigFile), data, 0644)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func writeTestTools(c *gc.C, toolsPath string) {
+	f, err := os.Create(toolsPath)
+	c.Assert(err, jc.ErrorIsNil)
+	defer f.Close()
+	gzw := gzip.NewWriter(f)
+	defer gzw.Close()
+	tw := tar.NewWriter(gzw)
+	defer tw.Close()
+	content := []byte("#!/bin/sh\n")
+	err = tw.WriteHeader(&tar.Header{
+		Name:     "jujud",
+		Mode:     0755,
+		Size:     int64(len(content)),
+		Typeflag: tar.TypeReg,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = tw.Write(content)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *localAgentUpgraderSuite) toolsLink(c *gc.C) string {
+	target, err := os.Readlink(filepath.Join(s.upgrader.toolsDir(), "unit-mysql-0"))
+	c.Assert(err, jc.ErrorIsNil)
+	return target
+}
+
+func (s *localAgentUpgraderSuite) TestUpgrade(c *gc.C) {
+	err := s.upgrader.upgrade()
+	c.Assert(err, jc.ErrorIsNil)
+
+	newTools := filepath.Join(s.upgrader.toolsDir(), "2.2.4-trusty-amd64")
+	c.Assert(s.toolsLink(c), gc.Equals, newTools)
+	target, err := os.Readlink(filepath.Join(newTools, "relation-get"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(target, gc.Equals, filepath.Join(newTools, "jujud"))
+
+	config, err := agent2.ReadConfig(agentConfigPath(s.upgrader.dataDir, "unit-mysql-0"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(config.Model().Id(), gc.Equals, testEnvironUUID)
+	c.Assert(config.Controller().Id(), gc.Equals, testEnvironUUID)
+	c.Assert(config.CACert(), gc.Equals, "new-ca-cert")
+	c.Assert(config.UpgradedToVersion().String(), gc.Equals, "2.2.4")
+	c.Assert(config.OldPassword(), gc.Equals, "sekrit")
+	c.Assert(config.Value("PROVIDER_TYPE"), gc.Equals, "maas")
+	addrs, err := config.APIAddresses()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(addrs, jc.DeepEquals, []string{"10.0.0.1:17070"})
+}
+
+func (s *localAgentUpgraderSuite) TestUpgradeRefusesWithRollbackInfo(c *gc.C) {
+	c.Assert(os.MkdirAll(s.upgrader.rollbackDir(), 0755), jc.ErrorIsNil)
+	err := s.upgrader.upgrade()
+	c.Assert(err, gc.ErrorMatches, "saved rollback information found - aborting")
+}
+
+func (s *localAgentUpgraderSuite) TestRollback(c *gc.C) {
+	configPath := agentConfigPath(s.upgrader.dataDir, "unit-mysql-0")
+	original, err := ioutil.ReadFile(configPath)
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Assert(s.upgrader.upgrade(), jc.ErrorIsNil)
+	c.Assert(s.upgrader.rollback(), jc.ErrorIsNil)
+
+	c.Assert(s.toolsLink(c), gc.Equals, filepath.Join(s.upgrader.toolsDir(), "1.25.13-trusty-amd64"))
+	restored, err := ioutil.ReadFile(configPath)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(restored), gc.Equals, string(original))
+	_, err = os.Stat(filepath.Join(s.upgrader.toolsDir(), "2.2.4-trusty-amd64"))
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+	_, err = os.Stat(s.upgrader.rollbackDir())
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+}
+
+func (s *localAgentUpgraderSuite) TestRollbackWithoutUpgrade(c *gc.C) {
+	err := s.upgrader.rollback()
+	c.Assert(err, gc.ErrorMatches, "no rollback information found")
+}
+
+func (*localAgentUpgraderSuite) TestConvertLXCAgent(c *gc.C) {
+	match, agent := convertLXCAgent("machine-1-lxc-2")
+	c.Assert(match, jc.IsTrue)
+	c.Assert(agent, gc.Equals, "machine-1-lxd-2")
+	match, agent = convertLXCAgent("machine-3")
+	c.Assert(match, jc.IsFalse)
+	c.Assert(agent, gc.Equals, "machine-3")
+}
@@ -0,0 +1,241 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+	"github.com/juju/utils/arch"
+	"github.com/juju/utils/ssh"
+	"github.com/juju/version"
+	"github.com/kardianos/osext"
+
+	version1 "github.com/juju/1.25-upgrade/juju1/version"
+	coretools "github.com/juju/1.25-upgrade/juju2/tools"
+)
+
+// agentUpgrader knows how to upgrade the agents on machines running a
+// particular operating system, and how to roll the upgrade back.
+type agentUpgrader interface {
+	// options returns any extra options needed to run scripts on
+	// the machine.
+	options() []execOption
+
+	// hostFiles returns the files to copy to the machine's host
+	// once, if it's a container, to be pushed into the containers
+	// on the host from there by pushFiles.
+	hostFiles(machine FlatMachine, tools *coretools.Tools) ([]hostFile, error)
+
+	// pushFiles copies the new tools and anything else needed by
+	// the upgrade script onto the machine.
+	pushFiles(machine FlatMachine, tools *coretools.Tools, config *scriptConfig) error
+
+	// upgradeScript returns the script that installs the new tools
+	// and rewrites the agent configs.
+	upgradeScript() string
+
+	// rollbackScript returns the script that undoes the changes
+	// made by the upgrade script.
+	rollbackScript() string
+
+	// connectionCheckScript returns the script that checks that each
+	// agent on the machine can connect to the target controller.
+	connectionCheckScript() string
+}
+
+// pluginOS is the operating system the plugin is built for. It's a
+// variable so tests can change it.
+var pluginOS = runtime.GOOS
+
+// newAgentUpgrader returns the agentUpgrader for the machine. The
+// same unixAgentUpgrader is used for all of the Ubuntu and CentOS
+// machines.
+func newAgentUpgrader(machine FlatMachine, unix *unixAgentUpgrader) (agentUpgrader, error) {
+	series := machine.Series
+	osType, err := version1.GetOSFromSeries(series)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	switch osType {
+	case version1.Ubuntu, version1.CentOS:
+		// The plugin itself is copied to the machine and run
+		// there, so it has to be built for Linux and the machine's
+		// architecture. In client-driven mode it's the operator's
+		// own binary, which needn't be.
+		if pluginOS != "linux" {
+			return nil, errors.Errorf("the plugin is built for %s, so it can't be run on the machine; run upgrade-agents with a Linux build of the plugin", pluginOS)
+		}
+		if got := machineArch(machine); got != "" && got != arch.HostArch() {
+			return nil, errors.Errorf("machine architecture %s doesn't match the plugin's (%s)", got, arch.HostArch())
+		}
+		return unix, nil
+	case version1.Windows:
+		return &windowsAgentUpgrader{}, nil
+	}
+	return nil, errors.NotSupportedf("upgrading agents on %s (series %q)", osType, series)
+}
+
+// machineAgentUpgraders returns the agentUpgrader for each of the
+// machines, in the same order.
+func machineAgentUpgraders(machines []FlatMachine) ([]agentUpgrader, error) {
+	plugin, err := osext.Executable()
+	if err != nil {
+		return nil, errors.Annotate(err, "finding plugin location")
+	}
+	unix := &unixAgentUpgrader{plugin: plugin}
+	upgraders := make([]agentUpgrader, len(machines))
+	for i, machine := range machines {
+		upgrader, err := newAgentUpgrader(machine, unix)
+		if err != nil {
+			return nil, errors.Annotatef(err, "machine %s", machine.ID)
+		}
+		upgraders[i] = upgrader
+	}
+	return upgraders, nil
+}
+
+// machineArch returns the machine's hardware architecture, falling back
+// to the architecture of its agent tools for machines saved without it.
+// It returns "" if neither is known.
+func machineArch(machine FlatMachine) string {
+	if machine.Arch != "" {
+		return machine.Arch
+	}
+	if machine.Tools == "" {
+		return ""
+	}
+	binary, err := version.ParseBinary(machine.Tools)
+	if err != nil {
+		logger.Warningf("parsing tools version %q of machine %s: %v", machine.Tools, machine.ID, err)
+		return ""
+	}
+	return binary.Arch
+}
+
+// agentUpgradeExec runs the script chosen by getScript from each
+// machine's agentUpgrader on the machines, reporting progress under
+// the given phase name.
+func agentUpgradeExec(phase string, machines []FlatMachine, upgraders []agentUpgrader, getScript func(agentUpgrader) string) ([]execResult, error) {
+	targets := flatMachineExecTargets(machines...)
+	scripts := make([]string, len(machines))
+	for i, upgrader := range upgraders {
+		targets[i].options = upgrader.options()
+		scripts[i] = getScript(upgrader)
+	}
+	return parallelExecScripts(phase, targets, scripts)
+}
+
+const upgradeDir = "1.25-agent-upgrade"
+
+// unixAgentUpgrader upgrades agents on Ubuntu and CentOS machines by
+// copying the plugin to them and running agent-upgrade-local.
+type unixAgentUpgrader struct {
+	// plugin is the path of the plugin binary on this machine.
+	plugin string
+
+	// sharedFiles holds the plugin and the upgrade config as host
+	// files, read once by sharedHostFiles along with any error.
+	sharedOnce  sync.Once
+	sharedFiles []hostFile
+	sharedErr   error
+}
+
+// sharedHostFiles returns the files that are the same for every
+// container: the plugin and the upgrade config.
+func (u *unixAgentUpgrader) sharedHostFiles() ([]hostFile, error) {
+	u.sharedOnce.Do(func() {
+		for _, filePath := range []string{u.plugin, path.Join(toolsDir, agentUpgradeConfigFile)} {
+			file, err := newHostFile(filePath)
+			if err != nil {
+				u.sharedErr = errors.Trace(err)
+				return
+			}
+			u.sharedFiles = append(u.sharedFiles, file)
+		}
+	})
+	return u.sharedFiles, u.sharedErr
+}
+
+// hostFiles is part of agentUpgrader. The plugin, upgrade config and
+// tools are pushed into LXD containers from their hosts, since the
+// plugin in particular is too big to copy to each container.
+func (u *unixAgentUpgrader) hostFiles(machine FlatMachine, tools *coretools.Tools) ([]hostFile, error) {
+	if _, isLXD := lxdContainerName(machine); !isLXD {
+		return nil, nil
+	}
+	shared, err := u.sharedHostFiles()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	files := append([]hostFile{}, shared...)
+	return append(files, toolsHostFile(tools)), nil
+}
+
+func (u *unixAgentUpgrader) options() []execOption {
+	return nil
+}
+
+func (u *unixAgentUpgrader) pushFiles(machine FlatMachine, tools *coretools.Tools, config *scriptConfig) error {
+	sshOptions := []execOption{withSystemIdentity()}
+	throttleAddr := machine.Address
+	if machine.HostAddress != "" {
+		throttleAddr = machine.HostAddress
+		sshOptions = append(sshOptions, withProxyCommandForHost(machine.HostAddress))
+	}
+
+	logger.Debugf("making target dir for machine %s", machine.ID)
+	rc, err := runViaSSH(
+		machine.Address,
+		fmt.Sprintf("rm -rf %[1]s; mkdir %[1]s; chown %[2]s: %[1]s", upgradeDir, machineSSH.User),
+		sshOptions...,
+	)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if rc != 0 {
+		return &cmd.RcPassthroughError{Code: rc}
+	}
+	// LXD containers get the files from the copies distributed to
+	// their host, rather than each fetching them from here.
+	if containerName, isLXD := lxdContainerName(machine); isLXD {
+		files, err := u.hostFiles(machine, tools)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return errors.Trace(pushFilesFromHost(machine, containerName, files))
+	}
+	files := []string{
+		u.plugin,
+		path.Join(toolsDir, agentUpgradeConfigFile),
+		toolsFilePath(tools.Version.Number, seriesArch(machine)),
+	}
+	options := copyOptions(machine.Address, machine.HostAddress)
+	logger.Debugf("copying %s to machine %s", strings.Join(files, ", "), machine.ID)
+	args := append(files, fmt.Sprintf("%s@%s:~/%s/", machineSSH.User, machine.Address, upgradeDir))
+
+	throttleAddr = throttleAddress(throttleAddr)
+	throttler.Acquire(throttleAddr)
+	err = ssh.Copy(args, options)
+	throttler.Release(throttleAddr)
+	return errors.Trace(err)
+}
+
+func (u *unixAgentUpgrader) upgradeScript() string {
+	return fmt.Sprintf("~/%s/%s agent-upgrade-local", upgradeDir, filepath.Base(u.plugin))
+}
+
+func (u *unixAgentUpgrader) rollbackScript() string {
+	return fmt.Sprintf("~/%s/%s agent-upgrade-local --rollback", upgradeDir, filepath.Base(u.plugin))
+}
+
+func (u *unixAgentUpgrader) connectionCheckScript() string {
+	return connectionCheckScript
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils/arch"
+	gc "gopkg.in/check.v1"
+)
+
+type agentUpgraderSuite struct {
+	testing.CleanupSuite
+}
+
+var _ = gc.Suite(&agentUpgraderSuite{})
+
+func otherArch() string {
+	if arch.HostArch() == arch.PPC64EL {
+		return arch.AMD64
+	}
+	return arch.PPC64EL
+}
+
+func (*agentUpgraderSuite) TestMachineArch(c *gc.C) {
+	c.Assert(machineArch(FlatMachine{Arch: "arm64", Tools: "1.25.13-trusty-amd64"}), gc.Equals, "arm64")
+	c.Assert(machineArch(FlatMachine{Tools: "1.25.13-trusty-s390x"}), gc.Equals, "s390x")
+	c.Assert(machineArch(FlatMachine{}), gc.Equals, "")
+}
+
+func (*agentUpgraderSuite) TestArchMismatch(c *gc.C) {
+	_, err := machineAgentUpgraders([]FlatMachine{
+		{ID: "0", Series: "xenial", Arch: arch.HostArch()},
+		{ID: "1", Series: "xenial", Arch: otherArch()},
+	})
+	c.Assert(err, gc.ErrorMatches, `machine 1: machine architecture .* doesn't match the plugin's \(.*\)`)
+}
+
+func (s *agentUpgraderSuite) TestPluginNotBuiltForLinux(c *gc.C) {
+	s.PatchValue(&pluginOS, "darwin")
+	_, err := machineAgentUpgraders([]FlatMachine{
+		{ID: "0", Series: "xenial", Arch: arch.HostArch()},
+	})
+	c.Assert(err, gc.ErrorMatches, `machine 0: the plugin is built for darwin, so it can't be run on the machine; .*`)
+
+	upgraders, err := machineAgentUpgraders([]FlatMachine{
+		{ID: "0", Series: "win2012r2"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(upgraders[0], gc.FitsTypeOf, &windowsAgentUpgrader{})
+}
+
+func (*agentUpgraderSuite) TestWindowsIgnoresArch(c *gc.C) {
+	upgraders, err := machineAgentUpgraders([]FlatMachine{
+		{ID: "0", Series: "win2012r2", Arch: otherArch()},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(upgraders[0], gc.FitsTypeOf, &windowsAgentUpgrader{})
+}
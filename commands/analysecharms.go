@@ -0,0 +1,283 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+	"github.com/juju/utils/set"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+	"github.com/juju/1.25-upgrade/juju1/state/storage"
+	jujuc1 "github.com/juju/1.25-upgrade/juju1/worker/uniter/runner/jujuc"
+	jujuc2 "github.com/juju/1.25-upgrade/juju2/worker/uniter/runner/jujuc"
+)
+
+var analyseCharmsDoc = `
+The analyse-charms command checks the charms deployed in a 1.25
+environment for things that are likely to break once the environment
+has been upgraded to Juju 2.x.
+
+Every charm archive is read from the environment's storage and its
+files are scanned for:
+ - hook tools that Juju 2.x doesn't provide
+ - environment variables that Juju 2.x doesn't set, such as
+   JUJU_ENV_UUID (now JUJU_MODEL_UUID)
+ - unit-get of addresses, which may return different addresses under
+   Juju 2.x; network-get is preferred
+ - relation-get in relation-departed hooks, which may not be able to
+   see the departed unit's settings
+ - metadata that Juju 2.x can't read
+
+The checks are static, so they can report problems in code that never
+runs; each finding should be reviewed rather than treated as certain.
+
+`
+
+func newAnalyseCharmsCommand() cmd.Command {
+	command := &analyseCharmsCommand{}
+	command.remoteCommand = "analyse-charms-impl"
+	return wrap(command)
+}
+
+type analyseCharmsCommand struct {
+	baseClientCommand
+}
+
+func (c *analyseCharmsCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "analyse-charms",
+		Args:    "<environment name>",
+		Purpose: "report charms that may not work with Juju 2.x",
+		Doc:     analyseCharmsDoc,
+	}
+}
+
+func (c *analyseCharmsCommand) Init(args []string) error {
+	args, err := c.baseClientCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return cmd.CheckEmpty(args)
+}
+
+var analyseCharmsImplDoc = `
+
+analyse-charms-impl must be executed on an API server machine of a
+1.25 environment.
+
+The command will read each deployed charm from storage and report
+anything likely to break under Juju 2.x.
+
+`
+
+func newAnalyseCharmsImplCommand() cmd.Command {
+	return &analyseCharmsImplCommand{}
+}
+
+type analyseCharmsImplCommand struct {
+	baseRemoteCommand
+}
+
+func (c *analyseCharmsImplCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "analyse-charms-impl",
+		Purpose: "controller-side command for the analyse-charms command",
+		Doc:     analyseCharmsImplDoc,
+	}
+}
+
+func (c *analyseCharmsImplCommand) Run(ctx *cmd.Context) error {
+	st, err := getState()
+	if err != nil {
+		return errors.Annotate(err, "getting state")
+	}
+	defer st.Close()
+
+	services, err := st.AllServices()
+	if err != nil {
+		return errors.Annotate(err, "getting services")
+	}
+	applications := make(map[string][]string)
+	for _, service := range services {
+		curl, _ := service.CharmURL()
+		applications[curl.String()] = append(applications[curl.String()], service.Name())
+	}
+	curls := make([]string, 0, len(applications))
+	for curl := range applications {
+		curls = append(curls, curl)
+	}
+	sort.Strings(curls)
+
+	tempDir, err := ioutil.TempDir("", "1.25-upgrade-analyse")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	store := storage.NewStorage(st.EnvironUUID(), st.MongoSession())
+	removedTools := removedHookTools()
+	var flagged int
+	for i, curl := range curls {
+		issues, err := analyseCharm(st, store, curl, filepath.Join(tempDir, fmt.Sprint(i)), removedTools)
+		if err != nil {
+			issues = []string{fmt.Sprintf("couldn't analyse charm: %v", err)}
+		}
+		sort.Strings(applications[curl])
+		fmt.Fprintf(ctx.Stdout, "%s (%s):", curl, strings.Join(applications[curl], ", "))
+		if len(issues) == 0 {
+			fmt.Fprintf(ctx.Stdout, " no problems found\n")
+			continue
+		}
+		flagged++
+		fmt.Fprintf(ctx.Stdout, "\n")
+		for _, issue := range issues {
+			fmt.Fprintf(ctx.Stdout, "  %s\n", issue)
+		}
+	}
+	fmt.Fprintf(ctx.Stdout, "%d of %d charms may need changes to work with Juju 2.x\n", flagged, len(curls))
+	return nil
+}
+
+func analyseCharm(st *state.State, store storage.Storage, curl, archivePath string, removedTools []string) ([]string, error) {
+	ch, err := getCharm(st, curl)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := copyCharmArchive(store, ch, archivePath); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return analyseCharmArchive(archivePath, removedTools)
+}
+
+// removedHookTools returns the names of the hook tools that 1.25
+// provides but Juju 2.x doesn't.
+func removedHookTools() []string {
+	removed := set.NewStrings(jujuc1.CommandNames()...).Difference(set.NewStrings(jujuc2.CommandNames()...))
+	return removed.SortedValues()
+}
+
+// removedHookEnvVars maps the hook environment variables that 1.25
+// sets but Juju 2.x doesn't to their replacements.
+var removedHookEnvVars = map[string]string{
+	"JUJU_ENV_NAME": "JUJU_MODEL_NAME",
+	"JUJU_ENV_UUID": "JUJU_MODEL_UUID",
+}
+
+var (
+	unitGetAddressRe = regexp.MustCompile(`unit[-_]get\W+(?:--format\S*\s+\S+\s+)?(private|public)-address`)
+	relationGetRe    = regexp.MustCompile(`relation[-_]get\b`)
+	departedHookRe   = regexp.MustCompile(`^hooks/[^/]+-relation-departed$`)
+)
+
+// maxAnalysedFileSize is the largest file in a charm that's scanned;
+// anything bigger is assumed not to be a script.
+const maxAnalysedFileSize = 1 << 20
+
+// analyseCharmArchive statically checks the files in the charm archive
+// for things that are likely to break under Juju 2.x, returning a
+// description of each.
+func analyseCharmArchive(archivePath string, removedTools []string) ([]string, error) {
+	var issues []string
+	_, changes, err := fixCharmArchive(archivePath)
+	if err != nil {
+		issues = append(issues, fmt.Sprintf("metadata.yaml: Juju 2.x can't read the charm: %v", err))
+	}
+	for _, change := range changes {
+		issues = append(issues, fmt.Sprintf("metadata.yaml: %s (import fixes this)", change))
+	}
+
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer reader.Close()
+
+	files := make(map[string]*zip.File)
+	for _, f := range reader.File {
+		files[path.Clean(f.Name)] = f
+	}
+	toolRes := make([]*regexp.Regexp, len(removedTools))
+	for i, tool := range removedTools {
+		toolRes[i] = regexp.MustCompile(`(^|[^\w-])` + regexp.QuoteMeta(tool) + `($|[^\w-])`)
+	}
+
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() || f.UncompressedSize64 > maxAnalysedFileSize {
+			continue
+		}
+		content, err := readZipFile(f)
+		if err != nil {
+			return nil, errors.Annotatef(err, "reading %s", f.Name)
+		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			// Hooks are often symlinks to one script, which
+			// is scanned in its own right, but departed hooks
+			// need to be checked against the script.
+			target := files[path.Join(path.Dir(f.Name), string(content))]
+			if !departedHookRe.MatchString(f.Name) || target == nil {
+				continue
+			}
+			if content, err = readZipFile(target); err != nil {
+				return nil, errors.Annotatef(err, "reading %s", target.Name)
+			}
+			issues = append(issues, analyseDepartedHook(f.Name, content)...)
+			continue
+		}
+		if bytes.IndexByte(content, 0) >= 0 {
+			// Binary file.
+			continue
+		}
+		issues = append(issues, analyseCharmFile(f.Name, content, removedTools, toolRes)...)
+	}
+	return issues, nil
+}
+
+func analyseCharmFile(name string, content []byte, removedTools []string, toolRes []*regexp.Regexp) []string {
+	var issues []string
+	for i, tool := range removedTools {
+		if toolRes[i].Match(content) {
+			issues = append(issues, fmt.Sprintf("%s: uses hook tool %s, which Juju 2.x doesn't provide", name, tool))
+		}
+	}
+	if match := unitGetAddressRe.FindSubmatch(content); match != nil {
+		issues = append(issues, fmt.Sprintf(
+			"%s: unit-get %s-address may return a different address under Juju 2.x; consider network-get",
+			name, match[1]))
+	}
+	vars := make([]string, 0, len(removedHookEnvVars))
+	for envVar := range removedHookEnvVars {
+		vars = append(vars, envVar)
+	}
+	sort.Strings(vars)
+	for _, envVar := range vars {
+		if bytes.Contains(content, []byte(envVar)) {
+			issues = append(issues, fmt.Sprintf(
+				"%s: uses %s, which Juju 2.x replaces with %s", name, envVar, removedHookEnvVars[envVar]))
+		}
+	}
+	if departedHookRe.MatchString(name) {
+		issues = append(issues, analyseDepartedHook(name, content)...)
+	}
+	return issues
+}
+
+func analyseDepartedHook(name string, content []byte) []string {
+	if !relationGetRe.Match(content) {
+		return nil
+	}
+	return []string{fmt.Sprintf(
+		"%s: relation-get in a relation-departed hook may not see the departed unit's settings", name)}
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type analyseCharmsSuite struct{}
+
+var _ = gc.Suite(&analyseCharmsSuite{})
+
+const analyseMetadata = `
+name: wordpress
+summary: blog
+description: blog
+requires:
+  db:
+    interface: mysql
+`
+
+const analyseHooks = `#!/usr/bin/env python
+import os
+from charmhelpers.core import hookenv
+model = os.environ["JUJU_ENV_UUID"]
+address = hookenv.unit_get('private-address')
+settings = hookenv.relation_get()
+`
+
+func writeTestCharm(c *gc.C, path string) {
+	f, err := os.Create(path)
+	c.Assert(err, jc.ErrorIsNil)
+	defer f.Close()
+	w := zip.NewWriter(f)
+	add := func(name, content string, mode os.FileMode) {
+		header := &zip.FileHeader{Name: name}
+		header.SetMode(mode)
+		fw, err := w.CreateHeader(header)
+		c.Assert(err, jc.ErrorIsNil)
+		_, err = fw.Write([]byte(content))
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	add("metadata.yaml", analyseMetadata, 0644)
+	add("hooks/hooks.py", analyseHooks, 0755)
+	add("hooks/db-relation-departed", "hooks.py", os.ModeSymlink|0777)
+	add("hooks/old-tool", "#!/bin/sh\nservice-get foo\n", 0755)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+}
+
+func (*analyseCharmsSuite) TestAnalyseCharmArchive(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "wordpress.charm")
+	writeTestCharm(c, path)
+
+	issues, err := analyseCharmArchive(path, []string{"service-get"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(issues, jc.DeepEquals, []string{
+		"hooks/hooks.py: unit-get private-address may return a different address under Juju 2.x; consider network-get",
+		"hooks/hooks.py: uses JUJU_ENV_UUID, which Juju 2.x replaces with JUJU_MODEL_UUID",
+		"hooks/db-relation-departed: relation-get in a relation-departed hook may not see the departed unit's settings",
+		"hooks/old-tool: uses hook tool service-get, which Juju 2.x doesn't provide",
+	})
+}
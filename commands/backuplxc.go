@@ -101,8 +101,7 @@ func (c *backupLXCCommand) Run(ctx *cmd.Context) error {
 		if err != nil {
 			return errors.Annotate(err, "creating output file")
 		}
-		rc, err := runViaSSH(
-			c.address,
+		rc, err := c.runRemoteCommand(
 			c.getRemoteCommand(c.remoteCommand, containerName),
 			withStdout(f),
 		)
@@ -144,8 +143,7 @@ func (c *backupLXCCommand) Run(ctx *cmd.Context) error {
 func getLXCContainerList(c *baseClientCommand) ([]lxcContainer, error) {
 	// Get a listing of all of the LXC containers in the environment.
 	var buf bytes.Buffer
-	rc, err := runViaSSH(
-		c.address,
+	rc, err := c.runRemoteCommand(
 		c.getRemoteCommand(c.remoteCommand),
 		withStdout(&buf),
 	)
@@ -202,6 +200,10 @@ func (c *backupLXCImplCommand) Info() *cmd.Info {
 }
 
 func (c *backupLXCImplCommand) Init(args []string) error {
+	args, err := c.baseRemoteCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
 	if len(args) > 0 {
 		c.containerName, args = args[0], args[1:]
 	}
@@ -214,6 +216,9 @@ func (c *backupLXCImplCommand) Run(ctx *cmd.Context) error {
 		return errors.Annotate(err, "getting state")
 	}
 	defer st.Close()
+	if err := addressSelection.loadSpaces(st); err != nil {
+		return errors.Annotate(err, "loading address policy")
+	}
 
 	if c.containerName == "" {
 		// Output a listing of LXC containers.
@@ -7,13 +7,17 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"gopkg.in/macaroon-bakery.v1/httpbakery"
 
 	"github.com/juju/cmd"
 	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/utils"
 	"github.com/kardianos/osext"
 
 	"github.com/juju/1.25-upgrade/juju1/environs/configstore"
@@ -40,11 +44,41 @@ type baseClientCommand struct {
 	remoteArgs    string
 
 	extraOptions []string
+
+	// logDir is the local directory that the logs of each machine's
+	// output are copied back to.
+	logDir string
+
+	// clientDriven is set to run the remote command on this machine,
+	// reaching the environment through the API server machine,
+	// rather than copying the plugin there.
+	clientDriven bool
+
+	// sshHome is the home directory of the SSH user on the API
+	// server machine, if it's not the usual one.
+	sshHome string
+}
+
+// remoteLogsDir is where the logs of each machine's output are kept
+// on the API server machine, relative to the SSH user's home.
+const remoteLogsDir = "1.25-upgrade-logs"
+
+// SetFlags is part of cmd.Command.
+func (c *baseClientCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.ControllerCommandBase.SetFlags(f)
+	f.StringVar(&c.logDir, "log-dir", "", "Copy a log of each machine's output to this directory")
+	f.BoolVar(&c.clientDriven, "client-driven", false, "Run from this machine through an SSH tunnel, rather than from a copy of the plugin on the API server machine")
+	f.StringVar(&c.sshHome, "ssh-home", "", "Home directory of the SSH user on the API server machine (default /home/<user>)")
+	setSSHFlags(f)
+	setAddressFlags(f)
 }
 
 // Init will grab the first arg as the environment name.
 // Validation of the name is also done here.
 func (c *baseClientCommand) init(args []string) ([]string, error) {
+	if err := addressSelection.validate(); err != nil {
+		return args, errors.Trace(err)
+	}
 	// Make sure we can work out our own location.
 	if plugin, err := osext.Executable(); err != nil {
 		return args, errors.Annotate(err, "finding plugin location")
@@ -151,36 +185,67 @@ func (c *baseClientCommand) loadInfo() error {
 
 	c.info = info
 
-	// Grab the first address
-	addresses := info.APIEndpoint().Addresses
-	address := addresses[0]
-	c.address = address[:strings.LastIndex(address, ":")]
+	// Use the first address allowed by the address policy.
+	address, err := addressSelection.apiAddress(info.APIEndpoint().Addresses)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	c.address = address
 
 	return nil
 }
 
 func (c *baseClientCommand) getRemoteCommand(cmd string, args ...string) string {
-	pluginBase := filepath.Base(c.plugin)
+	plugin := "./" + filepath.Base(c.plugin)
+	options := append(sshFlagArgs(), addressFlagArgs()...)
+	options = append(options, c.extraOptions...)
+	if c.clientDriven {
+		plugin = utils.ShQuote(c.plugin)
+		options = append([]string{"--via", c.address}, options...)
+	} else if home := c.remoteHome(); home != homeDir(defaultSSHUser) {
+		options = append(options, "--home", utils.ShQuote(home))
+	}
 	debug := ""
 	if logger.IsDebugEnabled() {
 		debug = "--debug"
 	}
 	return fmt.Sprintf(
-		"./%s %s %s %s %s\n",
-		pluginBase,
+		"%s %s %s %s %s\n",
+		plugin,
 		cmd,
 		debug,
-		strings.Join(c.extraOptions, " "),
+		strings.Join(options, " "),
 		strings.Join(args, " "),
 	)
 }
 
+// remoteHome returns the home directory of the SSH user on the API
+// server machine.
+func (c *baseClientCommand) remoteHome() string {
+	if c.sshHome != "" {
+		return c.sshHome
+	}
+	return homeDir(apiServerSSH.User)
+}
+
+// runRemoteCommand runs a command from getRemoteCommand on the API
+// server machine, or on this machine in client-driven mode.
+func (c *baseClientCommand) runRemoteCommand(command string, opts ...execOption) (int, error) {
+	if c.clientDriven {
+		return runLocally(command, opts...)
+	}
+	return runViaSSH(c.address, command, append([]execOption{withAPIServer()}, opts...)...)
+}
+
 func (c *baseClientCommand) prepareRemote(ctx *cmd.Context) error {
 	if c.needsController {
 		if err := c.setRemoteControllerInfo(); err != nil {
 			return errors.Trace(err)
 		}
 	}
+	if c.clientDriven {
+		return nil
+	}
 	if err := checkUpdatePlugin(ctx, c.plugin, c.address); err != nil {
 		return errors.Annotate(err, "checking remote plugin")
 	}
@@ -191,9 +256,32 @@ func (c *baseClientCommand) Run(ctx *cmd.Context) error {
 	if err := c.prepareRemote(ctx); err != nil {
 		return errors.Trace(err)
 	}
+	c.extraOptions = append(c.extraOptions, "--progress")
+	if c.logDir != "" {
+		logDirName := fmt.Sprintf("%s-%s", c.remoteCommand, time.Now().UTC().Format("20060102-150405"))
+		if c.clientDriven {
+			// The logs are written here, so there's nothing to fetch.
+			logDir := filepath.Join(c.logDir, logDirName)
+			c.extraOptions = append(c.extraOptions, "--log-dir", utils.ShQuote(logDir))
+		} else {
+			remoteLogDir := path.Join(remoteLogsDir, logDirName)
+			c.extraOptions = append(c.extraOptions, "--log-dir", remoteLogDir)
+			// Fetch the logs even if the command fails; that's when
+			// they're most needed.
+			defer func() {
+				if err := fetchRemoteLogs(ctx, c.address, remoteLogDir, c.logDir); err != nil {
+					logger.Warningf("couldn't copy machine logs: %v", err)
+				}
+			}()
+		}
+	}
 	remoteCommand := c.getRemoteCommand(c.remoteCommand, c.remoteArgs)
 	logger.Debugf("running remote command: %q", remoteCommand)
-	rc, err := runViaSSH(c.address, remoteCommand)
+	stderr := newProgressWriter(ctx.GetStderr())
+	rc, err := c.runRemoteCommand(remoteCommand, withStderr(stderr))
+	if flushErr := stderr.Flush(); flushErr != nil {
+		logger.Warningf("writing remote output: %v", flushErr)
+	}
 	if err != nil {
 		return errors.Annotatef(err, "running %s via SSH", c.remoteCommand)
 	}
@@ -0,0 +1,39 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	gc "gopkg.in/check.v1"
+)
+
+type baseClientSuite struct{}
+
+var _ = gc.Suite(&baseClientSuite{})
+
+func (*baseClientSuite) TearDownTest(c *gc.C) {
+	apiServerSSH.User = defaultSSHUser
+}
+
+func (*baseClientSuite) TestRemoteCommand(c *gc.C) {
+	command := baseClientCommand{
+		plugin:       "/home/me/bin/juju-1.25-upgrade",
+		address:      "10.0.0.1",
+		extraOptions: []string{"--progress"},
+	}
+	c.Assert(command.getRemoteCommand("agent-status-impl", "arg"), gc.Equals,
+		"./juju-1.25-upgrade agent-status-impl  --progress arg\n")
+	command.clientDriven = true
+	c.Assert(command.getRemoteCommand("agent-status-impl", "arg"), gc.Equals,
+		"'/home/me/bin/juju-1.25-upgrade' agent-status-impl  --via 10.0.0.1 --progress arg\n")
+}
+
+func (*baseClientSuite) TestRemoteCommandForUser(c *gc.C) {
+	apiServerSSH.User = "admin"
+	command := baseClientCommand{plugin: "/home/me/bin/juju-1.25-upgrade"}
+	c.Assert(command.getRemoteCommand("agent-status-impl"), gc.Equals,
+		"./juju-1.25-upgrade agent-status-impl  --ssh-user 'admin' --home '/home/admin' \n")
+	command.sshHome = "/srv/admin"
+	c.Assert(command.getRemoteCommand("agent-status-impl"), gc.Equals,
+		"./juju-1.25-upgrade agent-status-impl  --ssh-user 'admin' --home '/srv/admin' \n")
+}
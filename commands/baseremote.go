@@ -6,13 +6,16 @@ package commands
 import (
 	"encoding/base64"
 	"encoding/json"
+	"path"
 
 	"gopkg.in/macaroon.v1"
 
 	"github.com/juju/cmd"
 	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
 	"github.com/juju/names"
 
+	"github.com/juju/1.25-upgrade/juju1/agent"
 	"github.com/juju/1.25-upgrade/juju1/environs"
 	"github.com/juju/1.25-upgrade/juju1/mongo"
 	"github.com/juju/1.25-upgrade/juju1/state"
@@ -38,7 +41,42 @@ type Info struct {
 	Macaroons   []macaroon.Slice
 }
 
+// SetFlags is part of cmd.Command. The flags are set by the client
+// command to have the progress of each phase reported back to it, to
+// keep a log of each machine's output, and to run in client-driven
+// mode.
+func (c *baseRemoteCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.CommandBase.SetFlags(f)
+	f.Var(viaFlag{}, "via", "Run on this machine, reaching the environment through the API server machine at this address")
+	f.Var(homeFlag{}, "home", "Home directory of the SSH user on the API server machine")
+	setSSHFlags(f)
+	setAddressFlags(f)
+	f.BoolVar(&reporter.progress, "progress", false, "Report the progress of each phase on stderr")
+	f.StringVar(&reporter.logDir, "log-dir", "", "Write each machine's output to its own file in this directory")
+}
+
+// homeFlag is the gnuflag.Value for --home, which moves toolsDir into
+// the home directory of a user other than ubuntu.
+type homeFlag struct{}
+
+// String is part of gnuflag.Value.
+func (homeFlag) String() string {
+	return path.Dir(toolsDir)
+}
+
+// Set is part of gnuflag.Value.
+func (homeFlag) Set(home string) error {
+	if !path.IsAbs(home) {
+		return errors.Errorf("home directory %q isn't absolute", home)
+	}
+	toolsDir = path.Join(home, toolsDirName)
+	return nil
+}
+
 func (c *baseRemoteCommand) init(args []string) ([]string, error) {
+	if err := addressSelection.validate(); err != nil {
+		return args, errors.Trace(err)
+	}
 	if c.needsController {
 		if len(args) == 0 {
 			return args, errors.Errorf("missing controller info")
@@ -76,23 +114,33 @@ func (c *baseRemoteCommand) getControllerConnection() (api.Connection, error) {
 }
 
 func getState() (*state.State, error) {
-	tag, err := getCurrentMachineTag(dataDir)
+	configPath, done, err := apiServerAgentConfigPath()
 	if err != nil {
-		return nil, errors.Annotate(err, "finding machine tag")
+		return nil, errors.Trace(err)
 	}
-
-	logger.Infof("current machine tag: %s", tag)
-
-	config, err := getConfig(tag)
+	config, err := agent.ReadConfig(configPath)
+	done()
 	if err != nil {
 		return nil, errors.Annotate(err, "loading agent config")
 	}
 
+	logger.Infof("current machine tag: %s", config.Tag())
+
 	mongoInfo, available := config.MongoInfo()
 	if !available {
 		return nil, errors.New("mongo info not available from agent config")
 	}
-	st, err := state.Open(config.Environment(), mongoInfo, mongo.DefaultDialOpts(), environs.NewStatePolicy())
+	dialOpts := mongo.DefaultDialOpts()
+	if clientDriven() {
+		mongoInfo.Addrs, err = openStateTunnel(mongoInfo.Addrs)
+		if err != nil {
+			return nil, errors.Annotate(err, "opening tunnel to state database")
+		}
+		// Only use the tunnel, rather than connecting to the
+		// replica set members it reports.
+		dialOpts.Direct = true
+	}
+	st, err := state.Open(config.Environment(), mongoInfo, dialOpts, environs.NewStatePolicy())
 	if err != nil {
 		return nil, errors.Annotate(err, "opening state connection")
 	}
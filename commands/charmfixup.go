@@ -0,0 +1,151 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/juju/errors"
+	charmv6 "gopkg.in/juju/charm.v6-unstable"
+	"gopkg.in/yaml.v2"
+)
+
+// fixCharmArchive checks that the charm archive at path can be read by
+// Juju 2.x. If it can't, it tries to fix the metadata problems that
+// 1.25 tolerated (mostly in old local charms) and writes the fixed
+// archive alongside the original. It returns the path of the archive
+// to upload and descriptions of any changes made.
+func fixCharmArchive(path string) (string, []string, error) {
+	_, readErr := charmv6.ReadCharmArchive(path)
+	if readErr == nil {
+		return path, nil, nil
+	}
+
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	defer reader.Close()
+
+	var metadata *zip.File
+	for _, f := range reader.File {
+		if f.Name == "metadata.yaml" {
+			metadata = f
+			break
+		}
+	}
+	if metadata == nil {
+		return "", nil, errors.Annotate(readErr, "reading charm")
+	}
+	data, err := readZipFile(metadata)
+	if err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	var meta map[string]interface{}
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		return "", nil, errors.Annotate(err, "parsing metadata.yaml")
+	}
+	changes := fixCharmMetadata(meta)
+	if len(changes) == 0 {
+		return "", nil, errors.Annotate(readErr, "reading charm")
+	}
+	data, err = yaml.Marshal(meta)
+	if err != nil {
+		return "", nil, errors.Trace(err)
+	}
+
+	fixedPath := path + ".fixed"
+	if err := rewriteZip(reader, fixedPath, metadata.Name, data); err != nil {
+		return "", nil, errors.Annotate(err, "writing fixed charm")
+	}
+	if _, err := charmv6.ReadCharmArchive(fixedPath); err != nil {
+		return "", nil, errors.Annotatef(readErr, "reading charm (still broken after fixing metadata: %v)", err)
+	}
+	return fixedPath, changes, nil
+}
+
+// fixCharmMetadata rewrites the parts of the charm metadata that
+// charm.v6 rejects, returning descriptions of the changes.
+func fixCharmMetadata(meta map[string]interface{}) []string {
+	var changes []string
+	if series, ok := meta["series"].(string); ok {
+		meta["series"] = []string{series}
+		changes = append(changes, fmt.Sprintf("series %q changed to a list", series))
+	}
+	if format, found := meta["format"]; found {
+		switch value := format.(type) {
+		case int:
+			if value != 1 && value != 2 {
+				delete(meta, "format")
+				changes = append(changes, fmt.Sprintf("unsupported format %d removed", value))
+			}
+		case string:
+			if number, err := strconv.Atoi(value); err == nil && (number == 1 || number == 2) {
+				meta["format"] = number
+				changes = append(changes, fmt.Sprintf("format %q changed to a number", value))
+			} else {
+				delete(meta, "format")
+				changes = append(changes, fmt.Sprintf("unsupported format %q removed", value))
+			}
+		default:
+			delete(meta, "format")
+			changes = append(changes, fmt.Sprintf("unsupported format %v removed", value))
+		}
+	}
+	return changes
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// rewriteZip copies the archive to path, replacing the contents of the
+// named file.
+func rewriteZip(reader *zip.ReadCloser, path, name string, data []byte) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer out.Close()
+	writer := zip.NewWriter(out)
+	for _, f := range reader.File {
+		header := f.FileHeader
+		w, err := writer.CreateHeader(&header)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if f.Name == name {
+			_, err = w.Write(data)
+		} else {
+			err = copyZipFile(w, f)
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(out.Close())
+}
+
+func copyZipFile(w io.Writer, f *zip.File) error {
+	r, err := f.Open()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return errors.Trace(err)
+}
@@ -0,0 +1,47 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type charmFixupSuite struct{}
+
+var _ = gc.Suite(&charmFixupSuite{})
+
+func (*charmFixupSuite) TestFixCharmMetadata(c *gc.C) {
+	meta := map[string]interface{}{
+		"name":   "wordpress",
+		"series": "precise",
+		"format": "2",
+	}
+	changes := fixCharmMetadata(meta)
+	c.Assert(changes, jc.DeepEquals, []string{
+		`series "precise" changed to a list`,
+		`format "2" changed to a number`,
+	})
+	c.Assert(meta, jc.DeepEquals, map[string]interface{}{
+		"name":   "wordpress",
+		"series": []string{"precise"},
+		"format": 2,
+	})
+}
+
+func (*charmFixupSuite) TestFixCharmMetadataUnsupportedFormat(c *gc.C) {
+	meta := map[string]interface{}{"name": "wordpress", "format": 3}
+	changes := fixCharmMetadata(meta)
+	c.Assert(changes, jc.DeepEquals, []string{"unsupported format 3 removed"})
+	c.Assert(meta, jc.DeepEquals, map[string]interface{}{"name": "wordpress"})
+}
+
+func (*charmFixupSuite) TestFixCharmMetadataUnchanged(c *gc.C) {
+	meta := map[string]interface{}{
+		"name":   "wordpress",
+		"series": []interface{}{"trusty"},
+		"format": 2,
+	}
+	c.Assert(fixCharmMetadata(meta), gc.HasLen, 0)
+}
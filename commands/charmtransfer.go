@@ -0,0 +1,204 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/juju/utils"
+	"golang.org/x/sync/errgroup"
+	charmv5 "gopkg.in/juju/charm.v5"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+	"github.com/juju/1.25-upgrade/juju1/state/storage"
+	"github.com/juju/1.25-upgrade/juju2/api/migrationtarget"
+	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+)
+
+// charmUploadConcurrency is the number of charms uploaded to the
+// target controller at once.
+const charmUploadConcurrency = 4
+
+// charmArchive is a charm archive read from the 1.25 storage, ready
+// to be uploaded.
+type charmArchive struct {
+	path    string
+	sha256  string
+	changes []string
+	err     error
+}
+
+// transferCharms uploads the charms to the imported model in the
+// target controller, skipping any that are already there with the
+// same archive SHA256. Charms with identical archives are only read
+// from storage and checked once. Every charm is attempted even if some
+// fail, and the failures are reported together.
+func transferCharms(out io.Writer, st *state.State, charms []string, targetAPI *migrationtarget.Client) error {
+	uploaded, err := targetAPI.UploadedCharms(st.EnvironUUID())
+	if params.IsCodeNotImplemented(err) {
+		logger.Warningf("target controller can't list uploaded charms, uploading all of them")
+	} else if err != nil {
+		return errors.Annotate(err, "getting charms already uploaded")
+	}
+
+	tempDir, err := ioutil.TempDir("", "1.25-upgrade-charms")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	store := storage.NewStorage(st.EnvironUUID(), st.MongoSession())
+	archivesBySHA256 := make(map[string]*charmArchive)
+	archives := make(map[string]*charmArchive)
+	var toUpload []string
+	for _, curl := range charms {
+		ch, err := getCharm(st, curl)
+		if err != nil {
+			toUpload = append(toUpload, curl)
+			archives[curl] = &charmArchive{err: err}
+			continue
+		}
+		uploadedSHA256, isUploaded := uploaded[curl]
+		if isUploaded && uploadedSHA256 == ch.BundleSha256() {
+			fmt.Fprintf(out, "charm %s already uploaded\n", curl)
+			continue
+		}
+		archive, found := archivesBySHA256[ch.BundleSha256()]
+		if !found {
+			archive = readCharmArchive(store, ch, filepath.Join(tempDir, ch.BundleSha256()))
+			archivesBySHA256[ch.BundleSha256()] = archive
+		}
+		archives[curl] = archive
+		if isUploaded && archive.err == nil {
+			if uploadedSHA256 == archive.sha256 {
+				fmt.Fprintf(out, "charm %s already uploaded\n", curl)
+				continue
+			}
+			// The target won't replace a charm that's already
+			// been uploaded, so there's no point sending it again.
+			archives[curl] = &charmArchive{err: errors.Errorf(
+				"target already has a different archive (SHA256 %s, expected %s)",
+				uploadedSHA256, archive.sha256,
+			)}
+		}
+		toUpload = append(toUpload, curl)
+	}
+
+	var mu sync.Mutex
+	var done int
+	var failed []string
+	report := func(curl string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		done++
+		if err != nil {
+			logger.Errorf("uploading charm %q: %v", curl, err)
+			failed = append(failed, curl)
+			fmt.Fprintf(out, "failed to upload charm %s (%d/%d)\n", curl, done, len(toUpload))
+			return
+		}
+		fmt.Fprintf(out, "uploaded charm %s (%d/%d)\n", curl, done, len(toUpload))
+	}
+
+	limit := make(chan struct{}, charmUploadConcurrency)
+	var group errgroup.Group
+	for _, curl := range toUpload {
+		curl, archive := curl, archives[curl] // copy for closure
+		group.Go(func() error {
+			limit <- struct{}{}
+			defer func() { <-limit }()
+			if archive.err != nil {
+				report(curl, archive.err)
+				return nil
+			}
+			report(curl, uploadCharm(st.EnvironUUID(), curl, archive.path, targetAPI))
+			return nil
+		})
+	}
+	group.Wait()
+
+	reportCharmChanges(out, archives)
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return errors.Errorf("couldn't upload charms: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func getCharm(st *state.State, curlString string) (*state.Charm, error) {
+	curl, err := charmv5.ParseURL(curlString)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	ch, err := st.Charm(curl)
+	return ch, errors.Trace(err)
+}
+
+// readCharmArchive copies the charm's archive out of storage to path,
+// fixing its metadata if Juju 2.x can't read it, and records the
+// SHA256 of the archive that will be uploaded.
+func readCharmArchive(store storage.Storage, ch *state.Charm, path string) *charmArchive {
+	if err := copyCharmArchive(store, ch, path); err != nil {
+		return &charmArchive{err: err}
+	}
+	fixedPath, changes, err := fixCharmArchive(path)
+	if err != nil {
+		return &charmArchive{err: err}
+	}
+	sha256, _, err := utils.ReadFileSHA256(fixedPath)
+	if err != nil {
+		return &charmArchive{err: errors.Trace(err)}
+	}
+	return &charmArchive{path: fixedPath, sha256: sha256, changes: changes}
+}
+
+func copyCharmArchive(store storage.Storage, ch *state.Charm, path string) error {
+	reader, _, err := store.Get(ch.StoragePath())
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer reader.Close()
+	return errors.Trace(writeFile(path, 0600, reader))
+}
+
+func uploadCharm(modelUUID, curlString, path string, targetAPI *migrationtarget.Client) error {
+	curl, err := charmv5.ParseURL(curlString)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	_, err = targetAPI.UploadCharm(modelUUID, toV6(curl), f)
+	return errors.Trace(err)
+}
+
+// reportCharmChanges lists the charms whose metadata had to be
+// rewritten so Juju 2.x could read them.
+func reportCharmChanges(out io.Writer, archives map[string]*charmArchive) {
+	var curls []string
+	for curl, archive := range archives {
+		if len(archive.changes) > 0 {
+			curls = append(curls, curl)
+		}
+	}
+	if len(curls) == 0 {
+		return
+	}
+	sort.Strings(curls)
+	fmt.Fprintf(out, "rewrote metadata for %d charm(s) that Juju 2.x couldn't read:\n", len(curls))
+	for _, curl := range curls {
+		fmt.Fprintf(out, "  %s: %s\n", curl, strings.Join(archives[curl].changes, "; "))
+	}
+}
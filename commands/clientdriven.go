@@ -0,0 +1,127 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/utils"
+)
+
+// apiServerAddress is the address of the API server machine when a
+// remote command is run in client-driven mode: on the client rather
+// than on the API server machine. The state database is reached
+// through an SSH tunnel to that machine, and the other machines by
+// proxying SSH connections through it. It's set by the --via flag of
+// the remote commands.
+var apiServerAddress string
+
+// clientDriven returns whether the remote command is being run in
+// client-driven mode.
+func clientDriven() bool {
+	return apiServerAddress != ""
+}
+
+// viaFlag is the gnuflag.Value for --via. The files that are kept on
+// the API server machine in the normal mode (the downloaded tools,
+// saved machines and tag journal) are kept in the operator's home
+// directory instead, so the same mode should be used throughout an
+// upgrade.
+type viaFlag struct{}
+
+// String is part of gnuflag.Value.
+func (viaFlag) String() string {
+	return apiServerAddress
+}
+
+// Set is part of gnuflag.Value.
+func (viaFlag) Set(address string) error {
+	if address == "" {
+		return errors.New("empty API server address")
+	}
+	apiServerAddress = address
+	dir := filepath.Join(utils.Home(), ".juju-1.25-upgrade")
+	toolsDir = filepath.Join(dir, "tools")
+	tagJournalPath = filepath.Join(dir, "tags.journal")
+	return nil
+}
+
+// tunnelTimeout is how long to wait for the SSH tunnel to the state
+// database to start forwarding.
+const tunnelTimeout = 30 * time.Second
+
+// stateTunnels holds the stdin of each SSH tunnel process. The tunnel
+// runs a remote command that reads until stdin is closed, so it lasts
+// until this process exits.
+var stateTunnels []io.Closer
+
+// openStateTunnel forwards a local port through SSH to the state
+// database on the API server machine, and returns the address to dial
+// in place of addrs.
+func openStateTunnel(addrs []string) ([]string, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no state addresses")
+	}
+	_, port, err := net.SplitHostPort(addrs[0])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	local, err := freeLocalAddress()
+	if err != nil {
+		return nil, errors.Annotate(err, "finding a local port")
+	}
+	hops := append(apiServerSSH.jumpHops(), apiServerSSH.hop(apiServerAddress))
+	args := append(hopArgs(hops),
+		"-o", "ExitOnForwardFailure=yes",
+		"-L", local+":localhost:"+port,
+		hops[len(hops)-1].dest,
+		"cat > /dev/null",
+	)
+	logger.Debugf("forwarding %s to port %s on %s", local, port, apiServerAddress)
+	tunnel := exec.Command("ssh", args...)
+	tunnel.Stderr = os.Stderr
+	stdin, err := tunnel.StdinPipe()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := tunnel.Start(); err != nil {
+		return nil, errors.Annotate(err, "starting SSH tunnel")
+	}
+	stateTunnels = append(stateTunnels, stdin)
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- tunnel.Wait()
+	}()
+	timeout := time.After(tunnelTimeout)
+	for {
+		if conn, err := net.Dial("tcp", local); err == nil {
+			conn.Close()
+			return []string{local}, nil
+		}
+		select {
+		case err := <-exited:
+			return nil, errors.Errorf("SSH tunnel to %s exited: %v", apiServerAddress, err)
+		case <-timeout:
+			tunnel.Process.Kill()
+			return nil, errors.Errorf("timed out waiting for SSH tunnel to %s", apiServerAddress)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func freeLocalAddress() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String(), nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+	names2 "gopkg.in/juju/names.v2"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+	"github.com/juju/1.25-upgrade/juju2/api"
+	cloudapi "github.com/juju/1.25-upgrade/juju2/api/cloud"
+	"github.com/juju/1.25-upgrade/juju2/cloud"
+)
+
+// sourceCloud holds the details of the cloud a 1.25 environment is
+// running in, taken from its config.
+type sourceCloud struct {
+	cloudType string
+	endpoint  string
+	region    string
+}
+
+func sourceCloudFromConfig(attrs map[string]interface{}) sourceCloud {
+	source := sourceCloud{}
+	source.cloudType, _ = attrs["type"].(string)
+	source.region, _ = attrs["region"].(string)
+	switch source.cloudType {
+	case "openstack":
+		source.endpoint, _ = attrs["auth-url"].(string)
+	case "maas":
+		source.endpoint, _ = attrs["maas-server"].(string)
+	}
+	return source
+}
+
+func (s sourceCloud) String() string {
+	parts := []string{"type " + s.cloudType}
+	if s.endpoint != "" {
+		parts = append(parts, "endpoint "+s.endpoint)
+	}
+	if s.region != "" {
+		parts = append(parts, "region "+s.region)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// match returns the region of the target cloud that corresponds to
+// the source cloud. If the cloud doesn't match it returns the reason
+// instead. A differing endpoint is returned separately, since it
+// doesn't stop an explicitly chosen cloud from being used.
+func (s sourceCloud) match(target cloud.Cloud) (region, mismatch, endpointMismatch string) {
+	if target.Type != s.cloudType {
+		return "", fmt.Sprintf("type %q doesn't match", target.Type), ""
+	}
+	if s.region == "" {
+		switch len(target.Regions) {
+		case 0:
+			return "", "", s.matchEndpoint(target.Endpoint)
+		case 1:
+			region := target.Regions[0]
+			return region.Name, "", s.matchEndpoint(regionEndpoint(target, region))
+		default:
+			return "", "has several regions but the environment doesn't specify one", ""
+		}
+	}
+	for _, region := range target.Regions {
+		if region.Name == s.region {
+			return region.Name, "", s.matchEndpoint(regionEndpoint(target, region))
+		}
+	}
+	return "", fmt.Sprintf("has no region %q", s.region), ""
+}
+
+func (s sourceCloud) matchEndpoint(endpoint string) string {
+	if s.endpoint == "" || normaliseEndpoint(endpoint) == normaliseEndpoint(s.endpoint) {
+		return ""
+	}
+	return fmt.Sprintf("endpoint %q doesn't match", endpoint)
+}
+
+func regionEndpoint(target cloud.Cloud, region cloud.Region) string {
+	if region.Endpoint != "" {
+		return region.Endpoint
+	}
+	return target.Endpoint
+}
+
+func normaliseEndpoint(endpoint string) string {
+	return strings.ToLower(strings.TrimRight(endpoint, "/"))
+}
+
+// matchTargetCloud returns the name and region of the cloud in the
+// target controller that the environment is running in, matching on
+// the provider type, endpoint and region. If name is given only that
+// cloud is considered, and it's used even if its endpoint differs. The
+// name can be given as <cloud>/<region> to use that region instead of
+// the environment's.
+func matchTargetCloud(clouds map[names2.CloudTag]cloud.Cloud, name string, attrs map[string]interface{}) (string, string, error) {
+	source := sourceCloudFromConfig(attrs)
+	if parts := strings.SplitN(name, "/", 2); len(parts) == 2 {
+		name = parts[0]
+		if source.region != "" && source.region != parts[1] {
+			logger.Warningf("using region %q rather than the environment's region %q", parts[1], source.region)
+		}
+		source.region = parts[1]
+	}
+	cloudNames := make([]string, 0, len(clouds))
+	byName := make(map[string]cloud.Cloud)
+	for tag, target := range clouds {
+		if name != "" && tag.Id() != name {
+			continue
+		}
+		cloudNames = append(cloudNames, tag.Id())
+		byName[tag.Id()] = target
+	}
+	if name != "" && len(cloudNames) == 0 {
+		return "", "", errors.NotFoundf("cloud %q in target controller", name)
+	}
+	sort.Strings(cloudNames)
+
+	var matches, mismatches []string
+	regions := make(map[string]string)
+	for _, cloudName := range cloudNames {
+		region, mismatch, endpointMismatch := source.match(byName[cloudName])
+		if endpointMismatch != "" && name != "" {
+			// The operator chose the cloud, so they know better
+			// than the endpoint check.
+			logger.Warningf("cloud %q: %s (%s); using it anyway, as it was chosen with --target-cloud",
+				cloudName, endpointMismatch, source)
+		} else if endpointMismatch != "" {
+			mismatch = endpointMismatch
+		}
+		if mismatch != "" {
+			mismatches = append(mismatches, fmt.Sprintf("  cloud %q: %s", cloudName, mismatch))
+			continue
+		}
+		matches = append(matches, cloudName)
+		regions[cloudName] = region
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", "", errors.Errorf(
+			"no cloud in the target controller matches the environment (%s):\n%s",
+			source, strings.Join(mismatches, "\n"))
+	case 1:
+		return matches[0], regions[matches[0]], nil
+	default:
+		return "", "", errors.Errorf(
+			"clouds %s in the target controller all match the environment; use --target-cloud to choose one",
+			strings.Join(matches, ", "))
+	}
+}
+
+// findTargetCloud returns the name and region of the cloud in the
+// target controller that the environment is running in.
+func findTargetCloud(conn api.Connection, st *state.State, name string) (string, string, error) {
+	config, err := st.EnvironConfig()
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	clouds, err := cloudapi.NewClient(conn).Clouds()
+	if err != nil {
+		return "", "", errors.Annotate(err, "getting target controller clouds")
+	}
+	return matchTargetCloud(clouds, name, config.AllAttrs())
+}
@@ -0,0 +1,120 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	names2 "gopkg.in/juju/names.v2"
+
+	"github.com/juju/1.25-upgrade/juju2/cloud"
+)
+
+type cloudMatchSuite struct{}
+
+var _ = gc.Suite(&cloudMatchSuite{})
+
+var targetClouds = map[names2.CloudTag]cloud.Cloud{
+	names2.NewCloudTag("aws"): {
+		Type:    "ec2",
+		Regions: []cloud.Region{{Name: "us-east-1"}, {Name: "eu-west-1"}},
+	},
+	names2.NewCloudTag("serverstack"): {
+		Type: "openstack",
+		Regions: []cloud.Region{
+			{Name: "RegionOne", Endpoint: "https://keystone.one:5000/v2.0"},
+			{Name: "RegionTwo", Endpoint: "https://keystone.two:5000/v2.0"},
+		},
+	},
+	names2.NewCloudTag("lab"): {
+		Type:     "maas",
+		Endpoint: "http://10.0.0.2/MAAS",
+	},
+}
+
+func (*cloudMatchSuite) TestMatchRegion(c *gc.C) {
+	name, region, err := matchTargetCloud(targetClouds, "", map[string]interface{}{
+		"type":     "openstack",
+		"auth-url": "https://keystone.two:5000/v2.0/",
+		"region":   "RegionTwo",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(name, gc.Equals, "serverstack")
+	c.Assert(region, gc.Equals, "RegionTwo")
+}
+
+func (*cloudMatchSuite) TestMatchMAASEndpoint(c *gc.C) {
+	name, region, err := matchTargetCloud(targetClouds, "", map[string]interface{}{
+		"type":        "maas",
+		"maas-server": "http://10.0.0.2/MAAS/",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(name, gc.Equals, "lab")
+	c.Assert(region, gc.Equals, "")
+}
+
+func (*cloudMatchSuite) TestNoMatch(c *gc.C) {
+	_, _, err := matchTargetCloud(targetClouds, "", map[string]interface{}{
+		"type":     "openstack",
+		"auth-url": "https://keystone.three:5000/v2.0",
+		"region":   "RegionOne",
+	})
+	c.Assert(err, gc.ErrorMatches, `no cloud in the target controller matches the environment \(type openstack, endpoint https://keystone.three:5000/v2.0, region RegionOne\):
+  cloud "aws": type "ec2" doesn't match
+  cloud "lab": type "maas" doesn't match
+  cloud "serverstack": endpoint "https://keystone.one:5000/v2.0" doesn't match`)
+}
+
+func (*cloudMatchSuite) TestNamedCloud(c *gc.C) {
+	_, _, err := matchTargetCloud(targetClouds, "aws", map[string]interface{}{
+		"type":   "ec2",
+		"region": "ap-southeast-2",
+	})
+	c.Assert(err, gc.ErrorMatches, `no cloud in the target controller matches the environment \(type ec2, region ap-southeast-2\):
+  cloud "aws": has no region "ap-southeast-2"`)
+
+	_, _, err = matchTargetCloud(targetClouds, "azure", map[string]interface{}{"type": "ec2"})
+	c.Assert(err, gc.ErrorMatches, `cloud "azure" in target controller not found`)
+}
+
+func (*cloudMatchSuite) TestNamedCloudDifferentEndpoint(c *gc.C) {
+	// A chosen cloud is used even if its endpoint has changed.
+	name, region, err := matchTargetCloud(targetClouds, "serverstack", map[string]interface{}{
+		"type":     "openstack",
+		"auth-url": "https://keystone-old.one:5000/v2.0",
+		"region":   "RegionOne",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(name, gc.Equals, "serverstack")
+	c.Assert(region, gc.Equals, "RegionOne")
+}
+
+func (*cloudMatchSuite) TestNamedCloudAndRegion(c *gc.C) {
+	name, region, err := matchTargetCloud(targetClouds, "serverstack/RegionTwo", map[string]interface{}{
+		"type":     "openstack",
+		"auth-url": "https://keystone.one:5000/v2.0",
+		"region":   "regionOne",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(name, gc.Equals, "serverstack")
+	c.Assert(region, gc.Equals, "RegionTwo")
+
+	// The provider type still has to match.
+	_, _, err = matchTargetCloud(targetClouds, "aws/us-east-1", map[string]interface{}{
+		"type": "openstack",
+	})
+	c.Assert(err, gc.ErrorMatches, `(?s)no cloud in the target controller matches the environment .*type "ec2" doesn't match`)
+}
+
+func (*cloudMatchSuite) TestAmbiguous(c *gc.C) {
+	clouds := map[names2.CloudTag]cloud.Cloud{
+		names2.NewCloudTag("aws"):       targetClouds[names2.NewCloudTag("aws")],
+		names2.NewCloudTag("aws-other"): targetClouds[names2.NewCloudTag("aws")],
+	}
+	_, _, err := matchTargetCloud(clouds, "", map[string]interface{}{
+		"type":   "ec2",
+		"region": "us-east-1",
+	})
+	c.Assert(err, gc.ErrorMatches, "clouds aws, aws-other in the target controller all match the environment; use --target-cloud to choose one")
+}
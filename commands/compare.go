@@ -0,0 +1,437 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/juju/cmd"
+	"github.com/juju/description"
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/utils/set"
+
+	"github.com/juju/1.25-upgrade/juju2/api/migrationtarget"
+)
+
+var compareDoc = `
+
+The compare command reports the differences between the specified
+Juju 1.25 environment and the model it was imported as in the target
+controller. It should be run after import and before activate, to
+check that nothing was lost or changed on the way.
+
+Applications, units, machines, relations and their settings,
+application config, constraints, storage, addresses, opened ports and
+annotations are compared. Things that import changes deliberately,
+such as the agent tools and the model's name, owner and cloud, are
+ignored.
+
+The options that change the target model, such as --model-name,
+--target-cloud and --storage-pool-map, should be the same as were
+given to import, so the environment is exported the same way.
+
+`
+
+func newCompareCommand() cmd.Command {
+	return wrap(&compareCommand{
+		baseClientCommand: baseClientCommand{
+			needsController: true,
+			remoteCommand:   "compare-impl",
+		},
+	})
+}
+
+type compareCommand struct {
+	baseClientCommand
+
+	targetModel targetModelOptions
+}
+
+func (c *compareCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "compare",
+		Args:    "<environment name> <controller name>",
+		Purpose: "compare the environment with the model imported into the target controller",
+		Doc:     compareDoc,
+	}
+}
+
+func (c *compareCommand) Init(args []string) error {
+	args, err := c.baseClientCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.targetModel.validate(); err != nil {
+		return errors.Trace(err)
+	}
+	return cmd.CheckEmpty(args)
+}
+
+func (c *compareCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.baseClientCommand.SetFlags(f)
+	c.targetModel.setFlags(f)
+}
+
+func (c *compareCommand) Run(ctx *cmd.Context) error {
+	c.extraOptions = append(c.extraOptions, c.targetModel.args()...)
+	return c.baseClientCommand.Run(ctx)
+}
+
+var compareImplDoc = `
+
+compare-impl must be run on an API server machine for a 1.25
+environment.
+
+It will report the differences between the environment and the model
+imported into the target controller.
+
+`
+
+func newCompareImplCommand() cmd.Command {
+	return &compareImplCommand{
+		baseRemoteCommand: baseRemoteCommand{needsController: true},
+	}
+}
+
+type compareImplCommand struct {
+	baseRemoteCommand
+
+	targetModel targetModelOptions
+}
+
+func (c *compareImplCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "compare-impl",
+		Purpose: "controller-side command for the compare command",
+		Doc:     compareImplDoc,
+	}
+}
+
+func (c *compareImplCommand) Init(args []string) error {
+	args, err := c.baseRemoteCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.targetModel.validate(); err != nil {
+		return errors.Trace(err)
+	}
+	return cmd.CheckEmpty(args)
+}
+
+func (c *compareImplCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.baseRemoteCommand.SetFlags(f)
+	c.targetModel.setFlags(f)
+}
+
+func (c *compareImplCommand) Run(ctx *cmd.Context) error {
+	st, err := getState()
+	if err != nil {
+		return errors.Annotate(err, "getting state")
+	}
+	defer st.Close()
+
+	conn, err := c.getControllerConnection()
+	if err != nil {
+		return errors.Annotate(err, "getting controller connection")
+	}
+	defer conn.Close()
+
+	// Export the source with the same overrides as import, so only
+	// real differences are reported.
+	overrides := c.targetModel.exportOverrides()
+	overrides.Cloud, overrides.CloudRegion, err = findTargetCloud(conn, st, c.targetModel.cloud)
+	if err != nil {
+		return errors.Annotate(err, "finding target cloud")
+	}
+	source, err := exportModel(st, overrides)
+	if err != nil {
+		return errors.Annotate(err, "exporting source environment")
+	}
+	// Round-trip the source model through serialization so values
+	// have the same types as the target's.
+	bytes, err := description.Serialize(source)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if source, err = description.Deserialize(bytes); err != nil {
+		return errors.Trace(err)
+	}
+
+	target, err := migrationtarget.NewClient(conn).Export(st.EnvironUUID())
+	if err != nil {
+		return errors.Annotate(err, "exporting imported model from target controller")
+	}
+
+	differences := compareModels(source, target)
+	for _, difference := range differences {
+		fmt.Fprintln(ctx.Stdout, difference)
+	}
+	if len(differences) > 0 {
+		return errors.Errorf("found %d differences", len(differences))
+	}
+	fmt.Fprintln(ctx.Stdout, "no differences found")
+	return nil
+}
+
+// modelDiff collects the differences between two models.
+type modelDiff struct {
+	differences []string
+}
+
+func (d *modelDiff) addf(format string, args ...interface{}) {
+	d.differences = append(d.differences, fmt.Sprintf(format, args...))
+}
+
+// compareKeys reports keys that are only in one of source and target,
+// and returns the keys in both.
+func (d *modelDiff) compareKeys(what string, source, target []string) []string {
+	sourceSet := set.NewStrings(source...)
+	targetSet := set.NewStrings(target...)
+	for _, key := range sourceSet.Difference(targetSet).SortedValues() {
+		d.addf("%s %s: missing from target", what, key)
+	}
+	for _, key := range targetSet.Difference(sourceSet).SortedValues() {
+		d.addf("%s %s: not in source", what, key)
+	}
+	return sourceSet.Intersection(targetSet).SortedValues()
+}
+
+func (d *modelDiff) compareValues(what string, source, target interface{}) {
+	if !reflect.DeepEqual(source, target) {
+		d.addf("%s: source %v, target %v", what, source, target)
+	}
+}
+
+func (d *modelDiff) compareSettings(what string, source, target map[string]interface{}) {
+	for _, key := range d.compareKeys(what+" setting", mapKeys(source), mapKeys(target)) {
+		d.compareValues(fmt.Sprintf("%s setting %s", what, key), source[key], target[key])
+	}
+}
+
+func (d *modelDiff) compareAnnotations(what string, source, target map[string]string) {
+	d.compareValues(what+" annotations", emptyIfNil(source), emptyIfNil(target))
+}
+
+func (d *modelDiff) compareConstraints(what string, source, target description.Constraints) {
+	d.compareValues(what+" constraints", formatConstraints(source), formatConstraints(target))
+}
+
+// compareModels returns the differences between the source and
+// target models.
+func compareModels(source, target description.Model) []string {
+	var d modelDiff
+	d.compareAnnotations("model", source.Annotations(), target.Annotations())
+	d.compareConstraints("model", source.Constraints(), target.Constraints())
+	d.compareApplications(source, target)
+	d.compareMachines(source, target)
+	d.compareRelations(source, target)
+	d.compareStorage(source, target)
+	return d.differences
+}
+
+func (d *modelDiff) compareApplications(source, target description.Model) {
+	sourceApps := make(map[string]description.Application)
+	for _, app := range source.Applications() {
+		sourceApps[app.Name()] = app
+	}
+	targetApps := make(map[string]description.Application)
+	for _, app := range target.Applications() {
+		targetApps[app.Name()] = app
+	}
+	for _, name := range d.compareKeys("application", mapKeys(sourceApps), mapKeys(targetApps)) {
+		sourceApp, targetApp := sourceApps[name], targetApps[name]
+		what := "application " + name
+		d.compareValues(what+" charm", sourceApp.CharmURL(), targetApp.CharmURL())
+		d.compareValues(what+" exposed", sourceApp.Exposed(), targetApp.Exposed())
+		d.compareValues(what+" leader", sourceApp.Leader(), targetApp.Leader())
+		d.compareSettings(what+" config", sourceApp.Settings(), targetApp.Settings())
+		d.compareConstraints(what, sourceApp.Constraints(), targetApp.Constraints())
+		d.compareAnnotations(what, sourceApp.Annotations(), targetApp.Annotations())
+
+		sourceUnits := make(map[string]description.Unit)
+		for _, unit := range sourceApp.Units() {
+			sourceUnits[unit.Name()] = unit
+		}
+		targetUnits := make(map[string]description.Unit)
+		for _, unit := range targetApp.Units() {
+			targetUnits[unit.Name()] = unit
+		}
+		for _, unitName := range d.compareKeys("unit", mapKeys(sourceUnits), mapKeys(targetUnits)) {
+			sourceUnit, targetUnit := sourceUnits[unitName], targetUnits[unitName]
+			what := "unit " + unitName
+			d.compareValues(what+" machine", sourceUnit.Machine().Id(), targetUnit.Machine().Id())
+			d.compareValues(what+" principal", sourceUnit.Principal().Id(), targetUnit.Principal().Id())
+			d.compareAnnotations(what, sourceUnit.Annotations(), targetUnit.Annotations())
+		}
+	}
+}
+
+func (d *modelDiff) compareMachines(source, target description.Model) {
+	sourceMachines := make(map[string]description.Machine)
+	for _, machine := range allMachines(source.Machines()) {
+		sourceMachines[machine.Id()] = machine
+	}
+	targetMachines := make(map[string]description.Machine)
+	for _, machine := range allMachines(target.Machines()) {
+		targetMachines[machine.Id()] = machine
+	}
+	for _, id := range d.compareKeys("machine", mapKeys(sourceMachines), mapKeys(targetMachines)) {
+		sourceMachine, targetMachine := sourceMachines[id], targetMachines[id]
+		what := "machine " + id
+		d.compareValues(what+" instance", instanceId(sourceMachine), instanceId(targetMachine))
+		d.compareValues(what+" series", sourceMachine.Series(), targetMachine.Series())
+		d.compareValues(what+" provider addresses",
+			formatAddresses(sourceMachine.ProviderAddresses()), formatAddresses(targetMachine.ProviderAddresses()))
+		d.compareValues(what+" machine addresses",
+			formatAddresses(sourceMachine.MachineAddresses()), formatAddresses(targetMachine.MachineAddresses()))
+		d.compareValues(what+" opened ports",
+			formatOpenedPorts(sourceMachine.OpenedPorts()), formatOpenedPorts(targetMachine.OpenedPorts()))
+		d.compareConstraints(what, sourceMachine.Constraints(), targetMachine.Constraints())
+		d.compareAnnotations(what, sourceMachine.Annotations(), targetMachine.Annotations())
+	}
+}
+
+func (d *modelDiff) compareRelations(source, target description.Model) {
+	sourceRelations := make(map[string]description.Relation)
+	for _, relation := range source.Relations() {
+		sourceRelations[relation.Key()] = relation
+	}
+	targetRelations := make(map[string]description.Relation)
+	for _, relation := range target.Relations() {
+		targetRelations[relation.Key()] = relation
+	}
+	for _, key := range d.compareKeys("relation", mapKeys(sourceRelations), mapKeys(targetRelations)) {
+		sourceEndpoints := make(map[string]description.Endpoint)
+		for _, ep := range sourceRelations[key].Endpoints() {
+			sourceEndpoints[ep.ApplicationName()+":"+ep.Name()] = ep
+		}
+		targetEndpoints := make(map[string]description.Endpoint)
+		for _, ep := range targetRelations[key].Endpoints() {
+			targetEndpoints[ep.ApplicationName()+":"+ep.Name()] = ep
+		}
+		what := fmt.Sprintf("relation %q endpoint", key)
+		for _, name := range d.compareKeys(what, mapKeys(sourceEndpoints), mapKeys(targetEndpoints)) {
+			sourceSettings := sourceEndpoints[name].AllSettings()
+			targetSettings := targetEndpoints[name].AllSettings()
+			what := fmt.Sprintf("relation %q unit", key)
+			for _, unitName := range d.compareKeys(what, mapKeys(sourceSettings), mapKeys(targetSettings)) {
+				d.compareSettings(fmt.Sprintf("relation %q unit %s", key, unitName),
+					sourceSettings[unitName], targetSettings[unitName])
+			}
+		}
+	}
+}
+
+func (d *modelDiff) compareStorage(source, target description.Model) {
+	sourceStorage := make(map[string]description.Storage)
+	for _, storage := range source.Storages() {
+		sourceStorage[storage.Tag().Id()] = storage
+	}
+	targetStorage := make(map[string]description.Storage)
+	for _, storage := range target.Storages() {
+		targetStorage[storage.Tag().Id()] = storage
+	}
+	for _, id := range d.compareKeys("storage", mapKeys(sourceStorage), mapKeys(targetStorage)) {
+		sourceInstance, targetInstance := sourceStorage[id], targetStorage[id]
+		what := "storage " + id
+		d.compareValues(what+" kind", sourceInstance.Kind(), targetInstance.Kind())
+		d.compareValues(what+" attachments",
+			formatStorageAttachments(sourceInstance), formatStorageAttachments(targetInstance))
+	}
+
+	var sourceVolumes, targetVolumes []string
+	for _, volume := range source.Volumes() {
+		sourceVolumes = append(sourceVolumes, volume.Tag().Id())
+	}
+	for _, volume := range target.Volumes() {
+		targetVolumes = append(targetVolumes, volume.Tag().Id())
+	}
+	d.compareKeys("volume", sourceVolumes, targetVolumes)
+
+	var sourceFilesystems, targetFilesystems []string
+	for _, filesystem := range source.Filesystems() {
+		sourceFilesystems = append(sourceFilesystems, filesystem.Tag().Id())
+	}
+	for _, filesystem := range target.Filesystems() {
+		targetFilesystems = append(targetFilesystems, filesystem.Tag().Id())
+	}
+	d.compareKeys("filesystem", sourceFilesystems, targetFilesystems)
+}
+
+func instanceId(machine description.Machine) string {
+	if instance := machine.Instance(); instance != nil {
+		return instance.InstanceId()
+	}
+	return ""
+}
+
+func formatConstraints(cons description.Constraints) string {
+	if cons == nil {
+		return ""
+	}
+	return fmt.Sprintf("arch=%s container=%s cores=%d cpu-power=%d instance-type=%s mem=%d root-disk=%d spaces=%v tags=%v virt-type=%s",
+		cons.Architecture(), cons.Container(), cons.CpuCores(), cons.CpuPower(), cons.InstanceType(),
+		cons.Memory(), cons.RootDisk(), cons.Spaces(), cons.Tags(), cons.VirtType())
+}
+
+func formatAddresses(addresses []description.Address) []string {
+	result := make([]string, len(addresses))
+	for i, address := range addresses {
+		result[i] = address.Value()
+	}
+	sort.Strings(result)
+	return result
+}
+
+func formatOpenedPorts(opened []description.OpenedPorts) []string {
+	var result []string
+	for _, ports := range opened {
+		for _, portRange := range ports.OpenPorts() {
+			result = append(result, fmt.Sprintf("%s %d-%d/%s (%s)",
+				portRange.UnitName(), portRange.FromPort(), portRange.ToPort(), portRange.Protocol(), ports.SubnetID()))
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func formatStorageAttachments(storage description.Storage) []string {
+	var result []string
+	for _, unit := range storage.Attachments() {
+		result = append(result, unit.Id())
+	}
+	sort.Strings(result)
+	return result
+}
+
+func emptyIfNil(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+// mapKeys returns the keys of a map with string keys.
+func mapKeys(m interface{}) []string {
+	values := reflect.ValueOf(m).MapKeys()
+	keys := make([]string, len(values))
+	for i, value := range values {
+		keys[i] = value.String()
+	}
+	return keys
+}
+
+// allMachines returns the machines along with all of their
+// containers.
+func allMachines(machines []description.Machine) []description.Machine {
+	var result []description.Machine
+	for _, machine := range machines {
+		result = append(result, machine)
+		result = append(result, allMachines(machine.Containers())...)
+	}
+	return result
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"github.com/juju/description"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	names2 "gopkg.in/juju/names.v2"
+)
+
+type compareSuite struct{}
+
+var _ = gc.Suite(&compareSuite{})
+
+func makeCompareModel(config map[string]interface{}) description.Model {
+	model := description.NewModel(description.ModelArgs{
+		Owner:  names2.NewUserTag("admin"),
+		Config: map[string]interface{}{"name": "model", "uuid": "model-uuid"},
+	})
+	machine := model.AddMachine(description.MachineArgs{Id: names2.NewMachineTag("0")})
+	machine.SetInstance(description.CloudInstanceArgs{InstanceId: "inst-0"})
+	app := model.AddApplication(description.ApplicationArgs{
+		Tag:      names2.NewApplicationTag("mysql"),
+		CharmURL: "cs:trusty/mysql-1",
+		Settings: config,
+	})
+	app.AddUnit(description.UnitArgs{
+		Tag:     names2.NewUnitTag("mysql/0"),
+		Machine: names2.NewMachineTag("0"),
+	})
+	return model
+}
+
+func (*compareSuite) TestSame(c *gc.C) {
+	config := map[string]interface{}{"dataset-size": "80%"}
+	differences := compareModels(makeCompareModel(config), makeCompareModel(config))
+	c.Assert(differences, gc.HasLen, 0)
+}
+
+func (*compareSuite) TestDifferences(c *gc.C) {
+	source := makeCompareModel(map[string]interface{}{"dataset-size": "80%", "max-connections": 100})
+	target := makeCompareModel(map[string]interface{}{"dataset-size": "50%"})
+	source.Applications()[0].AddUnit(description.UnitArgs{
+		Tag:     names2.NewUnitTag("mysql/1"),
+		Machine: names2.NewMachineTag("0"),
+	})
+	target.AddMachine(description.MachineArgs{Id: names2.NewMachineTag("1")})
+
+	differences := compareModels(source, target)
+	c.Assert(differences, jc.DeepEquals, []string{
+		"application mysql config setting max-connections: missing from target",
+		"application mysql config setting dataset-size: source 80%, target 50%",
+		"unit mysql/1: missing from target",
+		"machine 1: not in source",
+	})
+}
@@ -2,13 +2,18 @@ package commands
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
+	"unicode/utf16"
 
 	"github.com/juju/cmd"
 	"github.com/juju/errors"
@@ -25,12 +30,35 @@ type execOptions struct {
 	stdout   io.Writer
 	stderr   io.Writer
 	hostAddr string
+	user     string
+	command  func(script string) []string
+	// hops holds the machines to proxy the connection through.
+	hops []sshHop
 }
 
 type execOption func(*execOptions)
 
+// withSystemIdentity returns an option decorator for logging in to the
+// machines in the environment with the configured identity; by
+// default that's the API server machine's system identity.
 func withSystemIdentity() execOption {
-	return withIdentity(systemIdentity)
+	identity := machineIdentity()
+	if identity == "" {
+		return func(*execOptions) {}
+	}
+	return withIdentity(identity)
+}
+
+// withAPIServer returns an option decorator for connecting to the API
+// server machine from the client, with the settings in apiServerSSH.
+func withAPIServer() execOption {
+	return func(opts *execOptions) {
+		opts.user = apiServerSSH.User
+		if apiServerSSH.Identity != "" {
+			opts.SetIdentities(apiServerSSH.Identity)
+		}
+		opts.hops = apiServerSSH.jumpHops()
+	}
 }
 
 func withIdentity(identity string) execOption {
@@ -57,22 +85,58 @@ func withStderr(w io.Writer) execOption {
 	}
 }
 
-func makeProxyCommand(hostAddr string) []string {
-	return []string{"ssh", "-q",
-		"-i", systemIdentity,
-		"-o", "StrictHostKeyChecking no",
-		"-o UserKnownHostsFile /dev/null",
-		"ubuntu@" + hostAddr,
-		"nc %h %p",
+// withUser returns an option decorator for logging in to the remote
+// machine as the given user instead of ubuntu.
+func withUser(user string) execOption {
+	return func(opts *execOptions) {
+		opts.user = user
 	}
 }
 
+// withPowerShell returns an option decorator for running the script
+// with PowerShell rather than bash, for Windows machines.
+func withPowerShell() execOption {
+	return func(opts *execOptions) {
+		opts.command = powerShellCommand
+	}
+}
+
+func bashCommand(script string) []string {
+	return []string{"bash", "-c " + utils.ShQuote(script)}
+}
+
+func sudoBashCommand(script string) []string {
+	return []string{"sudo", "-n", "bash", "-c " + utils.ShQuote(script)}
+}
+
+func powerShellCommand(script string) []string {
+	return []string{
+		"powershell.exe",
+		"-NoProfile",
+		"-NonInteractive",
+		"-ExecutionPolicy", "Bypass",
+		"-EncodedCommand", encodePowerShell(script),
+	}
+}
+
+// encodePowerShell encodes the script in the form expected by
+// powershell -EncodedCommand: base64 of the UTF-16LE text. This
+// avoids any quoting problems with the remote shell.
+func encodePowerShell(script string) string {
+	encoded := utf16.Encode([]rune(script))
+	data := make([]byte, len(encoded)*2)
+	for i, r := range encoded {
+		binary.LittleEndian.PutUint16(data[i*2:], r)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
 // withProxyCommandForHost returns an option decorator for setting
 // an SSH proxy command to proxy through the given host.
 func withProxyCommandForHost(hostAddr string) execOption {
 	return func(opts *execOptions) {
 		opts.hostAddr = hostAddr
-		opts.SetProxyCommand(makeProxyCommand(hostAddr)...)
+		opts.hops = machineHops(hostAddr)
 	}
 }
 
@@ -85,26 +149,46 @@ func defaultSSHOptions() ssh.Options {
 	return options
 }
 
-// runViaSSH runs script in the remote machine with address addr.
-func runViaSSH(addr, script string, opts ...execOption) (int, error) {
+// newExecOptions returns the options for connecting to the machine
+// with address addr, by default as one of the machines in the
+// environment.
+func newExecOptions(addr string, opts ...execOption) execOptions {
 	options := execOptions{Options: defaultSSHOptions()}
 	options.stdout = os.Stdout
 	options.stderr = os.Stderr
 	options.hostAddr = addr
+	options.user = machineSSH.User
+	options.hops = machineHops("")
 	for _, opt := range opts {
 		opt(&options)
 	}
+	if len(options.hops) > 0 {
+		options.SetProxyCommand(hopsProxyCommand(options.hops)...)
+	}
+	if options.command == nil {
+		options.command = sudoBashCommand
+		if options.user == "root" {
+			options.command = bashCommand
+		}
+	}
+	return options
+}
+
+// runViaSSH runs script in the remote machine with address addr.
+func runViaSSH(addr, script string, opts ...execOption) (int, error) {
+	options := newExecOptions(addr, opts...)
 
 	// Throttle on the host address if we're proxying.
-	throttler.Acquire(options.hostAddr)
-	defer throttler.Release(options.hostAddr)
+	throttleAddr := throttleAddress(options.hostAddr)
+	throttler.Acquire(throttleAddr)
+	defer throttler.Release(throttleAddr)
 
 	// This is taken from cmd/juju/ssh.go there is no other clear way to set user
-	userAddr := "ubuntu@" + addr
+	userAddr := options.user + "@" + addr
 
 	userCmd := ssh.Command(
 		userAddr,
-		[]string{"sudo", "-n", "bash", "-c " + utils.ShQuote(script)},
+		options.command(script),
 		&options.Options,
 	)
 	userCmd.Stdin = options.stdin
@@ -122,6 +206,41 @@ func runViaSSH(addr, script string, opts ...execOption) (int, error) {
 	return 0, nil
 }
 
+// copyOptions returns the options for copying files to the machine at
+// addr with ssh.Copy, proxying through hostAddr if it's a container.
+func copyOptions(addr, hostAddr string) *ssh.Options {
+	opts := []execOption{withSystemIdentity()}
+	if hostAddr != "" {
+		opts = append(opts, withProxyCommandForHost(hostAddr))
+	}
+	options := newExecOptions(addr, opts...)
+	return &options.Options
+}
+
+// runLocally runs script with bash on this machine, for a remote
+// command run in client-driven mode. Only the stdin, stdout and stderr
+// options apply.
+func runLocally(script string, opts ...execOption) (int, error) {
+	options := execOptions{stdout: os.Stdout, stderr: os.Stderr}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	command := exec.Command("bash", "-c", script)
+	command.Stdin = options.stdin
+	command.Stdout = options.stdout
+	command.Stderr = options.stderr
+	err := command.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus(), nil
+		}
+	}
+	if err != nil {
+		return -1, errors.Trace(err)
+	}
+	return 0, nil
+}
+
 type FlatMachine struct {
 	Model      string
 	Series     string
@@ -130,26 +249,48 @@ type FlatMachine struct {
 	Address    string
 	Tools      string
 
+	// AddressSource describes why Address was chosen by the address
+	// policy, such as "private" or "space db, reachable".
+	AddressSource string `json:",omitempty"`
+
 	// HostAddress, if non-empty, is the address of the
 	// host machine that contains this machine. If this
 	// is set, it implies the machine is a container.
 	HostAddress string
+
+	// AvailabilityZone is the zone the machine (or its host,
+	// for a container) was provisioned in, if known.
+	AvailabilityZone string `json:",omitempty"`
+
+	// Arch is the machine's hardware architecture, if known.
+	Arch string `json:",omitempty"`
+
+	// Applications holds the names of the applications with
+	// units on the machine.
+	Applications []string `json:",omitempty"`
 }
 
 func flatMachineExecTargets(machines ...FlatMachine) []execTarget {
 	targets := make([]execTarget, len(machines))
 	for i, m := range machines {
 		targets[i] = execTarget{
-			m.Address,
-			m.HostAddress,
+			machine:  m.ID,
+			addr:     m.Address,
+			hostAddr: m.HostAddress,
 		}
 	}
 	return targets
 }
 
 type execTarget struct {
+	// machine is the ID of the target machine, used for reporting
+	// progress and naming its log.
+	machine  string
 	addr     string
 	hostAddr string
+	// options holds any extra options needed to run scripts on
+	// the target, such as a different user or shell.
+	options []execOption
 }
 
 type execResult struct {
@@ -159,18 +300,26 @@ type execResult struct {
 }
 
 const maxPerHost = 5
-const acquireTimeout = 5 * time.Minute
+
+// acquireTimeout is how long Acquire waits without any slot for the
+// host being released before giving up. It's a variable so tests can
+// change it.
+var acquireTimeout = 5 * time.Minute
 
 // hostThrottler prevents us from trying to open too many ssh
 // connections to a host (especially for proxied connections to
 // containers).
 type hostThrottler struct {
-	mu    sync.Mutex
-	chans map[string]chan struct{}
+	mu       sync.Mutex
+	chans    map[string]chan struct{}
+	releases map[string]int
 }
 
 func newHostThrottler() *hostThrottler {
-	return &hostThrottler{chans: make(map[string]chan struct{})}
+	return &hostThrottler{
+		chans:    make(map[string]chan struct{}),
+		releases: make(map[string]int),
+	}
 }
 
 func (t *hostThrottler) getChan(address string) chan struct{} {
@@ -187,18 +336,36 @@ func (t *hostThrottler) getChan(address string) chan struct{} {
 	return hostChan
 }
 
+func (t *hostThrottler) releaseCount(address string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.releases[address]
+}
+
+// Acquire waits for a slot for the address. Every connection in
+// client-driven mode shares the API server machine's slots, so the
+// wait can be long; it only gives up if no slot has been released in
+// acquireTimeout.
 func (t *hostThrottler) Acquire(address string) {
 	hostChan := t.getChan(address)
-	select {
-	case <-hostChan:
-		return
-	case <-time.After(acquireTimeout):
-		panic(fmt.Sprintf("timed out waiting for SSH throttling to %q - missing Release?", address))
+	for {
+		released := t.releaseCount(address)
+		select {
+		case <-hostChan:
+			return
+		case <-time.After(acquireTimeout):
+			if t.releaseCount(address) == released {
+				panic(fmt.Sprintf("timed out waiting for SSH throttling to %q - missing Release?", address))
+			}
+		}
 	}
 }
 
 func (t *hostThrottler) Release(address string) {
 	hostChan := t.getChan(address)
+	t.mu.Lock()
+	t.releases[address]++
+	t.mu.Unlock()
 	select {
 	case hostChan <- struct{}{}:
 		return
@@ -207,6 +374,16 @@ func (t *hostThrottler) Release(address string) {
 	}
 }
 
+// throttleAddress returns the address to throttle connections to the
+// machine at addr on. In client-driven mode every connection goes
+// through the API server machine, so they're throttled on it instead.
+func throttleAddress(addr string) string {
+	if clientDriven() {
+		return apiServerAddress
+	}
+	return addr
+}
+
 var throttler = newHostThrottler()
 
 // parallelExec executes a script on each of the given targets,
@@ -214,29 +391,47 @@ var throttler = newHostThrottler()
 // of the the SSH executions cannot proceed; if the execution
 // proceeds, but the specified script fails, an error will not
 // be returned; the exit code and output will be captured in
-// the results.
-func parallelExec(targets []execTarget, script string) ([]execResult, error) {
+// the results. Progress is reported under the given phase name,
+// and each target's output is written to its machine log.
+func parallelExec(phase string, targets []execTarget, script string) ([]execResult, error) {
+	scripts := make([]string, len(targets))
+	for i := range targets {
+		scripts[i] = script
+	}
+	return parallelExecScripts(phase, targets, scripts)
+}
+
+// parallelExecScripts is like parallelExec, but runs scripts[i] on
+// targets[i], for when the targets need different scripts.
+func parallelExecScripts(phase string, targets []execTarget, scripts []string) ([]execResult, error) {
 	results := make([]execResult, len(targets))
+	reporter.startPhase(phase, len(targets))
 	var group errgroup.Group
 	for i, target := range targets {
-		i, target := i, target // copy for closure
+		i, target, script := i, target, scripts[i] // copy for closure
 		group.Go(func() error {
+			machineLog := reporter.machineLog(phase, target.machine)
+			defer machineLog.Close()
 			var stdoutBuf bytes.Buffer
 			var stderrBuf bytes.Buffer
 			opts := []execOption{
 				withSystemIdentity(),
-				withStdout(&stdoutBuf),
-				withStderr(&stderrBuf),
+				withStdout(io.MultiWriter(&stdoutBuf, machineLog)),
+				withStderr(io.MultiWriter(&stderrBuf, machineLog)),
 			}
 			if target.hostAddr != "" {
 				// This is a container; proxy through
 				// the host machine.
 				opts = append(opts, withProxyCommandForHost(target.hostAddr))
 			}
+			opts = append(opts, target.options...)
 			rc, err := runViaSSH(target.addr, script, opts...)
+			reporter.finished(phase, target.machine, rc, err)
 			if err != nil {
+				fmt.Fprintf(machineLog, "=== failed: %v\n", err)
 				return err
 			}
+			fmt.Fprintf(machineLog, "=== exited with %d\n", rc)
 			results[i] = execResult{
 				Code:   rc,
 				Stdout: stdoutBuf.String(),
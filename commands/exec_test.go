@@ -0,0 +1,58 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"time"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type hostThrottlerSuite struct {
+	testing.CleanupSuite
+}
+
+var _ = gc.Suite(&hostThrottlerSuite{})
+
+func (s *hostThrottlerSuite) TestAcquireWaitsWhileSlotsAreReleased(c *gc.C) {
+	s.PatchValue(&acquireTimeout, 100*time.Millisecond)
+	t := newHostThrottler()
+	for i := 0; i < maxPerHost; i++ {
+		t.Acquire("10.0.0.1")
+	}
+	// Each waiter gets a slot after more than acquireTimeout, but
+	// slots keep being released meanwhile, so none of them give up.
+	done := make(chan struct{})
+	for i := 0; i < maxPerHost; i++ {
+		go func() {
+			t.Acquire("10.0.0.1")
+			time.Sleep(60 * time.Millisecond)
+			t.Release("10.0.0.1")
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < maxPerHost; i++ {
+		time.Sleep(60 * time.Millisecond)
+		t.Release("10.0.0.1")
+	}
+	for i := 0; i < maxPerHost; i++ {
+		select {
+		case <-done:
+		case <-time.After(testing.LongWait):
+			c.Fatalf("timed out waiting for slots")
+		}
+	}
+}
+
+func (s *hostThrottlerSuite) TestAcquireTimesOut(c *gc.C) {
+	s.PatchValue(&acquireTimeout, 10*time.Millisecond)
+	t := newHostThrottler()
+	for i := 0; i < maxPerHost; i++ {
+		t.Acquire("10.0.0.1")
+	}
+	c.Assert(func() { t.Acquire("10.0.0.1") }, gc.PanicMatches, `timed out waiting for SSH throttling to "10.0.0.1" - missing Release\?`)
+	// Other hosts have their own slots.
+	t.Acquire("10.0.0.2")
+}
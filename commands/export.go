@@ -4,8 +4,6 @@
 package commands
 
 import (
-	"net"
-
 	"github.com/juju/description"
 	"github.com/juju/errors"
 
@@ -15,10 +13,20 @@ import (
 	"github.com/juju/1.25-upgrade/juju2/environs"
 	"github.com/juju/1.25-upgrade/juju2/environs/config"
 	"github.com/juju/1.25-upgrade/juju2/instance"
+	"github.com/juju/1.25-upgrade/juju2/storage"
+	"github.com/juju/1.25-upgrade/juju2/storage/provider"
 )
 
-func exportModel(st *state.State, targetCloud string) (description.Model, error) {
-	model, err := st.Export(targetCloud)
+func exportModel(st *state.State, overrides state.ExportOverrides) (description.Model, error) {
+	overrides.ProviderNetworks = func(model description.Model) (state.ProviderNetworks, error) {
+		return getProviderNetworks(st, model)
+	}
+	if len(overrides.StoragePools) > 0 {
+		overrides.LocalStorageProviderTypes = func(model description.Model) ([]string, error) {
+			return storageProviderTypes(st, model)
+		}
+	}
+	model, err := st.Export(overrides)
 	if err != nil {
 		return nil, errors.Annotate(err, "exporting model representation")
 	}
@@ -29,7 +37,9 @@ func exportModel(st *state.State, targetCloud string) (description.Model, error)
 		// Juju 1.25 doesn't have complete link-layer device definitions
 		// (it has network interfaces, but they lack some of the details)
 		// or IP addresses. Query MAAS for those using the Juju 2.x code,
-		// and fill in the blanks.
+		// and fill in the blanks. Other providers can't tell us about
+		// the devices; the import reads them from the machines with
+		// addObservedNetworkEntities.
 		if err := addMAASNetworkEntities(model, st); err != nil {
 			return nil, errors.Annotate(err, "adding MAAS network entities")
 		}
@@ -42,27 +52,7 @@ func exportModel(st *state.State, targetCloud string) (description.Model, error)
 // so we take the model from 1.25 and augment it by using the Juju 2.x
 // MAAS provider code.
 func addMAASNetworkEntities(model description.Model, st *state.State) error {
-	envCfg, err := st.EnvironConfig()
-	if err != nil {
-		return errors.Trace(err)
-	}
-	attrs := envCfg.AllAttrs()
-	cred := cloud.NewCredential(cloud.OAuth1AuthType, map[string]string{
-		"maas-oauth": attrs["maas-oauth"].(string),
-	})
-	cloudSpec := environs.CloudSpec{
-		Type:       "maas",
-		Name:       model.Cloud(),
-		Region:     model.CloudRegion(),
-		Endpoint:   attrs["maas-server"].(string),
-		Credential: &cred,
-	}
-
-	modelCfg, err := config.New(config.NoDefaults, model.Config())
-	if err != nil {
-		return errors.Trace(err)
-	}
-	env, err := environs.New(environs.OpenParams{cloudSpec, modelCfg})
+	env, err := newJuju2Environ(model, st)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -84,38 +74,112 @@ func addMAASNetworkEntities(model description.Model, st *state.State) error {
 		}
 
 		networkConfig := networkingcommon.NetworkConfigFromInterfaceInfo(interfaces)
-		devicesArgs, devicesAddrs := networkingcommon.NetworkConfigsToStateArgs(networkConfig)
-		for _, d := range devicesArgs {
-			model.AddLinkLayerDevice(description.LinkLayerDeviceArgs{
-				Name:        d.Name,
-				MTU:         d.MTU,
-				ProviderID:  string(d.ProviderID),
-				MachineID:   machine.Id(),
-				Type:        string(d.Type),
-				MACAddress:  d.MACAddress,
-				IsAutoStart: d.IsAutoStart,
-				IsUp:        d.IsUp,
-				ParentName:  d.ParentName,
-			})
-		}
-		for _, d := range devicesAddrs {
-			ip, ipNet, err := net.ParseCIDR(d.CIDRAddress)
-			if err != nil {
-				return errors.Trace(err)
-			}
-			model.AddIPAddress(description.IPAddressArgs{
-				ProviderID:       string(d.ProviderID),
-				DeviceName:       d.DeviceName,
-				MachineID:        machine.Id(),
-				SubnetCIDR:       ipNet.String(),
-				ConfigMethod:     string(d.ConfigMethod),
-				Value:            ip.String(),
-				DNSServers:       d.DNSServers,
-				DNSSearchDomains: d.DNSSearchDomains,
-				GatewayAddress:   d.GatewayAddress,
-			})
+		if err := addNetworkConfig(model, machine.Id(), networkConfig); err != nil {
+			return errors.Trace(err)
 		}
 	}
 
 	return nil
 }
+
+// storageProviderTypes returns the storage provider types that the
+// Juju 2.x provider built into this tool supports for the model,
+// along with the common ones. They're the types a 2.2.4 controller
+// would have, but the target controller itself isn't asked. It
+// returns nil if the provider can't be opened here, in which case
+// nothing can be checked.
+func storageProviderTypes(st *state.State, model description.Model) ([]string, error) {
+	env, err := newJuju2Environ(model, st)
+	if errors.IsNotSupported(err) {
+		logger.Warningf("not checking storage pool map provider types: %v", err)
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Trace(err)
+	}
+	registry := storage.ChainedProviderRegistry{env, provider.CommonStorageProviders()}
+	providerTypes, err := registry.StorageProviderTypes()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	result := make([]string, len(providerTypes))
+	for i, providerType := range providerTypes {
+		result[i] = string(providerType)
+	}
+	return result, nil
+}
+
+// newJuju2Environ opens the environment with the Juju 2.x provider,
+// using the exported model config and the credentials from the 1.25
+// environment config. The model's own credential isn't used, since
+// it has no secrets when the model uses an existing credential.
+func newJuju2Environ(model description.Model, st *state.State) (environs.Environ, error) {
+	envCfg, err := st.EnvironConfig()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	attrs := envCfg.AllAttrs()
+	cloudSpec := environs.CloudSpec{
+		Type:   envCfg.Type(),
+		Name:   model.Cloud(),
+		Region: model.CloudRegion(),
+	}
+	var cred cloud.Credential
+	switch envCfg.Type() {
+	case "maas":
+		credAttrs, err := stringAttrs(attrs, "maas-oauth", "maas-server")
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		cred = cloud.NewCredential(cloud.OAuth1AuthType, map[string]string{
+			"maas-oauth": credAttrs["maas-oauth"],
+		})
+		cloudSpec.Endpoint = credAttrs["maas-server"]
+	case "openstack":
+		names := []string{"tenant-name", "auth-url", "username", "password"}
+		authType := cloud.UserPassAuthType
+		if attrs["auth-mode"] == "keypair" {
+			names = []string{"tenant-name", "auth-url", "access-key", "secret-key"}
+			authType = cloud.AccessKeyAuthType
+		}
+		credAttrs, err := stringAttrs(attrs, names...)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		cloudSpec.Endpoint = credAttrs["auth-url"]
+		delete(credAttrs, "auth-url")
+		cred = cloud.NewCredential(authType, credAttrs)
+	case "ec2":
+		credAttrs, err := stringAttrs(attrs, "access-key", "secret-key")
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		cred = cloud.NewCredential(cloud.AccessKeyAuthType, credAttrs)
+	default:
+		return nil, errors.NotSupportedf("provider type %q", envCfg.Type())
+	}
+	cloudSpec.Credential = &cred
+
+	modelCfg, err := config.New(config.NoDefaults, model.Config())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	env, err := environs.New(environs.OpenParams{cloudSpec, modelCfg})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return env, nil
+}
+
+// stringAttrs returns the named attributes from the environment
+// config, which must all be strings.
+func stringAttrs(attrs map[string]interface{}, names ...string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, name := range names {
+		value, ok := attrs[name].(string)
+		if !ok {
+			return nil, errors.Errorf("environment config %q: expected string, got %T", name, attrs[name])
+		}
+		result[name] = value
+	}
+	return result, nil
+}
@@ -0,0 +1,32 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type exportSuite struct{}
+
+var _ = gc.Suite(&exportSuite{})
+
+func (*exportSuite) TestStringAttrs(c *gc.C) {
+	attrs := map[string]interface{}{
+		"access-key": "key",
+		"secret-key": "secret",
+		"port":       17070,
+	}
+	result, err := stringAttrs(attrs, "access-key", "secret-key")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result, jc.DeepEquals, map[string]string{
+		"access-key": "key",
+		"secret-key": "secret",
+	})
+
+	_, err = stringAttrs(attrs, "access-key", "port")
+	c.Assert(err, gc.ErrorMatches, `environment config "port": expected string, got int`)
+	_, err = stringAttrs(attrs, "auth-url")
+	c.Assert(err, gc.ErrorMatches, `environment config "auth-url": expected string, got <nil>`)
+}
@@ -0,0 +1,199 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+	"github.com/juju/utils"
+	"github.com/juju/utils/ssh"
+
+	"github.com/juju/1.25-upgrade/juju2/instance"
+	coretools "github.com/juju/1.25-upgrade/juju2/tools"
+)
+
+// hostToolsCacheDir is the directory in the machine user's home on a
+// container host where the tools, plugin and upgrade config are kept
+// to be pushed into the containers.
+const hostToolsCacheDir = "1.25-upgrade-tools-cache"
+
+// lxdContainerName returns the name of the LXD container for the
+// machine, and whether the machine is an LXD container at all. By the
+// time the agents are upgraded migrate-lxc will have renamed the
+// containers to the names Juju 2.x expects.
+func lxdContainerName(machine FlatMachine) (string, bool) {
+	if machine.HostAddress == "" || !strings.Contains(machine.ID, "/lxc/") {
+		return "", false
+	}
+	namespace, err := instance.NewNamespace(machine.Model)
+	if err != nil {
+		logger.Warningf("machine %s: %v", machine.ID, err)
+		return "", false
+	}
+	name, err := namespace.Hostname(strings.Replace(machine.ID, "lxc", "lxd", 1))
+	if err != nil {
+		logger.Warningf("machine %s: %v", machine.ID, err)
+		return "", false
+	}
+	return name, true
+}
+
+// hostFile is a file that's copied to the host of LXD containers
+// once, to be pushed into each of the containers from there.
+type hostFile struct {
+	// path is the file's path on this machine.
+	path string
+
+	// sha256 is the file's SHA256, checked on the host and in the
+	// containers.
+	sha256 string
+}
+
+// newHostFile returns the hostFile for the file at filePath.
+func newHostFile(filePath string) (hostFile, error) {
+	sha256, _, err := utils.ReadFileSHA256(filePath)
+	if err != nil {
+		return hostFile{}, errors.Trace(err)
+	}
+	return hostFile{path: filePath, sha256: sha256}, nil
+}
+
+// toolsHostFile returns the hostFile for the downloaded tools.
+func toolsHostFile(tools *coretools.Tools) hostFile {
+	return hostFile{
+		path:   toolsFilePath(tools.Version.Number, tools.Version.Series+"-"+tools.Version.Arch),
+		sha256: tools.SHA256,
+	}
+}
+
+// distributeHostTools copies the files needed by the LXD containers
+// in machines (as reported by their agentUpgraders) to their hosts,
+// once per host rather than once per container, so they can be pushed
+// into the containers from there. It returns the error for each host
+// address the copy failed for.
+func distributeHostTools(machines []FlatMachine, upgraders []agentUpgrader, tools map[string]*coretools.Tools) map[string]error {
+	hostErrors := make(map[string]error)
+	var hosts []string
+	hostFiles := make(map[string][]hostFile)
+	seen := make(map[string]bool)
+	for i, machine := range machines {
+		files, err := upgraders[i].hostFiles(machine, tools[seriesArch(machine)])
+		if err != nil {
+			hostErrors[machine.HostAddress] = errors.Annotatef(err, "machine %s", machine.ID)
+			continue
+		}
+		for _, file := range files {
+			key := machine.HostAddress + " " + file.path
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if hostFiles[machine.HostAddress] == nil {
+				hosts = append(hosts, machine.HostAddress)
+			}
+			hostFiles[machine.HostAddress] = append(hostFiles[machine.HostAddress], file)
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		if hostErrors[host] != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(host string, files []hostFile) {
+			defer wg.Done()
+			for _, file := range files {
+				if err := pushFileToHost(host, file); err != nil {
+					mu.Lock()
+					hostErrors[host] = errors.Annotatef(err, "host %s", host)
+					mu.Unlock()
+					return
+				}
+			}
+		}(host, hostFiles[host])
+	}
+	wg.Wait()
+	return hostErrors
+}
+
+// pushFileToHost copies the file into the cache on the host, unless a
+// copy with the right SHA256 is already there.
+func pushFileToHost(hostAddress string, file hostFile) error {
+	fileName := path.Base(file.path)
+	checkScript := fmt.Sprintf(
+		"mkdir -p %[1]s && chown %[3]s: %[1]s && cd %[1]s && %[2]s",
+		hostToolsCacheDir, sha256CheckCommand(file.sha256, fileName), machineSSH.User,
+	)
+	rc, err := runViaSSH(hostAddress, checkScript, withSystemIdentity())
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if rc == 0 {
+		logger.Debugf("%s already cached on host %s", fileName, hostAddress)
+		return nil
+	}
+
+	options := copyOptions(hostAddress, "")
+	logger.Debugf("copying %s to host %s", file.path, hostAddress)
+	args := []string{file.path, fmt.Sprintf("%s@%s:~/%s/", machineSSH.User, hostAddress, hostToolsCacheDir)}
+	throttleAddr := throttleAddress(hostAddress)
+	throttler.Acquire(throttleAddr)
+	err = ssh.Copy(args, options)
+	throttler.Release(throttleAddr)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	rc, err = runViaSSH(hostAddress, checkScript, withSystemIdentity())
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if rc != 0 {
+		return errors.Errorf("SHA256 of %s on host doesn't match %s", fileName, file.sha256)
+	}
+	return nil
+}
+
+// pushFilesFromHost pushes the files cached on the container's host
+// into the upgrade directory in the container, and checks they
+// arrived intact. runViaSSH limits the connections to the host, so
+// this mustn't hold a throttler slot for it as well.
+func pushFilesFromHost(machine FlatMachine, containerName string, files []hostFile) error {
+	targetDir := path.Join(homeDir(machineSSH.User), upgradeDir)
+	var script bytes.Buffer
+	var checks []string
+	script.WriteString("set -e\n")
+	for _, file := range files {
+		fileName := path.Base(file.path)
+		fmt.Fprintf(&script, "lxc file push %s/%s %s%s/%s\n",
+			hostToolsCacheDir, fileName, containerName, targetDir, fileName)
+		checks = append(checks, sha256CheckCommand(file.sha256, fileName))
+	}
+	fmt.Fprintf(&script, "lxc exec %s -- sh -c 'cd %s && %s'\n",
+		containerName, targetDir, strings.Join(checks, " && "))
+
+	logger.Debugf("pushing files into container %s from its host", machine.ID)
+	rc, err := runViaSSH(machine.HostAddress, script.String(), withSystemIdentity())
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if rc != 0 {
+		return &cmd.RcPassthroughError{Code: rc}
+	}
+	return nil
+}
+
+// sha256CheckCommand returns a shell command that fails unless the
+// file in the current directory has the given SHA256.
+func sha256CheckCommand(sha256, file string) string {
+	return fmt.Sprintf(`echo "%s  %s" | sha256sum -c --status 2>/dev/null`, sha256, file)
+}
@@ -0,0 +1,216 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils"
+	"github.com/juju/utils/ssh"
+	"github.com/juju/version"
+	gc "gopkg.in/check.v1"
+
+	coretools "github.com/juju/1.25-upgrade/juju2/tools"
+)
+
+const hostToolsModel = "deadbeef-0bad-400d-8000-4b1d0d06f00d"
+
+// fakeSSHScript logs the destination and remote command of each
+// connection, one per line, and succeeds.
+const fakeSSHScript = `#!/bin/bash
+dest=
+for arg; do case "$arg" in *@*) dest=$arg; break;; esac; done
+line="$dest ${@: -1}"
+echo "${line//$'\n'/ }" >> %[1]s
+sleep 0.1
+`
+
+type hostToolsSuite struct {
+	testing.CleanupSuite
+	sshLog string
+}
+
+var _ = gc.Suite(&hostToolsSuite{})
+
+func (s *hostToolsSuite) SetUpTest(c *gc.C) {
+	s.CleanupSuite.SetUpTest(c)
+	bin := c.MkDir()
+	s.sshLog = filepath.Join(c.MkDir(), "ssh.log")
+	err := ioutil.WriteFile(filepath.Join(bin, "ssh"), []byte(fmt.Sprintf(fakeSSHScript, s.sshLog)), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	err = ioutil.WriteFile(filepath.Join(bin, "scp"), []byte("#!/bin/sh\necho scp \"$@\" >> "+s.sshLog+"\n"), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	s.PatchEnvPathPrepend(bin)
+	client, err := ssh.NewOpenSSHClient()
+	c.Assert(err, jc.ErrorIsNil)
+	s.PatchValue(&ssh.DefaultClient, ssh.Client(client))
+	s.PatchValue(&throttler, newHostThrottler())
+	s.PatchValue(&toolsDir, c.MkDir())
+}
+
+// sshCalls returns the logged connections.
+func (s *hostToolsSuite) sshCalls(c *gc.C) []string {
+	data, err := ioutil.ReadFile(s.sshLog)
+	c.Assert(err, jc.ErrorIsNil)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+// newUnixUpgrader returns a unixAgentUpgrader with a plugin and
+// upgrade config to copy.
+func (s *hostToolsSuite) newUnixUpgrader(c *gc.C) *unixAgentUpgrader {
+	plugin := filepath.Join(c.MkDir(), "juju-1.25-upgrade")
+	err := ioutil.WriteFile(plugin, []byte("plugin"), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	err = ioutil.WriteFile(filepath.Join(toolsDir, agentUpgradeConfigFile), []byte("{}"), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	return &unixAgentUpgrader{plugin: plugin}
+}
+
+func newTestTools(binary string) *coretools.Tools {
+	return &coretools.Tools{Version: version.MustParseBinary(binary), SHA256: "abc123"}
+}
+
+func testContainer(id, hostAddress, series string) FlatMachine {
+	return FlatMachine{
+		Model:       hostToolsModel,
+		ID:          id,
+		Series:      series,
+		Address:     "10.0.3.100",
+		HostAddress: hostAddress,
+		Tools:       "1.25.13-" + series + "-amd64",
+	}
+}
+
+func (s *hostToolsSuite) TestLXDContainerName(c *gc.C) {
+	for i, test := range []struct {
+		about    string
+		machine  FlatMachine
+		expected string
+	}{{
+		about:   "not a container",
+		machine: FlatMachine{Model: hostToolsModel, ID: "1"},
+	}, {
+		about:   "not an lxc container",
+		machine: FlatMachine{Model: hostToolsModel, ID: "1/kvm/0", HostAddress: "10.0.0.1"},
+	}, {
+		about:    "lxc containers are renamed to lxd",
+		machine:  FlatMachine{Model: hostToolsModel, ID: "1/lxc/0", HostAddress: "10.0.0.1"},
+		expected: "juju-06f00d-1-lxd-0",
+	}, {
+		about:   "bad model",
+		machine: FlatMachine{Model: "not-a-uuid", ID: "1/lxc/0", HostAddress: "10.0.0.1"},
+	}} {
+		c.Logf("test %d: %s", i, test.about)
+		name, ok := lxdContainerName(test.machine)
+		c.Check(name, gc.Equals, test.expected)
+		c.Check(ok, gc.Equals, test.expected != "")
+	}
+}
+
+func (s *hostToolsSuite) TestSHA256CheckCommand(c *gc.C) {
+	dir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "tools.tgz"), []byte("tools"), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	sha256, _, err := utils.ReadFileSHA256(filepath.Join(dir, "tools.tgz"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(sha256CheckCommand(sha256, "tools.tgz"), gc.Equals,
+		`echo "`+sha256+`  tools.tgz" | sha256sum -c --status 2>/dev/null`)
+
+	run := func(sha256, file string) error {
+		command := exec.Command("bash", "-c", sha256CheckCommand(sha256, file))
+		command.Dir = dir
+		return command.Run()
+	}
+	c.Check(run(sha256, "tools.tgz"), jc.ErrorIsNil)
+	c.Check(run(strings.Repeat("0", 64), "tools.tgz"), gc.NotNil)
+	c.Check(run(sha256, "missing.tgz"), gc.NotNil)
+}
+
+var cachedFileRE = regexp.MustCompile(`echo "[0-9a-f]+  ([^"]+)"`)
+
+func (s *hostToolsSuite) TestDistributeHostToolsOncePerHost(c *gc.C) {
+	unix := s.newUnixUpgrader(c)
+	machines := []FlatMachine{
+		testContainer("1/lxc/0", "10.0.0.1", "xenial"),
+		testContainer("1/lxc/1", "10.0.0.1", "xenial"),
+		testContainer("1/lxc/2", "10.0.0.1", "trusty"),
+		testContainer("2/lxc/0", "10.0.0.2", "xenial"),
+		{Model: hostToolsModel, ID: "3", Series: "xenial", Address: "10.0.0.3", Tools: "1.25.13-xenial-amd64"},
+	}
+	upgraders := make([]agentUpgrader, len(machines))
+	for i := range machines {
+		upgraders[i] = unix
+	}
+	tools := map[string]*coretools.Tools{
+		"xenial-amd64": newTestTools("2.2.4-xenial-amd64"),
+		"trusty-amd64": newTestTools("2.2.4-trusty-amd64"),
+	}
+	hostErrors := distributeHostTools(machines, upgraders, tools)
+	c.Assert(hostErrors, gc.HasLen, 0)
+
+	// The fake ssh reports every file as cached, so each file is
+	// only checked once on each host.
+	var pushed []string
+	for _, call := range s.sshCalls(c) {
+		match := cachedFileRE.FindStringSubmatch(call)
+		c.Assert(match, gc.NotNil, gc.Commentf("call %q", call))
+		pushed = append(pushed, strings.Fields(call)[0]+" "+match[1])
+	}
+	c.Assert(pushed, jc.SameContents, []string{
+		"ubuntu@10.0.0.1 juju-1.25-upgrade",
+		"ubuntu@10.0.0.1 agent-upgrade.json",
+		"ubuntu@10.0.0.1 2.2.4-xenial-amd64.tgz",
+		"ubuntu@10.0.0.1 2.2.4-trusty-amd64.tgz",
+		"ubuntu@10.0.0.2 juju-1.25-upgrade",
+		"ubuntu@10.0.0.2 agent-upgrade.json",
+		"ubuntu@10.0.0.2 2.2.4-xenial-amd64.tgz",
+	})
+}
+
+func (s *hostToolsSuite) TestPushFilesToManyContainersOnOneHost(c *gc.C) {
+	// More containers than maxPerHost on the same host mustn't
+	// deadlock on the throttler.
+	unix := s.newUnixUpgrader(c)
+	tools := newTestTools("2.2.4-xenial-amd64")
+	var machines []FlatMachine
+	for i := 0; i < maxPerHost*2; i++ {
+		machines = append(machines, testContainer(fmt.Sprintf("1/lxc/%d", i), "10.0.0.1", "xenial"))
+	}
+	errs := make([]error, len(machines))
+	var wg sync.WaitGroup
+	for i, machine := range machines {
+		wg.Add(1)
+		go func(i int, machine FlatMachine) {
+			defer wg.Done()
+			errs[i] = unix.pushFiles(machine, tools, nil)
+		}(i, machine)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		c.Check(err, jc.ErrorIsNil, gc.Commentf("machine %s", machines[i].ID))
+	}
+
+	// Each container gets a directory made, and the files pushed
+	// from the host; nothing is copied to the containers directly.
+	var pushes int
+	for _, call := range s.sshCalls(c) {
+		c.Assert(call, gc.Not(gc.Matches), "scp .*")
+		if strings.Contains(call, "lxc file push") {
+			c.Check(call, gc.Matches, `ubuntu@10\.0\.0\.1 .*`)
+			c.Check(call, gc.Matches, `.*lxc file push 1\.25-upgrade-tools-cache/juju-1\.25-upgrade .*`)
+			c.Check(call, gc.Matches, `.*lxc file push 1\.25-upgrade-tools-cache/agent-upgrade\.json .*`)
+			c.Check(call, gc.Matches, `.*lxc file push 1\.25-upgrade-tools-cache/2\.2\.4-xenial-amd64\.tgz .*`)
+			pushes++
+		}
+	}
+	c.Assert(pushes, gc.Equals, len(machines))
+}
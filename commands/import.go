@@ -5,20 +5,20 @@ package commands
 
 import (
 	"fmt"
-	"io"
-	"io/ioutil"
 
 	"github.com/juju/cmd"
 	"github.com/juju/description"
 	"github.com/juju/errors"
 	"github.com/juju/gnuflag"
 	"github.com/juju/utils/set"
+	"github.com/juju/version"
 	charmv5 "gopkg.in/juju/charm.v5"
 	charmv6 "gopkg.in/juju/charm.v6-unstable"
+	names2 "gopkg.in/juju/names.v2"
 
 	"github.com/juju/1.25-upgrade/juju1/state"
-	"github.com/juju/1.25-upgrade/juju1/state/storage"
 	"github.com/juju/1.25-upgrade/juju2/api/migrationtarget"
+	coremigration "github.com/juju/1.25-upgrade/juju2/core/migration"
 	coretools "github.com/juju/1.25-upgrade/juju2/tools"
 )
 
@@ -28,6 +28,31 @@ The import command converts the specified Juju 1.25 environment into
 the Juju 2.2.3 import format and imports it as a model under the
 target controller.
 
+The model's cloud and region are found by matching the environment's
+provider type, endpoint and region against the clouds in the target
+controller. If several clouds match, choose one with --target-cloud.
+
+By default the model has the same name and owner as the environment.
+Use --model-name and --owner to change them, for example when the
+target controller already has a model with that name, or models
+should be owned by a service account. The owner is made an admin of
+the model along with the environment's users. The model's cloud
+credential is named <owner>-<environment name> unless
+--credential-name is given. The tags written on the environment's
+instances and security groups only refer to the controller and model
+UUIDs, so they're unaffected by these options.
+
+Use --existing-credential to have the model use a credential that the
+owner already has in the target controller, rather than one made from
+the secrets in the environment config. Import checks that all of the
+environment's instances can be seen with that credential before going
+any further.
+
+Storage pools in use whose provider type Juju 2.x doesn't support
+stop the export. Use --storage-pool-map to give a YAML file mapping
+1.25 pool names or provider types onto 2.x provider types and
+attributes; see the README for the format.
+
 All the agents in the source environment should be stopped before
 running the import command.
 
@@ -46,7 +71,8 @@ type importCommand struct {
 	baseClientCommand
 
 	keepBroken  bool
-	targetCloud string
+	targetModel targetModelOptions
+	toolsSource toolsSourceOptions
 }
 
 func (c *importCommand) Info() *cmd.Info {
@@ -63,22 +89,25 @@ func (c *importCommand) Init(args []string) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
+	if err := c.targetModel.validate(); err != nil {
+		return errors.Trace(err)
+	}
 	return cmd.CheckEmpty(args)
 }
 
 func (c *importCommand) SetFlags(f *gnuflag.FlagSet) {
 	c.baseClientCommand.SetFlags(f)
 	f.BoolVar(&c.keepBroken, "keep-broken", false, "Keep a failed import")
-	f.StringVar(&c.targetCloud, "target-cloud", "", "The name of the cloud in the target controller")
+	c.targetModel.setFlags(f)
+	c.toolsSource.setFlags(f)
 }
 
 func (c *importCommand) Run(ctx *cmd.Context) error {
 	if c.keepBroken {
 		c.extraOptions = append(c.extraOptions, "--keep-broken")
 	}
-	if c.targetCloud != "" {
-		c.extraOptions = append(c.extraOptions, "--target-cloud", c.targetCloud)
-	}
+	c.extraOptions = append(c.extraOptions, c.targetModel.args()...)
+	c.extraOptions = append(c.extraOptions, c.toolsSource.args()...)
 	return c.baseClientCommand.Run(ctx)
 }
 
@@ -102,7 +131,8 @@ type importImplCommand struct {
 	baseRemoteCommand
 
 	keepBroken  bool
-	targetCloud string
+	targetModel targetModelOptions
+	toolsSource toolsSourceOptions
 }
 
 func (c *importImplCommand) Info() *cmd.Info {
@@ -118,14 +148,17 @@ func (c *importImplCommand) Init(args []string) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
-
+	if err := c.targetModel.validate(); err != nil {
+		return errors.Trace(err)
+	}
 	return cmd.CheckEmpty(args)
 }
 
 func (c *importImplCommand) SetFlags(f *gnuflag.FlagSet) {
 	c.baseRemoteCommand.SetFlags(f)
 	f.BoolVar(&c.keepBroken, "keep-broken", false, "Keep a failed import")
-	f.StringVar(&c.targetCloud, "target-cloud", "", "The name of the cloud in the target controller")
+	c.targetModel.setFlags(f)
+	c.toolsSource.setFlags(f)
 }
 
 func (c *importImplCommand) Run(ctx *cmd.Context) (err error) {
@@ -148,15 +181,34 @@ func (c *importImplCommand) Run(ctx *cmd.Context) (err error) {
 	defer conn.Close()
 	targetAPI := migrationtarget.NewClient(conn)
 
+	// Check that the target can accept the model before doing any
+	// of the expensive work.
+	overrides := c.targetModel.exportOverrides()
+	overrides.Cloud, overrides.CloudRegion, err = findTargetCloud(conn, st, c.targetModel.cloud)
+	if err != nil {
+		return errors.Annotate(err, "finding target cloud")
+	}
+	logger.Infof("importing into cloud %q region %q", overrides.Cloud, overrides.CloudRegion)
+	modelInfo, err := makeModelInfo(st, overrides)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := targetAPI.Prechecks(modelInfo); err != nil {
+		return errors.Annotate(err, "target controller prechecks failed")
+	}
+
 	logger.Debugf("exporting model from source environmment %s", st.EnvironTag().Id())
-	model, err := exportModel(st, c.targetCloud)
+	model, err := exportModel(st, overrides)
 	if err != nil {
 		return errors.Annotate(err, "exporting")
 	}
 
 	// We need to update the tools in the exported model to match the
 	// ones we'll put on the agents.
-	tw := newToolsWrangler(conn)
+	tw, err := newToolsWrangler(conn, c.controllerInfo, c.toolsSource)
+	if err != nil {
+		return errors.Trace(err)
+	}
 	allTools, err := updateToolsInModel(model, tw)
 	if err != nil {
 		return errors.Trace(err)
@@ -164,6 +216,29 @@ func (c *importImplCommand) Run(ctx *cmd.Context) (err error) {
 
 	model.Config()["agent-version"] = tw.version()
 
+	// 1.25 doesn't record the machines' SSH host keys, so get them
+	// from the machines themselves. The same goes for the link-layer
+	// devices, except on MAAS where the export got them from the
+	// provider.
+	machines, err := getMachines(st)
+	if err != nil {
+		return errors.Annotate(err, "getting machines")
+	}
+	envCfg, err := st.EnvironConfig()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if envCfg.Type() != "maas" {
+		if err := addObservedNetworkEntities(model, machines); err != nil {
+			return errors.Annotate(err, "adding observed network entities")
+		}
+	}
+	hostKeys, err := collectSSHHostKeys(machines)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	addSSHHostKeys(model, hostKeys)
+
 	if logger.IsDebugEnabled() {
 		err = writeModel(ctx, model)
 		if err != nil {
@@ -175,6 +250,24 @@ func (c *importImplCommand) Run(ctx *cmd.Context) (err error) {
 	if err != nil {
 		return errors.Annotate(err, "serializing model representation")
 	}
+
+	// Make sure an existing credential can see all of the
+	// environment's instances before relying on it. This is checked
+	// before the model is imported and the tags are upgraded, so a
+	// failure leaves nothing to clean up.
+	if c.targetModel.existingCredential != "" {
+		problems, err := targetAPI.CheckInstances(bytes)
+		if err != nil {
+			return errors.Annotate(err, "checking instances with existing credential")
+		}
+		if len(problems) > 0 {
+			for _, problem := range problems {
+				logger.Errorf("%v", problem)
+			}
+			return errors.Errorf("credential %q can't see all the environment's instances", c.targetModel.existingCredential)
+		}
+	}
+
 	logger.Debugf("importing model to target controller %s", conn.ControllerTag().Id())
 	err = targetAPI.Import(bytes)
 	// We want to try to clean up the model in the target even if
@@ -224,7 +317,7 @@ func (c *importImplCommand) Run(ctx *cmd.Context) (err error) {
 	for _, app := range model.Applications() {
 		usedCharms.Add(app.CharmURL())
 	}
-	err = transferCharms(st, usedCharms.SortedValues(), targetAPI)
+	err = transferCharms(ctx.Stdout, st, usedCharms.SortedValues(), targetAPI)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -233,6 +326,49 @@ func (c *importImplCommand) Run(ctx *cmd.Context) (err error) {
 	return nil
 }
 
+// makeModelInfo returns the details of the 1.25 environment needed for
+// the target controller's prechecks, taking the name and owner from
+// the overrides if they're set.
+func makeModelInfo(st *state.State, overrides state.ExportOverrides) (coremigration.ModelInfo, error) {
+	env, err := st.Environment()
+	if err != nil {
+		return coremigration.ModelInfo{}, errors.Trace(err)
+	}
+	config, err := st.EnvironConfig()
+	if err != nil {
+		return coremigration.ModelInfo{}, errors.Trace(err)
+	}
+	agentVersion, ok := config.AgentVersion()
+	if !ok {
+		return coremigration.ModelInfo{}, errors.New("no environment agent version")
+	}
+	// The 1.25 state server is the source controller, so it has the
+	// same version as the environment.
+	sourceVersion, err := version.Parse(agentVersion.String())
+	if err != nil {
+		return coremigration.ModelInfo{}, errors.Trace(err)
+	}
+	name := env.Name()
+	if overrides.ModelName != "" {
+		name = overrides.ModelName
+	}
+	ownerTag := overrides.Owner
+	if ownerTag == (names2.UserTag{}) {
+		owner := env.Owner()
+		ownerTag = names2.NewUserTag(owner.Canonical())
+		if owner.IsLocal() {
+			ownerTag = names2.NewUserTag(owner.Name())
+		}
+	}
+	return coremigration.ModelInfo{
+		UUID:                   env.UUID(),
+		Name:                   name,
+		Owner:                  ownerTag,
+		AgentVersion:           sourceVersion,
+		ControllerAgentVersion: sourceVersion,
+	}, nil
+}
+
 func updateToolsInModel(model description.Model, tw *toolsWrangler) ([]string, error) {
 	allTools := set.NewStrings()
 	for _, machine := range model.Machines() {
@@ -271,50 +407,6 @@ func agentToolsFromTools(t *coretools.Tools) description.AgentToolsArgs {
 	}
 }
 
-func transferCharms(st *state.State, charms []string, targetAPI *migrationtarget.Client) error {
-	store := storage.NewStorage(st.EnvironUUID(), st.MongoSession())
-	for _, curl := range charms {
-		logger.Debugf("uploading charm %q", curl)
-		if err := transferCharm(st, store, curl, targetAPI); err != nil {
-			return errors.Annotatef(err, "uploading charm %q", curl)
-		}
-	}
-	return nil
-}
-
-func transferCharm(st *state.State, store storage.Storage, curlString string, targetAPI *migrationtarget.Client) error {
-	curl, err := charmv5.ParseURL(curlString)
-	if err != nil {
-		return errors.Trace(err)
-	}
-	ch, err := st.Charm(curl)
-	if err != nil {
-		return errors.Trace(err)
-	}
-	reader, _, err := store.Get(ch.StoragePath())
-	if err != nil {
-		return errors.Trace(err)
-	}
-	defer reader.Close()
-
-	localFile, err := ioutil.TempFile("", "charm-"+ch.URL().Name)
-	if err != nil {
-		return errors.Trace(err)
-	}
-	defer localFile.Close()
-
-	_, err = io.Copy(localFile, reader)
-	if err != nil {
-		return errors.Trace(err)
-	}
-	_, err = localFile.Seek(0, io.SeekStart)
-	if err != nil {
-		return errors.Trace(err)
-	}
-	_, err = targetAPI.UploadCharm(st.EnvironUUID(), toV6(curl), localFile)
-	return errors.Trace(err)
-}
-
 func toV6(v5 *charmv5.URL) *charmv6.URL {
 	return &charmv6.URL{
 		Schema:   v5.Schema,
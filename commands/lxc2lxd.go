@@ -72,11 +72,14 @@ python3 /var/lib/juju/1.25-upgrade/scripts/lxc-to-lxd %s
 `, aptCmd, LXCMigrationScript, strings.Join(args, " "))
 
 	// write lxc-to-lxd output to stderr,
-	// prefixed by the host name.
-	output := &prefixWriter{
+	// prefixed by the host name, and to the
+	// host's log.
+	machineLog := reporter.machineLog("lxc-to-lxd", host.Id())
+	defer machineLog.Close()
+	output := io.MultiWriter(machineLog, &prefixWriter{
 		Writer: os.Stderr,
 		prefix: fmt.Sprintf("(machine %s) ", host.Id()),
-	}
+	})
 
 	hostAddr, err := getMachineAddress(host)
 	if err != nil {
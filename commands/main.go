@@ -5,16 +5,23 @@ package commands
 
 import (
 	"os"
+	"path"
 
 	"github.com/juju/cmd"
 	"github.com/juju/loggo"
 	"github.com/juju/version"
 )
 
-const (
-	toolsDir  = "/home/ubuntu/juju-1.25-upgrade-tools"
-	toolsFile = "downloaded-tools.txt"
-)
+const toolsFile = "downloaded-tools.txt"
+
+// toolsDirName is the name of the directory in the SSH user's home on
+// the API server machine where the tools are downloaded to, and the
+// upgrade config and saved machines are written.
+const toolsDirName = "juju-1.25-upgrade-tools"
+
+// toolsDir is the path of the tools directory. It's changed by --home
+// and --via.
+var toolsDir = path.Join(homeDir(defaultSSHUser), toolsDirName)
 
 var (
 	logger          = loggo.GetLogger("upgrader")
@@ -30,7 +37,8 @@ func NewUpgradeCommand(ctx *cmd.Context) cmd.Command {
 		Log: &cmd.Log{
 			DefaultConfig: os.Getenv("JUJU_LOGGING_CONFIG"),
 		},
-		Version: upgraderVersion.String(),
+		Version:         upgraderVersion.String(),
+		MissingCallback: runHiddenCommand,
 	})
 	registerCommands(upgrader)
 	return upgrader
@@ -41,6 +49,8 @@ func registerCommands(super *cmd.SuperCommand) {
 	super.Register(newVerifySourceImplCommand())
 	super.Register(newDumpSourceDBCommand())
 	super.Register(newDumpSourceDBImplCommand())
+	super.Register(newAnalyseCharmsCommand())
+	super.Register(newAnalyseCharmsImplCommand())
 	super.Register(newAgentStatusCommand())
 	super.Register(newAgentStatusImplCommand())
 	super.Register(newStartAgentsCommand())
@@ -57,12 +67,36 @@ func registerCommands(super *cmd.SuperCommand) {
 	super.Register(newMigrateLXCImplCommand())
 	super.Register(newAbortCommand())
 	super.Register(newAbortImplCommand())
+	super.Register(newTagsStatusCommand())
+	super.Register(newTagsStatusImplCommand())
 	super.Register(newUpdateMAASAgentNameCommand())
 	super.Register(newUpdateMAASAgentNameImplCommand())
 	super.Register(newImportCommand())
 	super.Register(newImportImplCommand())
+	super.Register(newCompareCommand())
+	super.Register(newCompareImplCommand())
 	super.Register(newActivateCommand())
 	super.Register(newActivateImplCommand())
 	super.Register(newRevertLXDCommand())
 	super.Register(newRevertLXDImplCommand())
 }
+
+// hiddenCommands holds the commands that are only run by the plugin
+// itself. They aren't registered, so they're left out of the help.
+var hiddenCommands = map[string]func() cmd.Command{
+	"agent-upgrade-local": newAgentUpgradeLocalCommand,
+}
+
+// runHiddenCommand is the supercommand's MissingCallback, which runs
+// the hidden commands.
+func runHiddenCommand(ctx *cmd.Context, subcommand string, args []string) error {
+	newCommand, ok := hiddenCommands[subcommand]
+	if !ok {
+		return &cmd.UnrecognizedCommand{Name: subcommand}
+	}
+	// Main reports any error itself.
+	if code := cmd.Main(newCommand(), ctx, args); code != 0 {
+		return cmd.ErrSilent
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+
+	"github.com/juju/cmd"
+	gc "gopkg.in/check.v1"
+)
+
+type mainSuite struct{}
+
+var _ = gc.Suite(&mainSuite{})
+
+func runUpgradeCommand(c *gc.C, args ...string) (int, string) {
+	var out bytes.Buffer
+	ctx := &cmd.Context{Dir: c.MkDir(), Stdout: &out, Stderr: &out}
+	code := cmd.Main(NewUpgradeCommand(ctx), ctx, args)
+	return code, out.String()
+}
+
+func (*mainSuite) TestHiddenCommandsNotInHelp(c *gc.C) {
+	code, out := runUpgradeCommand(c, "help", "commands")
+	c.Assert(code, gc.Equals, 0)
+	c.Check(out, gc.Matches, "(?s).*upgrade-agents.*")
+	c.Check(out, gc.Not(gc.Matches), "(?s).*agent-upgrade-local.*")
+}
+
+func (*mainSuite) TestHiddenCommandRuns(c *gc.C) {
+	// The command's own flags are parsed, so it's been found.
+	code, out := runUpgradeCommand(c, "agent-upgrade-local", "--no-such-flag")
+	c.Check(code, gc.Equals, 1)
+	c.Check(out, gc.Matches, "(?s).*flag provided but not defined: --no-such-flag.*")
+}
+
+func (*mainSuite) TestUnknownCommand(c *gc.C) {
+	code, out := runUpgradeCommand(c, "no-such-command")
+	c.Check(code, gc.Not(gc.Equals), 0)
+	c.Check(out, gc.Matches, `(?s).*unrecognized command: .*no-such-command.*`)
+}
@@ -126,6 +126,9 @@ func (c *migrateLXCImplCommand) Run(ctx *cmd.Context) error {
 		return errors.Annotate(err, "getting state")
 	}
 	defer st.Close()
+	if err := addressSelection.loadSpaces(st); err != nil {
+		return errors.Annotate(err, "loading address policy")
+	}
 
 	// Collect LXC container machines by host.
 	lxcByHost, err := getLXCContainersFromState(st)
@@ -381,6 +384,7 @@ func migrateLXCContainers(lxcByHost map[*state.Machine][]*state.Machine) error {
 		// TODO(axw) option to copy rootfs?
 		MoveRootfs: true,
 	}
+	reporter.startPhase("LXC migration", len(lxcByHost))
 	var group errgroup.Group
 	for host, containers := range lxcByHost {
 		containerNames := make([]string, len(containers))
@@ -390,10 +394,9 @@ func migrateLXCContainers(lxcByHost map[*state.Machine][]*state.Machine) error {
 		logger.Debugf("migrating LXC containers: %s", strings.Join(containerNames, ", "))
 		host, containers := host, containers // copy for closure
 		group.Go(func() error {
-			return errors.Annotatef(
-				MigrateLXC(containers, host, opts),
-				"migrating LXC containers: %s", strings.Join(containerNames, ", "),
-			)
+			err := MigrateLXC(containers, host, opts)
+			reporter.finished("LXC migration", host.Id(), 0, err)
+			return errors.Annotatef(err, "migrating LXC containers: %s", strings.Join(containerNames, ", "))
 		})
 	}
 	return group.Wait()
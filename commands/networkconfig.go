@@ -0,0 +1,303 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/juju/description"
+	"github.com/juju/errors"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+	version1 "github.com/juju/1.25-upgrade/juju1/version"
+	"github.com/juju/1.25-upgrade/juju2/apiserver/common/networkingcommon"
+	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+	"github.com/juju/1.25-upgrade/juju2/network"
+)
+
+// networkConfigSeparator divides the sections of the output of
+// networkConfigScript.
+const networkConfigSeparator = "--- juju-network-config ---"
+
+// networkConfigScript prints the machine's links, their addresses and
+// the device types recorded in sysfs (for bridges, bonds and VLANs).
+// It uses the one line output formats rather than -json, since the
+// iproute2 on trusty doesn't support it.
+const networkConfigScript = `
+ip -o link show
+echo '` + networkConfigSeparator + `'
+ip -o addr show
+echo '` + networkConfigSeparator + `'
+grep -H '^DEVTYPE=' /sys/class/net/*/uevent || true
+`
+
+// addObservedNetworkEntities adds link-layer devices and IP addresses
+// to the model description from the network configuration observed on
+// each machine and container, as a 2.x machine agent would report it.
+// This is used for providers that 1.25-upgrade can't ask for the
+// devices. Machines the configuration can't be read from are logged
+// and left out; their agents will fill it in once they're upgraded.
+func addObservedNetworkEntities(model description.Model, machines []FlatMachine) error {
+	var targets []FlatMachine
+	for _, machine := range machines {
+		osType, err := version1.GetOSFromSeries(machine.Series)
+		if err != nil || osType == version1.Windows {
+			logger.Infof("not collecting network config from machine %s (series %q)", machine.ID, machine.Series)
+			continue
+		}
+		targets = append(targets, machine)
+	}
+	results, err := parallelExec("network config", flatMachineExecTargets(targets...), networkConfigScript)
+	if err != nil {
+		return errors.Annotate(err, "reading network config")
+	}
+	for i, result := range results {
+		machineID := targets[i].ID
+		if result.Code != 0 {
+			logger.Warningf("couldn't read network config from machine %s: exited with %d: %s",
+				machineID, result.Code, strings.TrimSpace(result.Stderr))
+			continue
+		}
+		networkConfig, err := parseNetworkConfig(result.Stdout)
+		if err != nil {
+			logger.Warningf("couldn't read network config from machine %s: %v", machineID, err)
+			continue
+		}
+		if err := addNetworkConfig(model, state.LXDMachineId(machineID), networkConfig); err != nil {
+			return errors.Annotatef(err, "adding network config for machine %s", machineID)
+		}
+	}
+	return nil
+}
+
+// addNetworkConfig adds the link-layer devices and IP addresses in
+// networkConfig to the model description for the given machine.
+func addNetworkConfig(model description.Model, machineID string, networkConfig []params.NetworkConfig) error {
+	devicesArgs, devicesAddrs := networkingcommon.NetworkConfigsToStateArgs(networkConfig)
+	for _, d := range devicesArgs {
+		model.AddLinkLayerDevice(description.LinkLayerDeviceArgs{
+			Name:        d.Name,
+			MTU:         d.MTU,
+			ProviderID:  string(d.ProviderID),
+			MachineID:   machineID,
+			Type:        string(d.Type),
+			MACAddress:  d.MACAddress,
+			IsAutoStart: d.IsAutoStart,
+			IsUp:        d.IsUp,
+			ParentName:  d.ParentName,
+		})
+	}
+	for _, d := range devicesAddrs {
+		ip, ipNet, err := net.ParseCIDR(d.CIDRAddress)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		model.AddIPAddress(description.IPAddressArgs{
+			ProviderID:       string(d.ProviderID),
+			DeviceName:       d.DeviceName,
+			MachineID:        machineID,
+			SubnetCIDR:       ipNet.String(),
+			ConfigMethod:     string(d.ConfigMethod),
+			Value:            ip.String(),
+			DNSServers:       d.DNSServers,
+			DNSSearchDomains: d.DNSSearchDomains,
+			GatewayAddress:   d.GatewayAddress,
+		})
+	}
+	return nil
+}
+
+// observedLink holds what "ip -o link show" reports about a device.
+type observedLink struct {
+	index      int
+	name       string
+	mtu        int
+	mac        string
+	master     string
+	isUp       bool
+	isLoopback bool
+}
+
+// parseNetworkConfig converts the output of networkConfigScript into
+// network config in the same form as the 2.x machiner's observed
+// config: one entry per address (or one for a device without
+// addresses), grouped by device in link order, with bridge ports
+// parented to their bridge.
+func parseNetworkConfig(output string) ([]params.NetworkConfig, error) {
+	sections := strings.Split(output, networkConfigSeparator+"\n")
+	if len(sections) != 3 {
+		return nil, errors.Errorf("expected 3 sections in output, got %d", len(sections))
+	}
+	links, err := parseLinks(sections[0])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	addrs, err := parseAddrs(sections[1])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	devTypes := parseDevTypes(sections[2])
+
+	var result []params.NetworkConfig
+	for _, link := range links {
+		config := params.NetworkConfig{
+			DeviceIndex:   link.index,
+			MACAddress:    link.mac,
+			MTU:           link.mtu,
+			InterfaceName: link.name,
+			InterfaceType: string(network.EthernetInterface),
+			ConfigType:    string(network.ConfigManual),
+			NoAutoStart:   !link.isUp,
+			Disabled:      !link.isUp,
+		}
+		if devType, ok := devTypes[link.name]; ok {
+			config.InterfaceType = string(devType)
+		} else if link.isLoopback {
+			config.InterfaceType = string(network.LoopbackInterface)
+			config.ConfigType = string(network.ConfigLoopback)
+		}
+		if devTypes[link.master] == network.BridgeInterface {
+			config.ParentInterfaceName = link.master
+		}
+		if len(addrs[link.name]) == 0 {
+			result = append(result, config)
+			continue
+		}
+		for _, addr := range addrs[link.name] {
+			addrConfig := config
+			addrConfig.Address = addr.IP.String()
+			if addr.Mask != nil {
+				addrConfig.CIDR = (&net.IPNet{IP: addr.IP.Mask(addr.Mask), Mask: addr.Mask}).String()
+			}
+			if config.ConfigType != string(network.ConfigLoopback) {
+				addrConfig.ConfigType = string(network.ConfigStatic)
+			}
+			result = append(result, addrConfig)
+		}
+	}
+	return result, nil
+}
+
+// oneLineFields splits a line of "ip -o" output into fields. The
+// lines use backslashes to mark where ip would otherwise have started
+// a new line.
+func oneLineFields(line string) []string {
+	return strings.Fields(strings.Replace(line, `\`, " ", -1))
+}
+
+// parseLinks parses lines like:
+//
+//	2: eth0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc pfifo_fast master br-eth0 state UP mode DEFAULT group default qlen 1000\    link/ether 52:54:00:12:34:56 brd ff:ff:ff:ff:ff:ff
+func parseLinks(output string) ([]observedLink, error) {
+	var links []observedLink
+	for _, line := range strings.Split(output, "\n") {
+		fields := oneLineFields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimSuffix(fields[0], ":"))
+		if err != nil {
+			return nil, errors.Errorf("unexpected link line %q", line)
+		}
+		link := observedLink{
+			index: index,
+			name:  linkName(fields[1]),
+		}
+		flags := strings.Split(strings.Trim(fields[2], "<>"), ",")
+		for _, flag := range flags {
+			switch flag {
+			case "UP":
+				link.isUp = true
+			case "LOOPBACK":
+				link.isLoopback = true
+			}
+		}
+		for i := 3; i+1 < len(fields); i++ {
+			value := fields[i+1]
+			switch fields[i] {
+			case "mtu":
+				link.mtu, err = strconv.Atoi(value)
+				if err != nil {
+					return nil, errors.Errorf("unexpected mtu in link line %q", line)
+				}
+			case "master":
+				link.master = value
+			case "link/ether":
+				link.mac = value
+			}
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// linkName strips the trailing colon and the "@parent" that ip shows
+// for VLANs and veth pairs, so "eth0.100@eth0:" becomes "eth0.100".
+func linkName(field string) string {
+	name := strings.TrimSuffix(field, ":")
+	if i := strings.Index(name, "@"); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// parseAddrs parses lines like:
+//
+//	2: eth0    inet 10.0.0.5/24 brd 10.0.0.255 scope global eth0\       valid_lft forever preferred_lft forever
+//
+// returning the addresses on each device. IPv6 link-local addresses
+// are left out, as they are by the 2.x machiner.
+func parseAddrs(output string) (map[string][]net.IPNet, error) {
+	addrs := make(map[string][]net.IPNet)
+	for _, line := range strings.Split(output, "\n") {
+		fields := oneLineFields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		if fields[2] != "inet" && fields[2] != "inet6" {
+			continue
+		}
+		name := linkName(fields[1])
+		ip, ipNet, err := net.ParseCIDR(fields[3])
+		if err != nil {
+			// Point-to-point addresses are shown without a prefix.
+			if ip = net.ParseIP(fields[3]); ip == nil {
+				return nil, errors.Errorf("unexpected address in line %q", line)
+			}
+			ipNet = &net.IPNet{}
+		}
+		if ip.To4() == nil && ip.IsLinkLocalUnicast() {
+			continue
+		}
+		addrs[name] = append(addrs[name], net.IPNet{IP: ip, Mask: ipNet.Mask})
+	}
+	return addrs, nil
+}
+
+// parseDevTypes parses lines like:
+//
+//	/sys/class/net/br-eth0/uevent:DEVTYPE=bridge
+//
+// returning the bridge, bond and VLAN devices.
+func parseDevTypes(output string) map[string]network.InterfaceType {
+	devTypes := make(map[string]network.InterfaceType)
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), ":DEVTYPE=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := strings.TrimPrefix(strings.TrimSuffix(parts[0], "/uevent"), "/sys/class/net/")
+		switch parts[1] {
+		case "bridge":
+			devTypes[name] = network.BridgeInterface
+		case "bond":
+			devTypes[name] = network.BondInterface
+		case "vlan":
+			devTypes[name] = network.VLAN_8021QInterface
+		}
+	}
+	return devTypes
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"github.com/juju/description"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	names2 "gopkg.in/juju/names.v2"
+
+	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+)
+
+type networkConfigSuite struct{}
+
+var _ = gc.Suite(&networkConfigSuite{})
+
+const observedNetworkConfig = `1: lo: <LOOPBACK,UP,LOWER_UP> mtu 65536 qdisc noqueue state UNKNOWN mode DEFAULT group default \    link/loopback 00:00:00:00:00:00 brd 00:00:00:00:00:00
+2: eth0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc pfifo_fast master br-eth0 state UP mode DEFAULT group default qlen 1000\    link/ether 52:54:00:12:34:56 brd ff:ff:ff:ff:ff:ff
+3: eth1: <BROADCAST,MULTICAST> mtu 1500 qdisc noop state DOWN mode DEFAULT group default qlen 1000\    link/ether 52:54:00:12:34:57 brd ff:ff:ff:ff:ff:ff
+4: br-eth0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc noqueue state UP mode DEFAULT group default \    link/ether 52:54:00:12:34:56 brd ff:ff:ff:ff:ff:ff
+5: br-eth0.100@br-eth0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc noqueue state UP mode DEFAULT group default \    link/ether 52:54:00:12:34:56 brd ff:ff:ff:ff:ff:ff
+--- juju-network-config ---
+1: lo    inet 127.0.0.1/8 scope host lo\       valid_lft forever preferred_lft forever
+1: lo    inet6 ::1/128 scope host \       valid_lft forever preferred_lft forever
+4: br-eth0    inet 10.0.0.5/24 brd 10.0.0.255 scope global br-eth0\       valid_lft forever preferred_lft forever
+4: br-eth0    inet6 fe80::5054:ff:fe12:3456/64 scope link \       valid_lft forever preferred_lft forever
+5: br-eth0.100    inet 10.100.0.5/24 brd 10.100.0.255 scope global br-eth0.100\       valid_lft forever preferred_lft forever
+--- juju-network-config ---
+/sys/class/net/br-eth0/uevent:DEVTYPE=bridge
+/sys/class/net/br-eth0.100/uevent:DEVTYPE=vlan
+`
+
+func (*networkConfigSuite) TestParse(c *gc.C) {
+	config, err := parseNetworkConfig(observedNetworkConfig)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(config, jc.DeepEquals, []params.NetworkConfig{{
+		DeviceIndex:   1,
+		MTU:           65536,
+		InterfaceName: "lo",
+		InterfaceType: "loopback",
+		ConfigType:    "loopback",
+		CIDR:          "127.0.0.0/8",
+		Address:       "127.0.0.1",
+	}, {
+		DeviceIndex:   1,
+		MTU:           65536,
+		InterfaceName: "lo",
+		InterfaceType: "loopback",
+		ConfigType:    "loopback",
+		CIDR:          "::1/128",
+		Address:       "::1",
+	}, {
+		DeviceIndex:         2,
+		MACAddress:          "52:54:00:12:34:56",
+		MTU:                 1500,
+		InterfaceName:       "eth0",
+		ParentInterfaceName: "br-eth0",
+		InterfaceType:       "ethernet",
+		ConfigType:          "manual",
+	}, {
+		DeviceIndex:   3,
+		MACAddress:    "52:54:00:12:34:57",
+		MTU:           1500,
+		InterfaceName: "eth1",
+		InterfaceType: "ethernet",
+		ConfigType:    "manual",
+		Disabled:      true,
+		NoAutoStart:   true,
+	}, {
+		DeviceIndex:   4,
+		MACAddress:    "52:54:00:12:34:56",
+		MTU:           1500,
+		InterfaceName: "br-eth0",
+		InterfaceType: "bridge",
+		ConfigType:    "static",
+		CIDR:          "10.0.0.0/24",
+		Address:       "10.0.0.5",
+	}, {
+		DeviceIndex:   5,
+		MACAddress:    "52:54:00:12:34:56",
+		MTU:           1500,
+		InterfaceName: "br-eth0.100",
+		InterfaceType: "802.1q",
+		ConfigType:    "static",
+		CIDR:          "10.100.0.0/24",
+		Address:       "10.100.0.5",
+	}})
+}
+
+func (*networkConfigSuite) TestParseTruncated(c *gc.C) {
+	_, err := parseNetworkConfig("1: lo: <LOOPBACK,UP,LOWER_UP> mtu 65536\n")
+	c.Assert(err, gc.ErrorMatches, "expected 3 sections in output, got 1")
+}
+
+func (*networkConfigSuite) TestAddToModel(c *gc.C) {
+	config, err := parseNetworkConfig(observedNetworkConfig)
+	c.Assert(err, jc.ErrorIsNil)
+	model := description.NewModel(description.ModelArgs{
+		Owner:  names2.NewUserTag("admin"),
+		Config: map[string]interface{}{"name": "model", "uuid": "model-uuid"},
+	})
+	err = addNetworkConfig(model, "0/lxd/1", config)
+	c.Assert(err, jc.ErrorIsNil)
+
+	devices := model.LinkLayerDevices()
+	c.Assert(devices, gc.HasLen, 5)
+	c.Check(devices[1].Name(), gc.Equals, "eth0")
+	c.Check(devices[1].MachineID(), gc.Equals, "0/lxd/1")
+	c.Check(devices[1].ParentName(), gc.Equals, "br-eth0")
+	c.Check(devices[1].IsUp(), jc.IsTrue)
+	c.Check(devices[2].IsUp(), jc.IsFalse)
+
+	addrs := model.IPAddresses()
+	c.Assert(addrs, gc.HasLen, 4)
+	c.Check(addrs[2].DeviceName(), gc.Equals, "br-eth0")
+	c.Check(addrs[2].MachineID(), gc.Equals, "0/lxd/1")
+	c.Check(addrs[2].Value(), gc.Equals, "10.0.0.5")
+	c.Check(addrs[2].SubnetCIDR(), gc.Equals, "10.0.0.0/24")
+	c.Check(addrs[2].ConfigMethod(), gc.Equals, "static")
+}
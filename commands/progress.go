@@ -0,0 +1,236 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// progressMarker starts each line of the progress events that remote
+// commands write to stderr. The client picks them out of the output
+// and shows the progress of each phase instead.
+const progressMarker = "@@1.25-upgrade-progress "
+
+// progressEvent is written by a remote command when a phase starts
+// (with the number of machines it runs on) and when a machine
+// finishes the phase.
+type progressEvent struct {
+	Phase   string `json:"phase"`
+	Total   int    `json:"total,omitempty"`
+	Machine string `json:"machine,omitempty"`
+	Code    int    `json:"code,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// execReporter reports the progress of the phases run on the machines
+// in the environment and keeps a log of each machine's output. It's
+// configured by the --progress and --log-dir flags of the remote
+// commands.
+type execReporter struct {
+	mu       sync.Mutex
+	progress bool
+	logDir   string
+	out      io.Writer
+}
+
+var reporter = &execReporter{out: os.Stderr}
+
+// startPhase reports that the phase is starting on total machines.
+func (r *execReporter) startPhase(phase string, total int) {
+	r.write(progressEvent{Phase: phase, Total: total})
+}
+
+// finished reports that the phase has finished on the machine, with
+// the given exit code or error.
+func (r *execReporter) finished(phase, machine string, code int, err error) {
+	event := progressEvent{Phase: phase, Machine: machine, Code: code}
+	if err != nil {
+		event.Code = -1
+		event.Error = err.Error()
+	}
+	r.write(event)
+}
+
+func (r *execReporter) write(event progressEvent) {
+	if !r.progress {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		logger.Warningf("couldn't report progress: %v", err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.out, "%s%s\n", progressMarker, data)
+}
+
+// machineLog returns a writer that appends to the machine's log file,
+// after writing a header for the phase. If there's no log directory
+// the output is discarded.
+func (r *execReporter) machineLog(phase, machine string) io.WriteCloser {
+	if r.logDir == "" || machine == "" {
+		return nopWriteCloser{ioutil.Discard}
+	}
+	if err := os.MkdirAll(r.logDir, 0755); err != nil {
+		logger.Warningf("couldn't create log directory: %v", err)
+		return nopWriteCloser{ioutil.Discard}
+	}
+	name := "machine-" + strings.Replace(machine, "/", "-", -1) + ".log"
+	f, err := os.OpenFile(filepath.Join(r.logDir, name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		logger.Warningf("couldn't open log for machine %s: %v", machine, err)
+		return nopWriteCloser{ioutil.Discard}
+	}
+	fmt.Fprintf(f, "=== %s %s\n", time.Now().UTC().Format(time.RFC3339), phase)
+	return f
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// maxFailedShown is the number of failed machines listed in a phase
+// summary.
+const maxFailedShown = 5
+
+// phaseProgress holds the client's view of a phase.
+type phaseProgress struct {
+	name    string
+	total   int
+	done    int
+	failed  []string
+	started time.Time
+}
+
+// progressWriter sits between the client and the remote command's
+// stderr. It passes the output through, except for progress events,
+// which it turns into a summary line for the current phase. The
+// summary is written when the phase starts, at most every interval
+// while it runs, and when it finishes; failures are written as soon as
+// they're reported.
+type progressWriter struct {
+	out      io.Writer
+	interval time.Duration
+	now      func() time.Time
+
+	partial   []byte
+	phase     *phaseProgress
+	lastShown time.Time
+}
+
+func newProgressWriter(out io.Writer) *progressWriter {
+	return &progressWriter{
+		out:      out,
+		interval: 10 * time.Second,
+		now:      time.Now,
+	}
+}
+
+// Write is part of io.Writer.
+func (w *progressWriter) Write(data []byte) (int, error) {
+	n := len(data)
+	w.partial = append(w.partial, data...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := w.partial[:i+1]
+		w.partial = w.partial[i+1:]
+		if err := w.writeLine(line); err != nil {
+			return 0, errors.Trace(err)
+		}
+	}
+	return n, nil
+}
+
+// Flush writes out anything left over that doesn't end in a newline.
+func (w *progressWriter) Flush() error {
+	if len(w.partial) == 0 {
+		return nil
+	}
+	_, err := w.out.Write(w.partial)
+	w.partial = nil
+	return errors.Trace(err)
+}
+
+func (w *progressWriter) writeLine(line []byte) error {
+	if !bytes.HasPrefix(line, []byte(progressMarker)) {
+		_, err := w.out.Write(line)
+		return errors.Trace(err)
+	}
+	var event progressEvent
+	if err := json.Unmarshal(line[len(progressMarker):], &event); err != nil {
+		logger.Debugf("ignoring bad progress event %q: %v", line, err)
+		return nil
+	}
+	now := w.now()
+	if event.Machine == "" {
+		w.phase = &phaseProgress{name: event.Phase, total: event.Total, started: now}
+		return w.showPhase(now)
+	}
+	if w.phase == nil || w.phase.name != event.Phase {
+		// Not a phase we know about; just count it.
+		w.phase = &phaseProgress{name: event.Phase, started: now}
+	}
+	w.phase.done++
+	if event.Code != 0 {
+		w.phase.failed = append(w.phase.failed, event.Machine)
+		reason := fmt.Sprintf("exited with %d", event.Code)
+		if event.Error != "" {
+			reason = event.Error
+		}
+		if _, err := fmt.Fprintf(w.out, "%s failed on machine %s: %s\n", event.Phase, event.Machine, reason); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if w.phase.done >= w.phase.total || now.Sub(w.lastShown) >= w.interval {
+		return w.showPhase(now)
+	}
+	return nil
+}
+
+func (w *progressWriter) showPhase(now time.Time) error {
+	w.lastShown = now
+	_, err := fmt.Fprintln(w.out, w.phase.summary(now))
+	return errors.Trace(err)
+}
+
+// summary returns a line like:
+//
+//	upgrade: 120/300 machines done, 2 failed (3, 7/lxd/1), about 4m10s left
+func (p *phaseProgress) summary(now time.Time) string {
+	parts := []string{fmt.Sprintf("%s: %d/%d machines done", p.name, p.done, p.total)}
+	if len(p.failed) > 0 {
+		failed := p.failed
+		more := ""
+		if len(failed) > maxFailedShown {
+			failed = failed[:maxFailedShown]
+			more = fmt.Sprintf(" and %d more", len(p.failed)-maxFailedShown)
+		}
+		parts = append(parts, fmt.Sprintf("%d failed (%s%s)", len(p.failed), strings.Join(failed, ", "), more))
+	}
+	if p.done > 0 && p.done < p.total {
+		elapsed := now.Sub(p.started)
+		left := elapsed / time.Duration(p.done) * time.Duration(p.total-p.done)
+		parts = append(parts, fmt.Sprintf("about %s left", left/time.Second*time.Second))
+	}
+	return strings.Join(parts, ", ")
+}
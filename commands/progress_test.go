@@ -0,0 +1,100 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type progressSuite struct{}
+
+var _ = gc.Suite(&progressSuite{})
+
+func (*progressSuite) TestProgressWriter(c *gc.C) {
+	var events bytes.Buffer
+	r := &execReporter{progress: true, out: &events}
+	r.startPhase("upgrade", 3)
+	r.finished("upgrade", "0", 0, nil)
+	r.finished("upgrade", "1", 1, nil)
+	r.finished("upgrade", "2/lxc/0", 0, errors.New("connection refused"))
+	lines := bytes.SplitAfter(events.Bytes(), []byte("\n"))
+
+	var out bytes.Buffer
+	start := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	w := newProgressWriter(&out)
+	w.now = func() time.Time { return now }
+	write := func(data []byte) {
+		_, err := w.Write(data)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+
+	write([]byte("some output\npart"))
+	write([]byte("ial\n"))
+	write(lines[0])
+	now = start.Add(5 * time.Second)
+	write(lines[1])
+	now = start.Add(12 * time.Second)
+	write(lines[2])
+	now = start.Add(13 * time.Second)
+	write(lines[3])
+	write([]byte("no newline"))
+	c.Assert(w.Flush(), jc.ErrorIsNil)
+
+	c.Assert(out.String(), gc.Equals, ""+
+		"some output\n"+
+		"partial\n"+
+		"upgrade: 0/3 machines done\n"+
+		"upgrade failed on machine 1: exited with 1\n"+
+		"upgrade: 2/3 machines done, 1 failed (1), about 6s left\n"+
+		"upgrade failed on machine 2/lxc/0: connection refused\n"+
+		"upgrade: 3/3 machines done, 2 failed (1, 2/lxc/0)\n"+
+		"no newline")
+}
+
+func (*progressSuite) TestReporterWithoutProgress(c *gc.C) {
+	var events bytes.Buffer
+	r := &execReporter{out: &events}
+	r.startPhase("upgrade", 3)
+	r.finished("upgrade", "0", 0, nil)
+	c.Assert(events.String(), gc.Equals, "")
+}
+
+func (*progressSuite) TestSummaryFailures(c *gc.C) {
+	start := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	p := phaseProgress{
+		name:    "copy tools",
+		total:   10,
+		done:    7,
+		failed:  []string{"1", "2", "3", "4", "5", "6", "7"},
+		started: start,
+	}
+	c.Assert(p.summary(start.Add(70*time.Second)), gc.Equals,
+		"copy tools: 7/10 machines done, 7 failed (1, 2, 3, 4, 5 and 2 more), about 30s left")
+}
+
+func (*progressSuite) TestMachineLog(c *gc.C) {
+	dir := c.MkDir()
+	r := &execReporter{logDir: filepath.Join(dir, "logs")}
+	for _, phase := range []string{"copy tools", "upgrade"} {
+		w := r.machineLog(phase, "1/lxc/0")
+		_, err := w.Write([]byte(phase + " output\n"))
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(w.Close(), jc.ErrorIsNil)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "logs", "machine-1-lxc-0.log"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Matches, ""+
+		"=== .* copy tools\n"+
+		"copy tools output\n"+
+		"=== .* upgrade\n"+
+		"upgrade output\n")
+}
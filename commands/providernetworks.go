@@ -0,0 +1,167 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"github.com/juju/description"
+	"github.com/juju/errors"
+	"github.com/juju/utils/set"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+	"github.com/juju/1.25-upgrade/juju2/environs"
+	"github.com/juju/1.25-upgrade/juju2/instance"
+	"github.com/juju/1.25-upgrade/juju2/network"
+)
+
+// networkSpace is a 1.25 space and the CIDRs of its subnets.
+type networkSpace struct {
+	Name  string
+	CIDRs []string
+}
+
+// getProviderNetworks asks the provider for its spaces and subnets,
+// and matches them up with the environment's. 1.25 doesn't record
+// provider IDs for spaces, so without this the imported spaces
+// wouldn't match the provider's (on MAAS, deploying with --bind
+// would fail). Spaces that can't be matched are reported, but don't
+// stop the export.
+func getProviderNetworks(st *state.State, model description.Model) (state.ProviderNetworks, error) {
+	var result state.ProviderNetworks
+	env, err := newJuju2Environ(model, st)
+	if errors.IsNotSupported(err) {
+		logger.Infof("not getting provider networks: %v", err)
+		return result, nil
+	} else if err != nil {
+		return result, errors.Trace(err)
+	}
+	netenv, ok := environs.SupportsNetworking(env)
+	if !ok {
+		logger.Infof("not getting provider networks: provider doesn't support networking")
+		return result, nil
+	}
+
+	var providerSpaces []network.SpaceInfo
+	var providerSubnets []network.SubnetInfo
+	supportsSpaces, err := netenv.SupportsSpaces()
+	if err != nil && !errors.IsNotSupported(err) {
+		return result, errors.Annotate(err, "checking for spaces support")
+	}
+	if supportsSpaces {
+		// Some providers (like ec2) support spaces without being able
+		// to list them; fall back to their subnets.
+		providerSpaces, err = netenv.Spaces()
+		if errors.IsNotSupported(err) {
+			logger.Infof("not getting provider spaces: %v", err)
+			supportsSpaces = false
+		} else if err != nil {
+			return result, errors.Annotate(err, "getting provider spaces")
+		}
+		for _, space := range providerSpaces {
+			providerSubnets = append(providerSubnets, space.Subnets...)
+		}
+	}
+	if !supportsSpaces {
+		providerSubnets, err = netenv.Subnets(instance.UnknownId, nil)
+		if errors.IsNotSupported(err) {
+			logger.Infof("not getting provider subnets: %v", err)
+		} else if err != nil {
+			return result, errors.Annotate(err, "getting provider subnets")
+		}
+	}
+
+	spaces, err := st.AllSpaces()
+	if err != nil {
+		return result, errors.Trace(err)
+	}
+	subnets, err := st.AllSubnets()
+	if err != nil {
+		return result, errors.Trace(err)
+	}
+	spaceCIDRs := make(map[string][]string)
+	for _, subnet := range subnets {
+		if subnet.SpaceName() != "" {
+			spaceCIDRs[subnet.SpaceName()] = append(spaceCIDRs[subnet.SpaceName()], subnet.CIDR())
+		}
+	}
+	envSpaces := make([]networkSpace, len(spaces))
+	for i, space := range spaces {
+		envSpaces[i] = networkSpace{Name: space.Name(), CIDRs: spaceCIDRs[space.Name()]}
+	}
+
+	result, unmatched := matchProviderNetworks(envSpaces, providerSpaces, providerSubnets)
+	if supportsSpaces {
+		for _, name := range unmatched {
+			logger.Warningf("space %q doesn't match any of the provider's spaces; it will have no provider ID", name)
+		}
+	}
+	return result, nil
+}
+
+// matchProviderNetworks matches the environment's spaces with the
+// provider's, first by name and then by subnets (if all of a space's
+// subnets are in the same provider space), and looks up the
+// provider's details for each subnet by CIDR. Each provider space is
+// only matched once. It returns the names of spaces that couldn't be
+// matched, in the order given.
+func matchProviderNetworks(
+	spaces []networkSpace,
+	providerSpaces []network.SpaceInfo,
+	providerSubnets []network.SubnetInfo,
+) (state.ProviderNetworks, []string) {
+	result := state.ProviderNetworks{
+		SpaceProviderIds: make(map[string]string),
+		Subnets:          make(map[string]state.ProviderSubnet),
+	}
+
+	spaceIdsByName := make(map[string]string)
+	for _, space := range providerSpaces {
+		spaceIdsByName[space.Name] = string(space.ProviderId)
+	}
+	subnetsByCIDR := make(map[string]network.SubnetInfo)
+	for _, subnet := range providerSubnets {
+		if subnet.CIDR != "" {
+			subnetsByCIDR[subnet.CIDR] = subnet
+		}
+	}
+
+	used := set.NewStrings()
+	match := func(space networkSpace) string {
+		if id, found := spaceIdsByName[space.Name]; found && !used.Contains(id) {
+			return id
+		}
+		ids := set.NewStrings()
+		for _, cidr := range space.CIDRs {
+			ids.Add(string(subnetsByCIDR[cidr].SpaceProviderId))
+		}
+		if ids.Size() != 1 {
+			return ""
+		}
+		id := ids.Values()[0]
+		if used.Contains(id) {
+			return ""
+		}
+		return id
+	}
+	var unmatched []string
+	spaceNamesById := make(map[string]string)
+	for _, space := range spaces {
+		id := match(space)
+		if id == "" {
+			unmatched = append(unmatched, space.Name)
+			continue
+		}
+		used.Add(id)
+		result.SpaceProviderIds[space.Name] = id
+		spaceNamesById[id] = space.Name
+	}
+
+	for cidr, subnet := range subnetsByCIDR {
+		result.Subnets[cidr] = state.ProviderSubnet{
+			ProviderId:        string(subnet.ProviderId),
+			ProviderNetworkId: string(subnet.ProviderNetworkId),
+			SpaceName:         spaceNamesById[string(subnet.SpaceProviderId)],
+		}
+	}
+	return result, unmatched
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+	"github.com/juju/1.25-upgrade/juju2/network"
+)
+
+type providerNetworksSuite struct{}
+
+var _ = gc.Suite(&providerNetworksSuite{})
+
+func (*providerNetworksSuite) TestMatchSpaces(c *gc.C) {
+	providerSubnets := []network.SubnetInfo{
+		{CIDR: "10.0.0.0/24", ProviderId: "1", SpaceProviderId: "space-1"},
+		{CIDR: "10.0.1.0/24", ProviderId: "2", SpaceProviderId: "space-2"},
+		{CIDR: "10.0.2.0/24", ProviderId: "3", SpaceProviderId: "space-2"},
+		{CIDR: "10.0.3.0/24", ProviderId: "4", SpaceProviderId: "space-3"},
+	}
+	providerSpaces := []network.SpaceInfo{
+		{Name: "default", ProviderId: "space-1", Subnets: providerSubnets[:1]},
+		{Name: "internal", ProviderId: "space-2", Subnets: providerSubnets[1:3]},
+		{Name: "storage", ProviderId: "space-3", Subnets: providerSubnets[3:]},
+	}
+	networks, unmatched := matchProviderNetworks([]networkSpace{
+		// Matched by name.
+		{Name: "default", CIDRs: []string{"10.0.0.0/24"}},
+		// Matched by subnets.
+		{Name: "db", CIDRs: []string{"10.0.1.0/24", "10.0.2.0/24"}},
+		// Subnets in different spaces.
+		{Name: "mixed", CIDRs: []string{"10.0.0.0/24", "10.0.3.0/24"}},
+		// Subnet unknown to the provider.
+		{Name: "gone", CIDRs: []string{"192.168.0.0/24"}},
+		// The provider space has already been matched.
+		{Name: "internal", CIDRs: []string{"10.0.1.0/24"}},
+	}, providerSpaces, providerSubnets)
+	c.Check(unmatched, jc.DeepEquals, []string{"mixed", "gone", "internal"})
+	c.Check(networks, jc.DeepEquals, state.ProviderNetworks{
+		SpaceProviderIds: map[string]string{
+			"default": "space-1",
+			"db":      "space-2",
+		},
+		Subnets: map[string]state.ProviderSubnet{
+			"10.0.0.0/24": {ProviderId: "1", SpaceName: "default"},
+			"10.0.1.0/24": {ProviderId: "2", SpaceName: "db"},
+			"10.0.2.0/24": {ProviderId: "3", SpaceName: "db"},
+			"10.0.3.0/24": {ProviderId: "4"},
+		},
+	})
+}
+
+func (*providerNetworksSuite) TestMatchSubnetsWithoutSpaces(c *gc.C) {
+	networks, unmatched := matchProviderNetworks([]networkSpace{
+		{Name: "db", CIDRs: []string{"10.0.0.0/24"}},
+	}, nil, []network.SubnetInfo{
+		{CIDR: "10.0.0.0/24", ProviderId: "subnet-1", ProviderNetworkId: "net-1"},
+	})
+	c.Check(unmatched, jc.DeepEquals, []string{"db"})
+	c.Check(networks, jc.DeepEquals, state.ProviderNetworks{
+		SpaceProviderIds: map[string]string{},
+		Subnets: map[string]state.ProviderSubnet{
+			"10.0.0.0/24": {ProviderId: "subnet-1", ProviderNetworkId: "net-1"},
+		},
+	})
+}
@@ -9,12 +9,14 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/juju/cmd"
 	"github.com/juju/errors"
+	"github.com/juju/utils"
+	"github.com/juju/utils/ssh"
 )
 
 func remoteMD5Sum(plugin, address string) (string, error) {
@@ -24,6 +26,7 @@ func remoteMD5Sum(plugin, address string) (string, error) {
 	rc, err := runViaSSH(
 		address,
 		fmt.Sprintf("md5sum %s | cut -f 1 -d ' '\n", pluginBase),
+		withAPIServer(),
 		withStdout(&stdoutBuf),
 	)
 	if err != nil {
@@ -46,16 +49,37 @@ func localMD5Sum(plugin string) (string, error) {
 }
 
 func updateRemotePlugin(plugin, address string) error {
-	scp := exec.Command("scp", "-C", plugin, fmt.Sprintf("ubuntu@%s:~", address))
-	scp.Stdout = os.Stdout
-	scp.Stderr = os.Stderr
-	scp.Stdin = os.Stdin
-	if err := scp.Run(); err != nil {
+	options := newExecOptions(address, withAPIServer())
+	args := []string{"-C", plugin, fmt.Sprintf("%s@%s:~", apiServerSSH.User, address)}
+	if err := ssh.Copy(args, &options.Options); err != nil {
 		return errors.Annotate(err, "copying command to environment")
 	}
 	return nil
 }
 
+// fetchRemoteLogs copies the directory of machine logs from the API
+// server machine into localDir, if the remote command wrote any.
+func fetchRemoteLogs(ctx *cmd.Context, address, remoteDir, localDir string) error {
+	rc, err := runViaSSH(address, "test -d "+utils.ShQuote(remoteDir), withAPIServer(), withStdout(ioutil.Discard))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if rc != 0 {
+		logger.Debugf("no machine logs in %s", remoteDir)
+		return nil
+	}
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	options := newExecOptions(address, withAPIServer())
+	args := []string{"-r", "-q", "-C", fmt.Sprintf("%s@%s:%s", apiServerSSH.User, address, remoteDir), localDir}
+	if err := ssh.Copy(args, &options.Options); err != nil {
+		return errors.Annotate(err, "copying machine logs")
+	}
+	ctx.Infof("machine logs copied to %s", filepath.Join(localDir, path.Base(remoteDir)))
+	return nil
+}
+
 func checkUpdatePlugin(ctx *cmd.Context, plugin, address string) error {
 	ctx.Infof("checking remote plugin")
 	local, err := localMD5Sum(plugin)
@@ -94,8 +94,7 @@ func (c *restoreLXCCommand) Run(ctx *cmd.Context) error {
 		if err != nil {
 			return errors.Trace(err)
 		}
-		rc, err := runViaSSH(
-			c.address,
+		rc, err := c.runRemoteCommand(
 			c.getRemoteCommand(c.remoteCommand, containerName),
 			withStdin(f),
 		)
@@ -172,6 +171,10 @@ func (c *restoreLXCImplCommand) Info() *cmd.Info {
 }
 
 func (c *restoreLXCImplCommand) Init(args []string) error {
+	args, err := c.baseRemoteCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
 	if len(args) > 0 {
 		c.containerName, args = args[0], args[1:]
 	}
@@ -184,6 +187,9 @@ func (c *restoreLXCImplCommand) Run(ctx *cmd.Context) error {
 		return errors.Annotate(err, "getting state")
 	}
 	defer st.Close()
+	if err := addressSelection.loadSpaces(st); err != nil {
+		return errors.Annotate(err, "loading address policy")
+	}
 
 	if c.containerName == "" {
 		// Output a listing of LXC containers.
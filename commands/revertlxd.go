@@ -118,6 +118,9 @@ func (c *revertLXDImplCommand) Run(ctx *cmd.Context) error {
 		return errors.Annotate(err, "getting state")
 	}
 	defer st.Close()
+	if err := addressSelection.loadSpaces(st); err != nil {
+		return errors.Annotate(err, "loading address policy")
+	}
 
 	// Collect LXC container machines by host.
 	lxcByHost, err := getLXCContainersFromState(st)
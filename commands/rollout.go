@@ -0,0 +1,155 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/utils/set"
+)
+
+const (
+	batchByMachine     = "machine"
+	batchByApplication = "application"
+	batchByZone        = "zone"
+)
+
+// rolloutOptions controls the order in which machines are upgraded.
+// Canaries are upgraded on their own first, then the rest of the
+// machines are upgraded in batches.
+type rolloutOptions struct {
+	canaries        []string
+	batchBy         string
+	batchSize       int
+	maxFailureRatio float64
+
+	canaryFlag string
+}
+
+func (o *rolloutOptions) setFlags(f *gnuflag.FlagSet) {
+	f.StringVar(&o.canaryFlag, "canary", "", "Comma-separated machine IDs to upgrade and check before any others")
+	f.StringVar(&o.batchBy, "batch-by", "", `Upgrade the remaining machines in batches by "machine", "application" or "zone"`)
+	f.IntVar(&o.batchSize, "batch-size", 1, "The number of machines, applications or zones in each batch")
+	f.Float64Var(&o.maxFailureRatio, "max-failure-ratio", 0, "Stop if more than this fraction of a batch fails")
+}
+
+func (o *rolloutOptions) validate() error {
+	if o.canaryFlag != "" {
+		o.canaries = strings.Split(o.canaryFlag, ",")
+	}
+	switch o.batchBy {
+	case "", batchByMachine, batchByApplication, batchByZone:
+	default:
+		return errors.Errorf("unknown --batch-by value %q", o.batchBy)
+	}
+	if o.batchSize < 1 {
+		return errors.New("--batch-size must be at least 1")
+	}
+	if o.maxFailureRatio < 0 || o.maxFailureRatio > 1 {
+		return errors.New("--max-failure-ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// args returns the flags needed to pass the options on to the
+// remote command.
+func (o *rolloutOptions) args() []string {
+	var args []string
+	if o.canaryFlag != "" {
+		args = append(args, "--canary", o.canaryFlag)
+	}
+	if o.batchBy != "" {
+		args = append(args, "--batch-by", o.batchBy)
+	}
+	if o.batchSize != 1 {
+		args = append(args, "--batch-size", strconv.Itoa(o.batchSize))
+	}
+	if o.maxFailureRatio != 0 {
+		args = append(args, "--max-failure-ratio", strconv.FormatFloat(o.maxFailureRatio, 'g', -1, 64))
+	}
+	return args
+}
+
+// plan splits the machines into the batches to upgrade, returning the
+// indices of the machines in each batch. If there are canaries they
+// are always the first batch.
+func (o *rolloutOptions) plan(machines []FlatMachine) ([][]int, error) {
+	canaries := set.NewStrings(o.canaries...)
+	var batches [][]int
+	if len(canaries) > 0 {
+		var batch []int
+		for i, machine := range machines {
+			if canaries.Contains(machine.ID) {
+				batch = append(batch, i)
+				canaries.Remove(machine.ID)
+			}
+		}
+		if len(canaries) > 0 {
+			return nil, errors.NotFoundf("canary machines %s", strings.Join(canaries.SortedValues(), ", "))
+		}
+		batches = append(batches, batch)
+	}
+	canaries = set.NewStrings(o.canaries...)
+
+	// Group the remaining machines, keeping the ones that don't
+	// belong to any group until last. Groups are upgraded in the
+	// order they're first seen.
+	groups := make(map[string][]int)
+	var keys []string
+	var ungrouped []int
+	for i, machine := range machines {
+		if canaries.Contains(machine.ID) {
+			continue
+		}
+		key := o.groupKey(machine)
+		if key == "" {
+			ungrouped = append(ungrouped, i)
+			continue
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	for len(keys) > 0 {
+		size := o.batchSize
+		if size > len(keys) {
+			size = len(keys)
+		}
+		var batch []int
+		for _, key := range keys[:size] {
+			batch = append(batch, groups[key]...)
+		}
+		sort.Ints(batch)
+		batches = append(batches, batch)
+		keys = keys[size:]
+	}
+	if len(ungrouped) > 0 {
+		batches = append(batches, ungrouped)
+	}
+	return batches, nil
+}
+
+// groupKey returns the group the machine is batched with, or "" if it
+// isn't in one.
+func (o *rolloutOptions) groupKey(machine FlatMachine) string {
+	switch o.batchBy {
+	case batchByMachine:
+		return machine.ID
+	case batchByApplication:
+		// A machine hosting several applications is upgraded
+		// with the first of them.
+		if len(machine.Applications) > 0 {
+			return machine.Applications[0]
+		}
+	case batchByZone:
+		return machine.AvailabilityZone
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"os"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type rolloutSuite struct{}
+
+var _ = gc.Suite(&rolloutSuite{})
+
+var rolloutMachines = []FlatMachine{
+	{ID: "0", AvailabilityZone: "zone-a", Applications: []string{"mysql"}},
+	{ID: "1", AvailabilityZone: "zone-b", Applications: []string{"wordpress"}},
+	{ID: "2", AvailabilityZone: "zone-a", Applications: []string{"mysql", "nrpe"}},
+	{ID: "3", AvailabilityZone: "zone-c"},
+	{ID: "4", AvailabilityZone: "zone-b", Applications: []string{"haproxy"}},
+}
+
+func (*rolloutSuite) TestPlanDefault(c *gc.C) {
+	o := rolloutOptions{batchSize: 1}
+	batches, err := o.plan(rolloutMachines)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(batches, jc.DeepEquals, [][]int{{0, 1, 2, 3, 4}})
+}
+
+func (*rolloutSuite) TestPlanCanaries(c *gc.C) {
+	o := rolloutOptions{canaries: []string{"3", "1"}, batchSize: 1}
+	batches, err := o.plan(rolloutMachines)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(batches, jc.DeepEquals, [][]int{{1, 3}, {0, 2, 4}})
+}
+
+func (*rolloutSuite) TestPlanUnknownCanary(c *gc.C) {
+	o := rolloutOptions{canaries: []string{"1", "7"}, batchSize: 1}
+	_, err := o.plan(rolloutMachines)
+	c.Assert(err, gc.ErrorMatches, "canary machines 7 not found")
+}
+
+func (*rolloutSuite) TestPlanByMachine(c *gc.C) {
+	o := rolloutOptions{batchBy: batchByMachine, batchSize: 2}
+	batches, err := o.plan(rolloutMachines)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(batches, jc.DeepEquals, [][]int{{0, 1}, {2, 3}, {4}})
+}
+
+func (*rolloutSuite) TestPlanByApplication(c *gc.C) {
+	o := rolloutOptions{canaries: []string{"1"}, batchBy: batchByApplication, batchSize: 1}
+	batches, err := o.plan(rolloutMachines)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(batches, jc.DeepEquals, [][]int{{1}, {0, 2}, {4}, {3}})
+}
+
+func (*rolloutSuite) TestPlanByZone(c *gc.C) {
+	o := rolloutOptions{batchBy: batchByZone, batchSize: 2}
+	batches, err := o.plan(rolloutMachines)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(batches, jc.DeepEquals, [][]int{{0, 1, 2, 4}, {3}})
+}
+
+func (*rolloutSuite) TestRecordUpgradedMachines(c *gc.C) {
+	s := toolsDir
+	defer func() { toolsDir = s }()
+	toolsDir = c.MkDir()
+
+	_, err := loadUpgradedMachines()
+	c.Assert(os.IsNotExist(errors.Cause(err)), jc.IsTrue)
+
+	c.Assert(recordUpgradedMachines("2", "0"), jc.ErrorIsNil)
+	c.Assert(recordUpgradedMachines("1/lxc/0", "0"), jc.ErrorIsNil)
+	upgraded, err := loadUpgradedMachines()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(upgraded.SortedValues(), jc.DeepEquals, []string{"0", "1/lxc/0", "2"})
+}
@@ -21,9 +21,9 @@ func printServiceStatus(ctx *cmd.Context, machines []FlatMachine) error {
 	values := parseStatus(machines, serviceStatusOutput)
 	writer := output.TabWriter(ctx.Stdout)
 	wrapper := output.Wrapper{writer}
-	wrapper.Println("AGENT", "STATUS", "VERSION")
+	wrapper.Println("AGENT", "STATUS", "VERSION", "ADDRESS", "SELECTION")
 	for _, v := range values {
-		wrapper.Println(v.agent, v.status, v.version)
+		wrapper.Println(v.agent, v.status, v.version, v.address, v.source)
 	}
 	writer.Flush()
 	return nil
@@ -33,6 +33,11 @@ type statusResult struct {
 	agent   string
 	status  string
 	version string
+
+	// address is the address the agent's machine was reached by, and
+	// source is why the address policy chose it.
+	address string
+	source  string
 }
 
 func parseStatus(machines []FlatMachine, serviceStatusOutput []string) []statusResult {
@@ -48,6 +53,13 @@ func parseStatus(machines []FlatMachine, serviceStatusOutput []string) []statusR
 			lsParts := strings.Split(parts[1], " ")
 			toolsPath := lsParts[len(lsParts)-1]
 			result.version = path.Base(toolsPath)
+			result.address = machine.Address
+			result.source = machine.AddressSource
+			if result.source == "" {
+				// Machines saved before the address policy was
+				// recorded.
+				result.source = "-"
+			}
 			switch machine.Series {
 			case "trusty":
 				result.status = upstartStatus(parts[2])
@@ -114,7 +126,7 @@ done
 	`, command)
 
 	targets := flatMachineExecTargets(machines...)
-	results, err := parallelExec(targets, script)
+	results, err := parallelExec("agent "+command, targets, script)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -0,0 +1,196 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"path"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/utils"
+)
+
+// sshConfig holds the settings for one leg of the SSH connections:
+// from the client to the API server machine, or from there to the
+// other machines in the environment.
+type sshConfig struct {
+	// User is the account to log in as. Scripts are run with
+	// sudo -n, so it needs passwordless sudo unless it's root.
+	User string
+
+	// Identity is the private key file to use, if not the default.
+	Identity string
+
+	// JumpHosts is the chain of bastion hosts to connect through,
+	// each as [user@]host.
+	JumpHosts []string
+}
+
+var (
+	// apiServerSSH is used for connections from the client to the
+	// API server machine.
+	apiServerSSH = sshConfig{User: defaultSSHUser}
+
+	// machineSSH is used for connections from the API server machine
+	// to the other machines. The identity is a path on the machine
+	// the connections are made from, so it's passed on to the remote
+	// command as given; it defaults to the API server machine's
+	// system identity.
+	machineSSH = sshConfig{User: defaultSSHUser}
+)
+
+const defaultSSHUser = "ubuntu"
+
+// hop returns the hop for connecting to the machine at addr with
+// these settings.
+func (c sshConfig) hop(addr string) sshHop {
+	return sshHop{dest: c.User + "@" + addr, identity: c.Identity}
+}
+
+// jumpHops returns the hops for the configured jump hosts.
+func (c sshConfig) jumpHops() []sshHop {
+	hops := make([]sshHop, len(c.JumpHosts))
+	for i, host := range c.JumpHosts {
+		hops[i] = sshHop{dest: host}
+	}
+	return hops
+}
+
+// homeDir returns the home directory of the user on an Ubuntu
+// machine.
+func homeDir(user string) string {
+	if user == "root" {
+		return "/root"
+	}
+	return path.Join("/home", user)
+}
+
+// machineIdentity returns the identity to use for connections to the
+// machines in the environment. In client-driven mode the operator's
+// own keys are used by default, since the system identity is only on
+// the API server machine.
+func machineIdentity() string {
+	if machineSSH.Identity != "" || clientDriven() {
+		return machineSSH.Identity
+	}
+	return systemIdentity
+}
+
+// machineHops returns the hops to connect through to reach a machine
+// from here: the API server machine in client-driven mode, any jump
+// hosts, and the machine's host if it's a container.
+func machineHops(hostAddr string) []sshHop {
+	var hops []sshHop
+	if clientDriven() {
+		hops = append(apiServerSSH.jumpHops(), apiServerSSH.hop(apiServerAddress))
+	}
+	hops = append(hops, machineSSH.jumpHops()...)
+	if hostAddr != "" {
+		hops = append(hops, sshHop{dest: machineSSH.User + "@" + hostAddr, identity: machineIdentity()})
+	}
+	return hops
+}
+
+// sshHop is a machine that an SSH connection goes through.
+type sshHop struct {
+	// dest is the [user@]host to connect to.
+	dest string
+
+	// identity is the private key file to use, if not the default.
+	identity string
+}
+
+// hopArgs returns the ssh options for connecting to the last of the
+// hops, through the ones before it.
+func hopArgs(hops []sshHop) []string {
+	last := hops[len(hops)-1]
+	// As in defaultSSHOptions, host keys aren't checked.
+	args := []string{
+		"-q",
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+	}
+	if last.identity != "" {
+		args = append(args, "-i", last.identity)
+	}
+	if len(hops) > 1 {
+		proxy := utils.CommandString(hopsProxyCommand(hops[:len(hops)-1])...)
+		args = append(args, "-o", "ProxyCommand="+proxy)
+	}
+	return args
+}
+
+// hopsProxyCommand returns a proxy command that connects to the target
+// through each of the hops in turn.
+func hopsProxyCommand(hops []sshHop) []string {
+	args := hopArgs(hops)
+	for i, arg := range args {
+		// The tokens in a nested proxy command are expanded by the
+		// connection to the target before the connection to the hop
+		// sees them, so they're escaped.
+		args[i] = strings.Replace(arg, "%", "%%", -1)
+	}
+	command := append([]string{"ssh"}, args...)
+	return append(command, "-W", "%h:%p", hops[len(hops)-1].dest)
+}
+
+// setSSHFlags adds the flags for the SSH settings of both legs. The
+// client passes the settings on to the remote command with
+// sshFlagArgs.
+func setSSHFlags(f *gnuflag.FlagSet) {
+	f.StringVar(&apiServerSSH.User, "ssh-user", defaultSSHUser, "User to log in to the API server machine as")
+	f.StringVar(&apiServerSSH.Identity, "ssh-identity", "", "Private key file for logging in to the API server machine")
+	f.Var(jumpHostsValue{&apiServerSSH.JumpHosts}, "bastion", "Comma-separated chain of [user@]host to reach the API server machine through")
+	f.StringVar(&machineSSH.User, "machine-user", defaultSSHUser, "User to log in to the other machines as")
+	f.StringVar(&machineSSH.Identity, "machine-identity", "", "Private key file on the API server machine (on this machine with --client-driven) for logging in to the other machines (default: the system identity)")
+	f.Var(jumpHostsValue{&machineSSH.JumpHosts}, "machine-bastion", "Comma-separated chain of [user@]host to reach the other machines through")
+}
+
+// sshFlagArgs returns the flags for passing the SSH settings that
+// aren't the defaults on to the remote command.
+func sshFlagArgs() []string {
+	var args []string
+	add := func(flag, value string) {
+		if value != "" {
+			args = append(args, flag, utils.ShQuote(value))
+		}
+	}
+	if apiServerSSH.User != defaultSSHUser {
+		add("--ssh-user", apiServerSSH.User)
+	}
+	add("--ssh-identity", apiServerSSH.Identity)
+	add("--bastion", strings.Join(apiServerSSH.JumpHosts, ","))
+	if machineSSH.User != defaultSSHUser {
+		add("--machine-user", machineSSH.User)
+	}
+	add("--machine-identity", machineSSH.Identity)
+	add("--machine-bastion", strings.Join(machineSSH.JumpHosts, ","))
+	return args
+}
+
+// jumpHostsValue is a gnuflag.Value for a comma-separated chain of
+// jump hosts.
+type jumpHostsValue struct {
+	hosts *[]string
+}
+
+// String is part of gnuflag.Value.
+func (v jumpHostsValue) String() string {
+	return strings.Join(*v.hosts, ",")
+}
+
+// Set is part of gnuflag.Value.
+func (v jumpHostsValue) Set(value string) error {
+	var hosts []string
+	for _, host := range strings.Split(value, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			return errors.Errorf("empty host in %q", value)
+		}
+		hosts = append(hosts, host)
+	}
+	*v.hosts = hosts
+	return nil
+}
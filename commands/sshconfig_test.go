@@ -0,0 +1,118 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"github.com/juju/gnuflag"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type sshConfigSuite struct {
+	apiServerSSH sshConfig
+	machineSSH   sshConfig
+}
+
+var _ = gc.Suite(&sshConfigSuite{})
+
+func (s *sshConfigSuite) SetUpTest(c *gc.C) {
+	s.apiServerSSH = apiServerSSH
+	s.machineSSH = machineSSH
+}
+
+func (s *sshConfigSuite) TearDownTest(c *gc.C) {
+	apiServerSSH = s.apiServerSSH
+	machineSSH = s.machineSSH
+	apiServerAddress = ""
+}
+
+func (*sshConfigSuite) TestMachineDefaults(c *gc.C) {
+	options := newExecOptions("10.0.0.3")
+	c.Assert(options.user, gc.Equals, "ubuntu")
+	c.Assert(options.hops, gc.HasLen, 0)
+	c.Assert(options.command("true"), jc.DeepEquals, []string{"sudo", "-n", "bash", "-c 'true'"})
+}
+
+func (*sshConfigSuite) TestRootDoesntSudo(c *gc.C) {
+	machineSSH.User = "root"
+	options := newExecOptions("10.0.0.3")
+	c.Assert(options.user, gc.Equals, "root")
+	c.Assert(options.command("true"), jc.DeepEquals, []string{"bash", "-c 'true'"})
+}
+
+func (*sshConfigSuite) TestAPIServer(c *gc.C) {
+	apiServerSSH = sshConfig{User: "admin", JumpHosts: []string{"me@bastion"}}
+	machineSSH.JumpHosts = []string{"machine-bastion"}
+	options := newExecOptions("10.0.0.1", withAPIServer())
+	c.Assert(options.user, gc.Equals, "admin")
+	c.Assert(options.hops, jc.DeepEquals, []sshHop{{dest: "me@bastion"}})
+}
+
+func (*sshConfigSuite) TestProxyCommandForContainer(c *gc.C) {
+	options := newExecOptions("10.0.3.4", withProxyCommandForHost("10.0.0.2"))
+	c.Assert(options.hostAddr, gc.Equals, "10.0.0.2")
+	c.Assert(hopsProxyCommand(options.hops), jc.DeepEquals, []string{
+		"ssh", "-q",
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"-i", "/var/lib/juju/system-identity",
+		"-W", "%h:%p", "ubuntu@10.0.0.2",
+	})
+}
+
+func (*sshConfigSuite) TestProxyCommandWithBastion(c *gc.C) {
+	machineSSH = sshConfig{User: "admin", JumpHosts: []string{"jump@bastion"}}
+	c.Assert(hopsProxyCommand(machineHops("10.0.0.2")), jc.DeepEquals, []string{
+		"ssh", "-q",
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"-i", "/var/lib/juju/system-identity",
+		"-o", "ProxyCommand=ssh -q -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -W %%h:%%p jump@bastion",
+		"-W", "%h:%p", "admin@10.0.0.2",
+	})
+}
+
+func (*sshConfigSuite) TestClientDrivenHops(c *gc.C) {
+	apiServerAddress = "10.0.0.1"
+	apiServerSSH.Identity = "/home/me/.ssh/upgrade"
+	c.Assert(machineHops(""), jc.DeepEquals, []sshHop{
+		{dest: "ubuntu@10.0.0.1", identity: "/home/me/.ssh/upgrade"},
+	})
+	// The operator's own keys are used for the machines.
+	c.Assert(machineHops("10.0.0.2"), jc.DeepEquals, []sshHop{
+		{dest: "ubuntu@10.0.0.1", identity: "/home/me/.ssh/upgrade"},
+		{dest: "ubuntu@10.0.0.2"},
+	})
+}
+
+func (*sshConfigSuite) TestThrottleAddress(c *gc.C) {
+	c.Assert(throttleAddress("10.0.0.2"), gc.Equals, "10.0.0.2")
+	// Every connection goes through the API server machine in
+	// client-driven mode.
+	apiServerAddress = "10.0.0.1"
+	c.Assert(throttleAddress("10.0.0.2"), gc.Equals, "10.0.0.1")
+}
+
+func (*sshConfigSuite) TestFlags(c *gc.C) {
+	f := gnuflag.NewFlagSet("test", gnuflag.ContinueOnError)
+	setSSHFlags(f)
+	err := f.Parse(true, []string{
+		"--ssh-user", "admin",
+		"--bastion", "a@bastion1, bastion2",
+		"--machine-identity", "/root/.ssh/id_rsa",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(apiServerSSH, jc.DeepEquals, sshConfig{
+		User:      "admin",
+		JumpHosts: []string{"a@bastion1", "bastion2"},
+	})
+	c.Assert(sshFlagArgs(), jc.DeepEquals, []string{
+		"--ssh-user", "'admin'",
+		"--bastion", "'a@bastion1,bastion2'",
+		"--machine-identity", "'/root/.ssh/id_rsa'",
+	})
+
+	err = f.Parse(true, []string{"--machine-bastion", "a,,b"})
+	c.Assert(err, gc.ErrorMatches, `invalid value "a,,b" for flag .*machine-bastion: empty host in "a,,b"`)
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/juju/description"
+	"github.com/juju/errors"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+	version1 "github.com/juju/1.25-upgrade/juju1/version"
+)
+
+// sshHostKeysScript prints the machine's public SSH host keys.
+const sshHostKeysScript = `cat /etc/ssh/ssh_host_*_key.pub`
+
+// collectSSHHostKeys reads the public SSH host keys from each of the
+// machines, returning them by the machine id in the exported model.
+// 1.25 doesn't record host keys, so this is the only way to get them
+// into the model. Machines the keys can't be read from are logged and
+// left out, since the model works without them; only juju ssh loses
+// the ability to check the host.
+func collectSSHHostKeys(machines []FlatMachine) (map[string][]string, error) {
+	var targets []FlatMachine
+	for _, machine := range machines {
+		osType, err := version1.GetOSFromSeries(machine.Series)
+		if err != nil || osType == version1.Windows {
+			logger.Infof("not collecting SSH host keys from machine %s (series %q)", machine.ID, machine.Series)
+			continue
+		}
+		targets = append(targets, machine)
+	}
+	results, err := parallelExec("SSH host keys", flatMachineExecTargets(targets...), sshHostKeysScript)
+	if err != nil {
+		return nil, errors.Annotate(err, "reading SSH host keys")
+	}
+	keys := make(map[string][]string)
+	for i, result := range results {
+		machineID := targets[i].ID
+		// cat carries on past files it can't read, so keep whatever
+		// keys it did print.
+		machineKeys := parseSSHHostKeys(result.Stdout)
+		if result.Code != 0 {
+			logger.Warningf("couldn't read all SSH host keys from machine %s: exited with %d: %s",
+				machineID, result.Code, strings.TrimSpace(result.Stderr))
+		}
+		if len(machineKeys) == 0 {
+			logger.Warningf("no SSH host keys found on machine %s", machineID)
+			continue
+		}
+		keys[state.LXDMachineId(machineID)] = machineKeys
+	}
+	return keys, nil
+}
+
+// parseSSHHostKeys returns the keys in the output of
+// sshHostKeysScript, one per line of the form "<type> <key> [comment]".
+// Anything else is ignored.
+func parseSSHHostKeys(output string) []string {
+	var keys []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !isSSHKeyType(fields[0]) {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	return keys
+}
+
+func isSSHKeyType(keyType string) bool {
+	return strings.HasPrefix(keyType, "ssh-") || strings.HasPrefix(keyType, "ecdsa-")
+}
+
+// addSSHHostKeys adds the keys collected from the machines to the
+// exported model.
+func addSSHHostKeys(model description.Model, keys map[string][]string) {
+	machineIDs := make([]string, 0, len(keys))
+	for machineID := range keys {
+		machineIDs = append(machineIDs, machineID)
+	}
+	sort.Strings(machineIDs)
+	for _, machineID := range machineIDs {
+		model.AddSSHHostKey(description.SSHHostKeyArgs{
+			MachineID: machineID,
+			Keys:      keys[machineID],
+		})
+	}
+}
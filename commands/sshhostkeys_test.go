@@ -0,0 +1,46 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"github.com/juju/description"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	names2 "gopkg.in/juju/names.v2"
+)
+
+type sshHostKeysSuite struct{}
+
+var _ = gc.Suite(&sshHostKeysSuite{})
+
+func (*sshHostKeysSuite) TestParse(c *gc.C) {
+	keys := parseSSHHostKeys(`ssh-rsa AAAArsa root@machine-0
+ecdsa-sha2-nistp256 AAAAecdsa root@machine-0
+
+cat: /etc/ssh/ssh_host_*_key.pub: No such file or directory
+ssh-ed25519 AAAAed25519
+`)
+	c.Assert(keys, jc.DeepEquals, []string{
+		"ssh-rsa AAAArsa root@machine-0",
+		"ecdsa-sha2-nistp256 AAAAecdsa root@machine-0",
+		"ssh-ed25519 AAAAed25519",
+	})
+}
+
+func (*sshHostKeysSuite) TestAddToModel(c *gc.C) {
+	model := description.NewModel(description.ModelArgs{
+		Owner:  names2.NewUserTag("admin"),
+		Config: map[string]interface{}{"name": "model", "uuid": "model-uuid"},
+	})
+	addSSHHostKeys(model, map[string][]string{
+		"1/lxd/0": {"ssh-rsa AAAAcontainer"},
+		"0":       {"ssh-rsa AAAA0", "ssh-ed25519 AAAA0"},
+	})
+	keys := model.SSHHostKeys()
+	c.Assert(keys, gc.HasLen, 2)
+	c.Check(keys[0].MachineID(), gc.Equals, "0")
+	c.Check(keys[0].Keys(), jc.DeepEquals, []string{"ssh-rsa AAAA0", "ssh-ed25519 AAAA0"})
+	c.Check(keys[1].MachineID(), gc.Equals, "1/lxd/0")
+	c.Check(keys[1].Keys(), jc.DeepEquals, []string{"ssh-rsa AAAAcontainer"})
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+)
+
+// storagePoolMapEntry is how a pool mapping is written in the
+// --storage-pool-map file, keyed by 1.25 pool name or provider type:
+//
+//	openstack-ssd:
+//	  provider: cinder
+//	  rename:
+//	    old-attribute: new-attribute
+//	  attributes:
+//	    volume-type: ssd
+type storagePoolMapEntry struct {
+	Provider   string                 `yaml:"provider,omitempty"`
+	Rename     map[string]string      `yaml:"rename,omitempty"`
+	Attributes map[string]interface{} `yaml:"attributes,omitempty"`
+}
+
+type storagePoolMap map[string]storagePoolMapEntry
+
+// readStoragePoolMap reads and checks the YAML storage pool map file.
+func readStoragePoolMap(path string) (storagePoolMap, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var poolMap storagePoolMap
+	if err := yaml.Unmarshal(data, &poolMap); err != nil {
+		return nil, errors.Annotatef(err, "parsing %s", path)
+	}
+	if err := poolMap.validate(); err != nil {
+		return nil, errors.Annotatef(err, "in %s", path)
+	}
+	return poolMap, nil
+}
+
+func (m storagePoolMap) validate() error {
+	for name, entry := range m {
+		if name == "" {
+			return errors.New("storage pool mapping with no name")
+		}
+		if entry.Provider == "" && len(entry.Rename) == 0 && len(entry.Attributes) == 0 {
+			return errors.Errorf("storage pool mapping %q doesn't change anything", name)
+		}
+	}
+	return nil
+}
+
+// encode returns the map in a form that can be passed to the remote
+// command as a single argument. It stays as YAML so that attribute
+// values keep their types.
+func (m storagePoolMap) encode() (string, error) {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func decodeStoragePoolMap(encoded string) (storagePoolMap, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Annotate(err, "decoding storage pool map")
+	}
+	var poolMap storagePoolMap
+	if err := yaml.Unmarshal(data, &poolMap); err != nil {
+		return nil, errors.Annotate(err, "unmarshalling storage pool map")
+	}
+	return poolMap, nil
+}
+
+// mappings returns the map as the export expects it.
+func (m storagePoolMap) mappings() map[string]state.StoragePoolMapping {
+	if len(m) == 0 {
+		return nil
+	}
+	result := make(map[string]state.StoragePoolMapping)
+	for name, entry := range m {
+		result[name] = state.StoragePoolMapping{
+			Provider:         entry.Provider,
+			RenameAttributes: entry.Rename,
+			Attributes:       entry.Attributes,
+		}
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+)
+
+type storagePoolMapSuite struct{}
+
+var _ = gc.Suite(&storagePoolMapSuite{})
+
+func writePoolMap(c *gc.C, content string) string {
+	path := filepath.Join(c.MkDir(), "pools.yaml")
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	return path
+}
+
+func (*storagePoolMapSuite) TestReadAndEncode(c *gc.C) {
+	path := writePoolMap(c, `
+openstack-ssd:
+  provider: cinder
+  rename:
+    old-type: volume-type
+  attributes:
+    size-gb: 20
+hostloop:
+  provider: loop
+`)
+	poolMap, err := readStoragePoolMap(path)
+	c.Assert(err, jc.ErrorIsNil)
+
+	encoded, err := poolMap.encode()
+	c.Assert(err, jc.ErrorIsNil)
+	decoded, err := decodeStoragePoolMap(encoded)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(decoded.mappings(), jc.DeepEquals, map[string]state.StoragePoolMapping{
+		"openstack-ssd": {
+			Provider:         "cinder",
+			RenameAttributes: map[string]string{"old-type": "volume-type"},
+			Attributes:       map[string]interface{}{"size-gb": 20},
+		},
+		"hostloop": {Provider: "loop"},
+	})
+}
+
+func (*storagePoolMapSuite) TestEmptyMapping(c *gc.C) {
+	path := writePoolMap(c, "ebs-ssd: {}\n")
+	_, err := readStoragePoolMap(path)
+	c.Assert(err, gc.ErrorMatches, `in .*pools.yaml: storage pool mapping "ebs-ssd" doesn't change anything`)
+}
+
+func (*storagePoolMapSuite) TestBadYAML(c *gc.C) {
+	path := writePoolMap(c, "ebs-ssd: [\n")
+	_, err := readStoragePoolMap(path)
+	c.Assert(err, gc.ErrorMatches, `parsing .*pools.yaml: .*`)
+}
+
+func (*storagePoolMapSuite) TestOptions(c *gc.C) {
+	path := writePoolMap(c, "hostloop:\n  provider: loop\n")
+	client := targetModelOptions{storagePoolMapFile: path}
+	c.Assert(client.validate(), jc.ErrorIsNil)
+	args := client.args()
+	c.Assert(args, gc.HasLen, 2)
+	c.Assert(args[0], gc.Equals, "--storage-pool-map-data")
+
+	remote := targetModelOptions{storagePoolMapData: args[1]}
+	c.Assert(remote.validate(), jc.ErrorIsNil)
+	c.Assert(remote.exportOverrides().StoragePools, jc.DeepEquals, map[string]state.StoragePoolMapping{
+		"hostloop": {Provider: "loop"},
+	})
+}
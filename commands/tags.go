@@ -4,9 +4,16 @@
 package commands
 
 import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
 	"github.com/juju/errors"
 
 	"github.com/juju/1.25-upgrade/juju1/environs"
+	"github.com/juju/1.25-upgrade/juju1/environs/tags"
 	"github.com/juju/1.25-upgrade/juju1/state"
 )
 
@@ -16,11 +23,16 @@ import (
 // when we know we can downgrade them again.
 type TagUpgrader interface {
 	// UpgradeTags replaces juju-env-uuid tags with juju-model-uuid on
-	// any resources that need updating.
-	UpgradeTags(controllerUUID string) error
+	// any resources that need updating, recording each change in the
+	// journal. It can be run again after a partial failure.
+	UpgradeTags(controllerUUID string, journal tags.TagJournal) error
 	// Downgrade tags converts juju-model-uuid tags back to
-	// juju-env-uuid, and removes any juju-controller-uuid tags.
-	DowngradeTags() error
+	// juju-env-uuid, and removes any juju-controller-uuid tags. It
+	// can be run at any point after a partial upgrade.
+	DowngradeTags(journal tags.TagJournal) error
+	// TagStatus returns the environment's provider resources with
+	// their 1.25 and 2.x tags.
+	TagStatus() ([]tags.TaggedResource, error)
 }
 
 func getTagUpgrader(st *state.State) (TagUpgrader, error) {
@@ -48,7 +60,12 @@ func upgradeTags(st *state.State, controllerUUID string) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
-	return upgrader.UpgradeTags(controllerUUID)
+	journal, err := openTagJournal(tagJournalPath, "upgrade")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer journal.Close()
+	return upgrader.UpgradeTags(controllerUUID, journal)
 }
 
 func downgradeTags(st *state.State) error {
@@ -56,5 +73,99 @@ func downgradeTags(st *state.State) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
-	return upgrader.DowngradeTags()
+	journal, err := openTagJournal(tagJournalPath, "downgrade")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer journal.Close()
+	return upgrader.DowngradeTags(journal)
+}
+
+// tagJournalPath is where tag changes are recorded on the API server
+// machine. The journal is appended to by each run, so it covers the
+// whole history of upgrades and downgrades of the environment's tags.
+var tagJournalPath = filepath.Join(dataDir, "1.25-upgrade-tags.journal")
+
+// tagJournalEntry is a line in the tag journal.
+type tagJournalEntry struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Kind      string    `json:"kind,omitempty"`
+	Id        string    `json:"id,omitempty"`
+	Action    string    `json:"action"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// fileTagJournal is a tags.TagJournal that appends each change to a
+// file as a line of JSON, syncing it so the record survives the
+// upgrade process being killed.
+type fileTagJournal struct {
+	file      *os.File
+	operation string
+}
+
+func openTagJournal(path, operation string) (*fileTagJournal, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Annotate(err, "opening tag journal")
+	}
+	journal := &fileTagJournal{file: file, operation: operation}
+	if err := journal.write(tagJournalEntry{Action: "start"}); err != nil {
+		file.Close()
+		return nil, errors.Trace(err)
+	}
+	return journal, nil
+}
+
+// Record is part of tags.TagJournal.
+func (j *fileTagJournal) Record(change tags.TagChange, err error) error {
+	entry := tagJournalEntry{
+		Kind:   change.Kind,
+		Id:     change.Id,
+		Action: change.Action,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return j.write(entry)
+}
+
+func (j *fileTagJournal) write(entry tagJournalEntry) error {
+	entry.Time = time.Now().UTC()
+	entry.Operation = j.operation
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(j.file.Sync())
+}
+
+func (j *fileTagJournal) Close() error {
+	return j.file.Close()
+}
+
+// readTagJournal returns the entries in the tag journal, or none if
+// tags have never been changed.
+func readTagJournal(path string) ([]tagJournalEntry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer file.Close()
+	var entries []tagJournalEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry tagJournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, errors.Annotatef(err, "reading %s", path)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, errors.Trace(scanner.Err())
 }
@@ -0,0 +1,93 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju1/environs/tags"
+)
+
+type tagsSuite struct{}
+
+var _ = gc.Suite(&tagsSuite{})
+
+func (*tagsSuite) TestJournal(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "tags.journal")
+	journal, err := openTagJournal(path, "upgrade")
+	c.Assert(err, jc.ErrorIsNil)
+	err = journal.Record(tags.TagChange{Kind: "server", Id: "s1", Action: "set metadata"}, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	err = journal.Record(tags.TagChange{Kind: "server", Id: "s2", Action: "set metadata"}, errors.New("boom"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(journal.Close(), jc.ErrorIsNil)
+
+	// A second run appends to the journal.
+	journal, err = openTagJournal(path, "downgrade")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(journal.Close(), jc.ErrorIsNil)
+
+	entries, err := readTagJournal(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(entries, gc.HasLen, 4)
+	for i := range entries {
+		c.Check(entries[i].Time.IsZero(), jc.IsFalse)
+		entries[i].Time = time.Time{}
+	}
+	c.Assert(entries, jc.DeepEquals, []tagJournalEntry{
+		{Operation: "upgrade", Action: "start"},
+		{Operation: "upgrade", Kind: "server", Id: "s1", Action: "set metadata"},
+		{Operation: "upgrade", Kind: "server", Id: "s2", Action: "set metadata", Error: "boom"},
+		{Operation: "downgrade", Action: "start"},
+	})
+}
+
+func (*tagsSuite) TestReadMissingJournal(c *gc.C) {
+	entries, err := readTagJournal(filepath.Join(c.MkDir(), "tags.journal"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(entries, gc.HasLen, 0)
+}
+
+func (*tagsSuite) TestWriteTagStatus(c *gc.C) {
+	var out bytes.Buffer
+	err := writeTagStatus(&out, []tags.TaggedResource{{
+		Kind:  "volume",
+		Id:    "vol-1",
+		Juju1: map[string]string{"juju-env-uuid": "env"},
+		Juju2: map[string]string{},
+	}, {
+		Kind:  "server",
+		Id:    "s2",
+		Name:  "juju-env-machine-1",
+		Juju1: map[string]string{"security-groups": "juju-env,juju-env-1"},
+		Juju2: map[string]string{"juju-model-uuid": "env"},
+	}, {
+		Kind:  "server",
+		Id:    "s1",
+		Name:  "juju-env-machine-0",
+		Juju2: map[string]string{"juju-model-uuid": "env"},
+	}, {
+		Kind:   "security group",
+		Id:     "sg-1",
+		Name:   "juju-env",
+		Juju1:  map[string]string{"name": "juju-env"},
+		Juju2:  map[string]string{},
+		Unused: true,
+	}})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(out.String(), gc.Equals, ""+
+		"KIND            ID     NAME                STATE    1.25                                 2.x\n"+
+		"security group  sg-1   juju-env            unused   name=juju-env                        -\n"+
+		"server          s1     juju-env-machine-0  2.x      -                                    juju-model-uuid=env\n"+
+		"server          s2     juju-env-machine-1  partial  security-groups=juju-env,juju-env-1  juju-model-uuid=env\n"+
+		"volume          vol-1  -                   1.25     juju-env-uuid=env                    -\n"+
+		"\n"+
+		"4 resources: 1 1.25, 1 partial, 1 2.x, 1 unused\n")
+}
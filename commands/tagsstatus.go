@@ -0,0 +1,236 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+
+	"github.com/juju/1.25-upgrade/juju1/environs/tags"
+)
+
+var tagsStatusDoc = `
+The tags-status command lists every provider resource that belongs to a
+1.25 environment, such as servers, volumes and security groups, with
+the tags (or names) that tie it to the environment under 1.25 and
+under Juju 2.x. Each resource is shown as 1.25, 2.x or partial, so it's
+clear where an environment is after an interrupted import or abort.
+Resources that nothing uses any more, such as the 1.25 security groups
+kept after an import so it can be aborted, are shown as unused.
+
+Use --journal to also show each tag change that import and abort have
+made, along with any errors.
+
+`
+
+func newTagsStatusCommand() cmd.Command {
+	command := &tagsStatusCommand{}
+	command.remoteCommand = "tags-status-impl"
+	return wrap(command)
+}
+
+type tagsStatusCommand struct {
+	baseClientCommand
+	showJournal bool
+}
+
+func (c *tagsStatusCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "tags-status",
+		Args:    "<environment name>",
+		Purpose: "show the 1.25 and 2.x tags on the environment's provider resources",
+		Doc:     tagsStatusDoc,
+	}
+}
+
+func (c *tagsStatusCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.baseClientCommand.SetFlags(f)
+	f.BoolVar(&c.showJournal, "journal", false, "Also show the tag changes that have been made")
+}
+
+func (c *tagsStatusCommand) Init(args []string) error {
+	args, err := c.baseClientCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return cmd.CheckEmpty(args)
+}
+
+func (c *tagsStatusCommand) Run(ctx *cmd.Context) error {
+	if c.showJournal {
+		c.extraOptions = append(c.extraOptions, "--journal")
+	}
+	return c.baseClientCommand.Run(ctx)
+}
+
+var tagsStatusImplDoc = `
+
+tags-status-impl must be executed on an API server machine of a 1.25
+environment.
+
+The command will ask the provider for all of the environment's
+resources and print their 1.25 and 2.x tags.
+
+`
+
+func newTagsStatusImplCommand() cmd.Command {
+	return &tagsStatusImplCommand{}
+}
+
+type tagsStatusImplCommand struct {
+	baseRemoteCommand
+	showJournal bool
+}
+
+func (c *tagsStatusImplCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "tags-status-impl",
+		Purpose: "controller aspect of tags-status",
+		Doc:     tagsStatusImplDoc,
+	}
+}
+
+func (c *tagsStatusImplCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.baseRemoteCommand.SetFlags(f)
+	f.BoolVar(&c.showJournal, "journal", false, "Also show the tag changes that have been made")
+}
+
+func (c *tagsStatusImplCommand) Run(ctx *cmd.Context) error {
+	st, err := getState()
+	if err != nil {
+		return errors.Annotate(err, "getting state")
+	}
+	defer st.Close()
+
+	upgrader, err := getTagUpgrader(st)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	resources, err := upgrader.TagStatus()
+	if err != nil {
+		return errors.Annotate(err, "getting tag status")
+	}
+	if err := writeTagStatus(ctx.Stdout, resources); err != nil {
+		return errors.Trace(err)
+	}
+
+	entries, err := readTagJournal(tagJournalPath)
+	if err != nil {
+		return errors.Annotate(err, "reading tag journal")
+	}
+	if c.showJournal {
+		fmt.Fprintln(ctx.Stdout)
+		return errors.Trace(writeTagJournal(ctx.Stdout, entries))
+	}
+	if len(entries) > 0 {
+		fmt.Fprintf(ctx.Stdout, "\n%d tag changes recorded in %s; use --journal to see them\n", len(entries), tagJournalPath)
+	}
+	return nil
+}
+
+// tagState summarises which versions of Juju the resource is marked
+// for.
+func tagState(resource tags.TaggedResource) string {
+	switch {
+	case resource.Unused:
+		return "unused"
+	case len(resource.Juju1) > 0 && len(resource.Juju2) > 0:
+		return "partial"
+	case len(resource.Juju1) > 0:
+		return "1.25"
+	case len(resource.Juju2) > 0:
+		return "2.x"
+	default:
+		return "untagged"
+	}
+}
+
+func formatMarkers(markers map[string]string) string {
+	if len(markers) == 0 {
+		return "-"
+	}
+	keys := make([]string, 0, len(markers))
+	for key := range markers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=" + markers[key]
+	}
+	return strings.Join(parts, " ")
+}
+
+func writeTagStatus(out io.Writer, resources []tags.TaggedResource) error {
+	if len(resources) == 0 {
+		fmt.Fprintln(out, "no tagged provider resources")
+		return nil
+	}
+	sort.Sort(byKindAndId(resources))
+	counts := make(map[string]int)
+	w := tabwriter.NewWriter(out, 0, 1, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tID\tNAME\tSTATE\t1.25\t2.x")
+	for _, resource := range resources {
+		state := tagState(resource)
+		counts[state]++
+		name := resource.Name
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			resource.Kind, resource.Id, name, state,
+			formatMarkers(resource.Juju1), formatMarkers(resource.Juju2))
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Trace(err)
+	}
+	var summary []string
+	for _, state := range []string{"1.25", "partial", "2.x", "unused", "untagged"} {
+		if counts[state] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[state], state))
+		}
+	}
+	fmt.Fprintf(out, "\n%d resources: %s\n", len(resources), strings.Join(summary, ", "))
+	return nil
+}
+
+type byKindAndId []tags.TaggedResource
+
+func (r byKindAndId) Len() int      { return len(r) }
+func (r byKindAndId) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r byKindAndId) Less(i, j int) bool {
+	if r[i].Kind != r[j].Kind {
+		return r[i].Kind < r[j].Kind
+	}
+	return r[i].Id < r[j].Id
+}
+
+func writeTagJournal(out io.Writer, entries []tagJournalEntry) error {
+	if len(entries) == 0 {
+		fmt.Fprintln(out, "no tag changes recorded")
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 1, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tOPERATION\tKIND\tID\tACTION\tERROR")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Time.Format("2006-01-02 15:04:05"), entry.Operation,
+			orDash(entry.Kind), orDash(entry.Id), entry.Action, orDash(entry.Error))
+	}
+	return errors.Trace(w.Flush())
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
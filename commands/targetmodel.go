@@ -0,0 +1,118 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	names2 "gopkg.in/juju/names.v2"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+)
+
+// targetModelOptions specify how the imported model should differ
+// from the 1.25 environment in the target controller.
+type targetModelOptions struct {
+	cloud              string
+	modelName          string
+	owner              string
+	credentialName     string
+	existingCredential string
+
+	// storagePoolMapFile is the path of the YAML storage pool map on
+	// the client. The map is read from it and passed on to the
+	// remote command encoded in storagePoolMapData.
+	storagePoolMapFile string
+	storagePoolMapData string
+	storagePools       storagePoolMap
+}
+
+func (o *targetModelOptions) setFlags(f *gnuflag.FlagSet) {
+	f.StringVar(&o.cloud, "target-cloud", "", "The cloud, or <cloud>/<region>, in the target controller (found by matching the environment's endpoint and region by default)")
+	f.StringVar(&o.modelName, "model-name", "", "The name to give the model in the target controller (defaults to the environment name)")
+	f.StringVar(&o.owner, "owner", "", "The target controller user to own the model (defaults to the environment owner)")
+	f.StringVar(&o.credentialName, "credential-name", "", "The name to give the model's cloud credential (defaults to <owner>-<environment name>)")
+	f.StringVar(&o.existingCredential, "existing-credential", "", "Use the owner's named credential in the target controller instead of the environment's secrets")
+	f.StringVar(&o.storagePoolMapFile, "storage-pool-map", "", "Path of a YAML file mapping 1.25 storage pools or provider types onto 2.x provider types and attributes")
+	f.StringVar(&o.storagePoolMapData, "storage-pool-map-data", "", "The encoded storage pool map (used to pass --storage-pool-map to the remote command)")
+}
+
+func (o *targetModelOptions) validate() error {
+	if o.modelName != "" && !names2.IsValidModelName(o.modelName) {
+		return errors.NotValidf("model name %q", o.modelName)
+	}
+	if o.owner != "" && !names2.IsValidUser(o.owner) {
+		return errors.NotValidf("owner %q", o.owner)
+	}
+	if o.credentialName != "" && !names2.IsValidCloudCredentialName(o.credentialName) {
+		return errors.NotValidf("credential name %q", o.credentialName)
+	}
+	if o.existingCredential != "" && !names2.IsValidCloudCredentialName(o.existingCredential) {
+		return errors.NotValidf("credential name %q", o.existingCredential)
+	}
+	if o.credentialName != "" && o.existingCredential != "" {
+		return errors.New("--credential-name and --existing-credential can't be used together")
+	}
+	if o.storagePoolMapFile != "" {
+		if o.storagePoolMapData != "" {
+			return errors.New("--storage-pool-map and --storage-pool-map-data can't be used together")
+		}
+		poolMap, err := readStoragePoolMap(o.storagePoolMapFile)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if o.storagePoolMapData, err = poolMap.encode(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if o.storagePoolMapData != "" {
+		poolMap, err := decodeStoragePoolMap(o.storagePoolMapData)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		o.storagePools = poolMap
+	}
+	return nil
+}
+
+// args returns the flags needed to pass the options on to the
+// remote command.
+func (o *targetModelOptions) args() []string {
+	var args []string
+	if o.cloud != "" {
+		args = append(args, "--target-cloud", o.cloud)
+	}
+	if o.modelName != "" {
+		args = append(args, "--model-name", o.modelName)
+	}
+	if o.owner != "" {
+		args = append(args, "--owner", o.owner)
+	}
+	if o.credentialName != "" {
+		args = append(args, "--credential-name", o.credentialName)
+	}
+	if o.existingCredential != "" {
+		args = append(args, "--existing-credential", o.existingCredential)
+	}
+	if o.storagePoolMapData != "" {
+		args = append(args, "--storage-pool-map-data", o.storagePoolMapData)
+	}
+	return args
+}
+
+// exportOverrides returns the overrides to apply when exporting the
+// environment.
+func (o *targetModelOptions) exportOverrides() state.ExportOverrides {
+	overrides := state.ExportOverrides{
+		Cloud:              o.cloud,
+		ModelName:          o.modelName,
+		CredentialName:     o.credentialName,
+		ExistingCredential: o.existingCredential,
+		StoragePools:       o.storagePools.mappings(),
+	}
+	if o.owner != "" {
+		overrides.Owner = names2.NewUserTag(o.owner)
+	}
+	return overrides
+}
@@ -23,20 +23,48 @@ import (
 
 const toolsURLTemplate = "https://%s/tools/%s-%s"
 
-func newToolsWrangler(conn api.Connection) *toolsWrangler {
+func newToolsWrangler(conn api.Connection, info *api.Info, source toolsSourceOptions) (*toolsWrangler, error) {
+	client, err := newControllerHTTPClient(info)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
 	return &toolsWrangler{
 		conn:   conn,
-		client: utils.GetNonValidatingHTTPClient(),
+		client: client,
+		source: source,
 		cache:  make(map[string]*coretools.Tools),
-	}
+	}, nil
 }
 
 type toolsWrangler struct {
 	conn   api.Connection
 	client *http.Client
+	source toolsSourceOptions
 	cache  map[string]*coretools.Tools
 }
 
+// newControllerHTTPClient returns an HTTP client that only trusts the
+// controller's certificate, validated in the same way as the API
+// connection.
+func newControllerHTTPClient(info *api.Info) (*http.Client, error) {
+	tlsConfig := utils.SecureTLSConfig()
+	if info.CACert != "" {
+		certPool, err := api.CreateCertPool(info.CACert)
+		if err != nil {
+			return nil, errors.Annotate(err, "creating controller CA cert pool")
+		}
+		tlsConfig.RootCAs = certPool
+		tlsConfig.ServerName = "juju-apiserver"
+	} else {
+		// The controller has a certificate signed by a public
+		// CA, so validate it against the system roots.
+		tlsConfig.ServerName = info.SNIHostName
+	}
+	return &http.Client{
+		Transport: utils.NewHttpTLSTransport(tlsConfig),
+	}, nil
+}
+
 func (tw *toolsWrangler) version() version.Number {
 	version, ok := tw.conn.ServerVersion()
 	if !ok {
@@ -65,6 +93,19 @@ func (tw *toolsWrangler) getTools(seriesArch string) error {
 		return nil
 	}
 
+	// Ensure the toolsDir exists.
+	if err := os.MkdirAll(toolsDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+
+	if tw.source.source != "" {
+		tools, err := tw.source.find(toolsVersion)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return errors.Trace(tw.source.download(tools, downloadedTools))
+	}
+
 	logger.Infof("Downloading tools: %s\n", toolsURL)
 	resp, err := tw.client.Get(toolsURL)
 	if err != nil {
@@ -75,10 +116,6 @@ func (tw *toolsWrangler) getTools(seriesArch string) error {
 		return errors.Errorf("bad HTTP response: %v", resp.Status)
 	}
 
-	// Ensure the toolsDir exists.
-	if err := os.MkdirAll(toolsDir, 0755); err != nil {
-		return errors.Trace(err)
-	}
 	err = writeFile(downloadedTools, 0644, resp.Body)
 	if err != nil {
 		return errors.Errorf("cannot save tools: %v", err)
@@ -114,12 +151,14 @@ func (tw *toolsWrangler) metadata(seriesArch string) (*coretools.Tools, error) {
 		return nil, errors.Trace(err)
 	}
 
-	return &coretools.Tools{
+	tools := &coretools.Tools{
 		Version: tw.binary(seriesArch),
 		URL:     tw.url(seriesArch),
 		Size:    info.Size(),
 		SHA256:  hex.EncodeToString(hash.Sum(nil)),
-	}, nil
+	}
+	tw.cache[seriesArch] = tools
+	return tools, nil
 }
 
 func (tw *toolsWrangler) uploadTools(modelUUID, seriesArch string) error {
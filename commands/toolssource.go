@@ -0,0 +1,148 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/utils"
+	"github.com/juju/version"
+
+	"github.com/juju/1.25-upgrade/juju2/environs/simplestreams"
+	envtools "github.com/juju/1.25-upgrade/juju2/environs/tools"
+	"github.com/juju/1.25-upgrade/juju2/juju/keys"
+	coretools "github.com/juju/1.25-upgrade/juju2/tools"
+)
+
+// toolsSourceOptions specify where to get agent tools from when the
+// target controller can't be asked for them, such as in an air-gapped
+// environment.
+type toolsSourceOptions struct {
+	// source is the base URL of a simplestreams tools mirror, or a
+	// directory on machine 0 laid out like one.
+	source string
+
+	// stream is the simplestreams stream to look for tools in.
+	stream string
+
+	// publicKeyFile is the path of the key the simplestreams
+	// metadata is signed with. The Juju key is used if it's empty.
+	publicKeyFile string
+}
+
+func (o *toolsSourceOptions) setFlags(f *gnuflag.FlagSet) {
+	f.StringVar(&o.source, "tools-source", "", "Simplestreams tools mirror URL, or directory on machine 0, to get tools from instead of the controller")
+	f.StringVar(&o.stream, "tools-stream", envtools.ReleasedStream, "The stream to find tools in when using --tools-source")
+	f.StringVar(&o.publicKeyFile, "tools-public-key", "", "Path on machine 0 of the key used to sign the --tools-source metadata")
+}
+
+// args returns the flags needed to pass the options on to the
+// remote command.
+func (o *toolsSourceOptions) args() []string {
+	var args []string
+	if o.source != "" {
+		args = append(args, "--tools-source", utils.ShQuote(o.source))
+	}
+	if o.stream != envtools.ReleasedStream {
+		args = append(args, "--tools-stream", utils.ShQuote(o.stream))
+	}
+	if o.publicKeyFile != "" {
+		args = append(args, "--tools-public-key", utils.ShQuote(o.publicKeyFile))
+	}
+	return args
+}
+
+// dataSource returns the simplestreams data source for the options.
+// Only signed metadata is accepted, so the tools' SHA256 can be
+// trusted.
+func (o *toolsSourceOptions) dataSource() (simplestreams.DataSource, error) {
+	publicKey := keys.JujuPublicKey
+	if o.publicKeyFile != "" {
+		data, err := ioutil.ReadFile(o.publicKeyFile)
+		if err != nil {
+			return nil, errors.Annotate(err, "reading tools public key")
+		}
+		publicKey = string(data)
+	}
+	baseURL := o.source
+	if !strings.Contains(baseURL, "://") {
+		path, err := filepath.Abs(baseURL)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		baseURL = "file://" + path
+	}
+	return simplestreams.NewURLSignedDataSource(
+		"tools source", baseURL, publicKey,
+		utils.VerifySSLHostnames, simplestreams.CUSTOM_CLOUD_DATA, true,
+	), nil
+}
+
+// find returns the metadata for the specified tools from the source.
+func (o *toolsSourceOptions) find(binary version.Binary) (*coretools.Tools, error) {
+	source, err := o.dataSource()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	list, err := envtools.FindToolsForCloud(
+		[]simplestreams.DataSource{source},
+		simplestreams.CloudSpec{},
+		o.stream,
+		binary.Major, binary.Minor,
+		coretools.Filter{
+			Number: binary.Number,
+			Series: binary.Series,
+			Arch:   binary.Arch,
+		},
+	)
+	if err != nil {
+		return nil, errors.Annotatef(err, "finding tools %s in %s", binary, o.source)
+	}
+	return list[0], nil
+}
+
+// download saves the tools to the specified path, as long as they
+// match the size and SHA256 in their metadata.
+func (o *toolsSourceOptions) download(tools *coretools.Tools, toolsPath string) error {
+	client := utils.GetHTTPClient(utils.VerifySSLHostnames)
+	logger.Infof("Downloading tools: %s\n", tools.URL)
+	resp, err := client.Get(utils.MakeFileURL(tools.URL))
+	if err != nil {
+		return errors.Annotatef(err, "downloading tools %s", tools.Version)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("bad HTTP response: %v", resp.Status)
+	}
+
+	// Write to a temporary file first, so bad tools are never
+	// mistaken for good ones already downloaded.
+	tempPath := toolsPath + ".partial"
+	defer os.Remove(tempPath)
+	hash := sha256.New()
+	err = writeFile(tempPath, 0644, io.TeeReader(resp.Body, hash))
+	if err != nil {
+		return errors.Errorf("cannot save tools: %v", err)
+	}
+	info, err := os.Stat(tempPath)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if info.Size() != tools.Size {
+		return errors.Errorf("tools %s are %d bytes, expected %d", tools.Version, info.Size(), tools.Size)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != tools.SHA256 {
+		return errors.Errorf("tools %s have SHA256 %s, expected %s", tools.Version, sum, tools.SHA256)
+	}
+	return errors.Trace(os.Rename(tempPath, toolsPath))
+}
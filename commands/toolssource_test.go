@@ -0,0 +1,163 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/version"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju2/api"
+	sstesting "github.com/juju/1.25-upgrade/juju2/environs/simplestreams/testing"
+	toolstesting "github.com/juju/1.25-upgrade/juju2/environs/tools/testing"
+	coretesting "github.com/juju/1.25-upgrade/juju2/testing"
+)
+
+type toolsSourceSuite struct {
+	dir     string
+	keyFile string
+}
+
+var _ = gc.Suite(&toolsSourceSuite{})
+
+const testToolsVersion = "2.2.4-xenial-amd64"
+
+func (s *toolsSourceSuite) SetUpTest(c *gc.C) {
+	s.dir = c.MkDir()
+	toolstesting.MakeToolsWithCheckSum(c, s.dir, "released", []string{testToolsVersion})
+	s.keyFile = filepath.Join(c.MkDir(), "key.pub")
+	err := ioutil.WriteFile(s.keyFile, []byte(sstesting.SignedMetadataPublicKey), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *toolsSourceSuite) options() *toolsSourceOptions {
+	return &toolsSourceOptions{
+		source:        s.dir,
+		stream:        "released",
+		publicKeyFile: s.keyFile,
+	}
+}
+
+func (s *toolsSourceSuite) TestArgsQuoted(c *gc.C) {
+	o := &toolsSourceOptions{
+		source:        "/var/lib/my tools",
+		stream:        "devel",
+		publicKeyFile: "/home/ubuntu/key's.pub",
+	}
+	c.Assert(o.args(), jc.DeepEquals, []string{
+		"--tools-source", `'/var/lib/my tools'`,
+		"--tools-stream", `'devel'`,
+		"--tools-public-key", `'/home/ubuntu/key'"'"'s.pub'`,
+	})
+}
+
+func (s *toolsSourceSuite) TestFindSignedIndex(c *gc.C) {
+	binary := version.MustParseBinary(testToolsVersion)
+	tools, err := s.options().find(binary)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(tools.Version, gc.Equals, binary)
+	size, sha256 := toolstesting.SHA256sum(c, tools.URL)
+	c.Assert(tools.Size, gc.Equals, size)
+	c.Assert(tools.SHA256, gc.Equals, sha256)
+}
+
+func (s *toolsSourceSuite) TestFindRejectsOtherSigner(c *gc.C) {
+	// Without the test key the metadata is checked against the Juju
+	// key, which didn't sign it.
+	o := s.options()
+	o.publicKeyFile = ""
+	_, err := o.find(version.MustParseBinary(testToolsVersion))
+	c.Assert(err, gc.ErrorMatches, "finding tools "+testToolsVersion+" in .*")
+}
+
+func (s *toolsSourceSuite) TestDownload(c *gc.C) {
+	o := s.options()
+	tools, err := o.find(version.MustParseBinary(testToolsVersion))
+	c.Assert(err, jc.ErrorIsNil)
+	toolsPath := filepath.Join(c.MkDir(), "tools.tgz")
+	err = o.download(tools, toolsPath)
+	c.Assert(err, jc.ErrorIsNil)
+	data, err := ioutil.ReadFile(toolsPath)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, testToolsVersion)
+}
+
+func (s *toolsSourceSuite) TestDownloadSHA256Mismatch(c *gc.C) {
+	o := s.options()
+	tools, err := o.find(version.MustParseBinary(testToolsVersion))
+	c.Assert(err, jc.ErrorIsNil)
+	tools.SHA256 = "0bad"
+	toolsPath := filepath.Join(c.MkDir(), "tools.tgz")
+	err = o.download(tools, toolsPath)
+	c.Assert(err, gc.ErrorMatches, "tools "+testToolsVersion+" have SHA256 [0-9a-f]+, expected 0bad")
+	s.assertNotSaved(c, toolsPath)
+}
+
+func (s *toolsSourceSuite) TestDownloadSizeMismatch(c *gc.C) {
+	o := s.options()
+	tools, err := o.find(version.MustParseBinary(testToolsVersion))
+	c.Assert(err, jc.ErrorIsNil)
+	tools.Size++
+	toolsPath := filepath.Join(c.MkDir(), "tools.tgz")
+	err = o.download(tools, toolsPath)
+	c.Assert(err, gc.ErrorMatches, "tools "+testToolsVersion+" are [0-9]+ bytes, expected [0-9]+")
+	s.assertNotSaved(c, toolsPath)
+}
+
+func (s *toolsSourceSuite) assertNotSaved(c *gc.C, toolsPath string) {
+	_, err := os.Stat(toolsPath)
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+	_, err = os.Stat(toolsPath + ".partial")
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+}
+
+type controllerHTTPClientSuite struct {
+	server *httptest.Server
+}
+
+var _ = gc.Suite(&controllerHTTPClientSuite{})
+
+func (s *controllerHTTPClientSuite) SetUpTest(c *gc.C) {
+	serverCert, err := tls.X509KeyPair([]byte(coretesting.ServerCert), []byte(coretesting.ServerKey))
+	c.Assert(err, jc.ErrorIsNil)
+	s.server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tools"))
+	}))
+	s.server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	s.server.StartTLS()
+}
+
+func (s *controllerHTTPClientSuite) TearDownTest(c *gc.C) {
+	s.server.Close()
+}
+
+func (s *controllerHTTPClientSuite) TestTrustsControllerCA(c *gc.C) {
+	client, err := newControllerHTTPClient(&api.Info{CACert: coretesting.CACert})
+	c.Assert(err, jc.ErrorIsNil)
+	resp, err := client.Get(s.server.URL)
+	c.Assert(err, jc.ErrorIsNil)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, "tools")
+}
+
+func (s *controllerHTTPClientSuite) TestRejectsCertNotSignedByCA(c *gc.C) {
+	client, err := newControllerHTTPClient(&api.Info{CACert: coretesting.OtherCACert})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = client.Get(s.server.URL)
+	c.Assert(err, gc.ErrorMatches, ".*certificate signed by unknown authority.*")
+}
+
+func (s *controllerHTTPClientSuite) TestBadCACert(c *gc.C) {
+	_, err := newControllerHTTPClient(&api.Info{CACert: "not a cert"})
+	c.Assert(err, gc.ErrorMatches, "creating controller CA cert pool: .*")
+}
@@ -7,22 +7,22 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
-	"text/template"
+	"strings"
+	"sync"
 
 	"github.com/juju/cmd"
 	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
 	"github.com/juju/utils/set"
-	"github.com/juju/utils/ssh"
 	"github.com/juju/version"
-	"golang.org/x/sync/errgroup"
 
 	"github.com/juju/1.25-upgrade/juju2/api"
+	coretools "github.com/juju/1.25-upgrade/juju2/tools"
 )
 
-//go:generate go run ../juju2/generate/filetoconst/filetoconst.go agentUpgradeScript agent-upgrade.py agentupgrade_script.go 2017 commands
-
 var upgradeAgentsDoc = `
 
 The purpose of the upgrade-agents command is to upgrade the agents on the 1.25
@@ -32,6 +32,21 @@ This command updates the tools symlinks for the agents, and updates their
 agent config files to specify the correct version, along with the CA Cert and
 addresses of the controller.
 
+Ubuntu, CentOS and Windows machines are supported.
+
+By default all the machines are upgraded at once. Specify --canary to upgrade
+and check some machines before the others, and --batch-by to upgrade the rest
+in batches of machines, applications or availability zones. If more than
+--max-failure-ratio of the machines in a batch (or any canary) fail, the
+upgrade stops; use abort to roll back the machines that have been upgraded.
+A machine fails if the files can't be copied to it, its upgrade fails, or its
+agents can't connect to the controller afterwards.
+
+Examples:
+
+    juju 1.25-upgrade upgrade-agents source target --canary 3,4 --batch-by zone
+    juju 1.25-upgrade upgrade-agents source target --batch-by application --batch-size 5 --max-failure-ratio 0.2
+
 `
 
 func newUpgradeAgentsCommand() cmd.Command {
@@ -45,6 +60,14 @@ func newUpgradeAgentsCommand() cmd.Command {
 
 type upgradeAgentsCommand struct {
 	baseClientCommand
+	rollout     rolloutOptions
+	toolsSource toolsSourceOptions
+}
+
+func (c *upgradeAgentsCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.baseClientCommand.SetFlags(f)
+	c.rollout.setFlags(f)
+	c.toolsSource.setFlags(f)
 }
 
 func (c *upgradeAgentsCommand) Info() *cmd.Info {
@@ -61,9 +84,18 @@ func (c *upgradeAgentsCommand) Init(args []string) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
+	if err := c.rollout.validate(); err != nil {
+		return errors.Trace(err)
+	}
 	return cmd.CheckEmpty(args)
 }
 
+func (c *upgradeAgentsCommand) Run(ctx *cmd.Context) error {
+	c.extraOptions = append(c.extraOptions, c.rollout.args()...)
+	c.extraOptions = append(c.extraOptions, c.toolsSource.args()...)
+	return c.baseClientCommand.Run(ctx)
+}
+
 var upgradeAgentsImplDoc = `
 
 upgrade-agents-impl must be executed on an API server machine of a 1.25
@@ -82,6 +114,14 @@ func newUpgradeAgentsImplCommand() cmd.Command {
 
 type upgradeAgentsImplCommand struct {
 	baseRemoteCommand
+	rollout     rolloutOptions
+	toolsSource toolsSourceOptions
+}
+
+func (c *upgradeAgentsImplCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.baseRemoteCommand.SetFlags(f)
+	c.rollout.setFlags(f)
+	c.toolsSource.setFlags(f)
 }
 
 func (c *upgradeAgentsImplCommand) Init(args []string) error {
@@ -89,7 +129,9 @@ func (c *upgradeAgentsImplCommand) Init(args []string) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
-
+	if err := c.rollout.validate(); err != nil {
+		return errors.Trace(err)
+	}
 	return cmd.CheckEmpty(args)
 }
 
@@ -133,13 +175,22 @@ func (c *upgradeAgentsImplCommand) Run(ctx *cmd.Context) error {
 	fmt.Fprintf(ctx.Stdout, "Controller addresses: %#v\n", conn.APIHostPorts())
 	fmt.Fprintf(ctx.Stdout, "Controller UUID: %s\n", conn.ControllerTag().Id())
 
-	// Emit the upgrade script for pushing to other machines.
-	scriptPath, err := c.writeUpgradeScript(&scriptConfig{
+	upgraders, err := machineAgentUpgraders(machines)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	batches, err := c.rollout.plan(machines)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	// Emit the upgrade scripts for pushing to other machines.
+	config := &scriptConfig{
 		ControllerTag:  conn.ControllerTag().String(),
 		ControllerInfo: c.controllerInfo,
 		Version:        ver,
-	})
-	if err != nil {
+	}
+	if err := c.writeUpgradeScripts(config); err != nil {
 		return errors.Trace(err)
 	}
 
@@ -150,31 +201,134 @@ func (c *upgradeAgentsImplCommand) Run(ctx *cmd.Context) error {
 	}
 
 	// Get the tools from the controller.
-	tw := newToolsWrangler(conn)
+	tw, err := newToolsWrangler(conn, c.controllerInfo, c.toolsSource)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	tools := make(map[string]*coretools.Tools)
 	for _, seriesArch := range toolsNeeded.SortedValues() {
-		if err := tw.getTools(seriesArch); err != nil {
+		metadata, err := tw.metadata(seriesArch)
+		if err != nil {
 			return errors.Trace(err)
 		}
+		tools[seriesArch] = metadata
 	}
 
-	if err := c.pushTools(ctx, ver, scriptPath, machines); err != nil {
-		return errors.Trace(err)
+	var failed []string
+	for n, batch := range batches {
+		batchMachines := make([]FlatMachine, len(batch))
+		batchUpgraders := make([]agentUpgrader, len(batch))
+		for i, index := range batch {
+			batchMachines[i] = machines[index]
+			batchUpgraders[i] = upgraders[index]
+		}
+		fmt.Fprintf(ctx.Stdout, "Upgrading batch %d of %d: machines %s\n",
+			n+1, len(batches), strings.Join(machineIDs(batchMachines), ", "))
+		batchFailed, err := c.upgradeBatch(ctx, tools, config, batchMachines, batchUpgraders)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		failed = append(failed, batchFailed...)
+
+		// Canaries are there to catch problems, so any failure
+		// among them stops the upgrade.
+		maxFailureRatio := c.rollout.maxFailureRatio
+		if n == 0 && len(c.rollout.canaries) > 0 {
+			maxFailureRatio = 0
+		}
+		if float64(len(batchFailed))/float64(len(batch)) > maxFailureRatio {
+			var remaining []string
+			for _, later := range batches[n+1:] {
+				for _, index := range later {
+					remaining = append(remaining, machines[index].ID)
+				}
+			}
+			return errors.Errorf(
+				"%d of %d machines failed in batch %d, stopping with machines not upgraded: %s",
+				len(batchFailed), len(batch), n+1, strings.Join(remaining, ", "))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("upgrade failed on machines: %s", strings.Join(failed, ", "))
 	}
+	return nil
+}
 
-	targets := flatMachineExecTargets(machines...)
-	results, err := parallelExec(targets, "apt-get install --yes python3 python3-yaml; python3 ~/1.25-agent-upgrade/agent-upgrade.py")
+// upgradeBatch upgrades the agents on the machines and checks their
+// connections to the controller, returning the IDs of the machines
+// where any step failed.
+func (c *upgradeAgentsImplCommand) upgradeBatch(
+	ctx *cmd.Context,
+	tools map[string]*coretools.Tools,
+	config *scriptConfig,
+	batchMachines []FlatMachine,
+	batchUpgraders []agentUpgrader,
+) ([]string, error) {
+	// Machines that the files couldn't be copied to count as failed,
+	// and the rest of the batch carries on without them.
+	var failed []string
+	var machines []FlatMachine
+	var upgraders []agentUpgrader
+	for i, err := range c.pushTools(tools, config, batchMachines, batchUpgraders) {
+		if err != nil {
+			logger.Errorf("copying files to machine %s: %v", batchMachines[i].ID, err)
+			failed = append(failed, batchMachines[i].ID)
+			continue
+		}
+		machines = append(machines, batchMachines[i])
+		upgraders = append(upgraders, batchUpgraders[i])
+	}
+	if len(machines) == 0 {
+		return failed, nil
+	}
+
+	// Record the machines before running the upgrade script on them,
+	// so abort knows which to roll back even if this is interrupted.
+	if err := recordUpgradedMachines(machineIDs(machines)...); err != nil {
+		return nil, errors.Annotate(err, "recording upgraded machines")
+	}
+	results, err := agentUpgradeExec("upgrade", machines, upgraders, agentUpgrader.upgradeScript)
 	if err != nil {
-		return errors.Trace(err)
+		return nil, errors.Trace(err)
 	}
 	if err := reportResults(ctx, "upgrade", machines, results); err != nil {
-		return errors.Trace(err)
+		logger.Warningf("%v", err)
+	}
+	var upgraded []FlatMachine
+	var upgradedUpgraders []agentUpgrader
+	for i, result := range results {
+		if result.Code != 0 {
+			failed = append(failed, machines[i].ID)
+			continue
+		}
+		upgraded = append(upgraded, machines[i])
+		upgradedUpgraders = append(upgradedUpgraders, upgraders[i])
+	}
+	if len(upgraded) == 0 {
+		return failed, nil
 	}
 
-	results, err = parallelExec(targets, connectionCheckScript)
+	results, err = agentUpgradeExec("connection check", upgraded, upgradedUpgraders, agentUpgrader.connectionCheckScript)
 	if err != nil {
-		return errors.Trace(err)
+		return nil, errors.Trace(err)
+	}
+	if err := reportResults(ctx, "connection check", upgraded, results); err != nil {
+		logger.Warningf("%v", err)
 	}
-	return errors.Trace(reportResults(ctx, "connection check", machines, results))
+	for i, result := range results {
+		if result.Code != 0 {
+			failed = append(failed, upgraded[i].ID)
+		}
+	}
+	return failed, nil
+}
+
+func machineIDs(machines []FlatMachine) []string {
+	ids := make([]string, len(machines))
+	for i, machine := range machines {
+		ids[i] = machine.ID
+	}
+	return ids
 }
 
 func (c *upgradeAgentsImplCommand) saveMachines(machines []FlatMachine) error {
@@ -192,76 +346,99 @@ func (c *upgradeAgentsImplCommand) saveMachines(machines []FlatMachine) error {
 		bytes.NewBuffer(fileData)))
 }
 
-func (c *upgradeAgentsImplCommand) pushTools(ctx *cmd.Context, ver version.Number, scriptPath string, machines []FlatMachine) error {
-	var group errgroup.Group
+// pushTools copies the tools and upgrade files to the machines,
+// returning the error for each machine, or nil if the copy succeeded.
+func (c *upgradeAgentsImplCommand) pushTools(tools map[string]*coretools.Tools, config *scriptConfig, machines []FlatMachine, upgraders []agentUpgrader) []error {
+	// Copy the tools and plugin to each container host once, rather
+	// than through the host to each of its containers.
+	hostErrors := distributeHostTools(machines, upgraders, tools)
+
+	reporter.startPhase("copy tools", len(machines))
+	errs := make([]error, len(machines))
+	var wg sync.WaitGroup
 	for i := range machines {
-		machine := machines[i]
-		group.Go(func() error {
-			return errors.Annotatef(
-				c.pushToolsToMachine(ctx, ver, scriptPath, machine),
-				"machine %s", machine.ID)
-		})
+		machine, upgrader := machines[i], upgraders[i]
+		if err := hostErrors[machine.HostAddress]; err != nil {
+			errs[i] = errors.Annotate(err, "distributing tools to container host")
+			reporter.finished("copy tools", machine.ID, 0, errs[i])
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = upgrader.pushFiles(machine, tools[seriesArch(machine)], config)
+			reporter.finished("copy tools", machine.ID, 0, errs[i])
+		}(i)
 	}
 	logger.Debugf("waiting for copies to finish")
-	return group.Wait()
+	wg.Wait()
+	return errs
 }
 
-func (c *upgradeAgentsImplCommand) pushToolsToMachine(ctx *cmd.Context, ver version.Number, scriptPath string, machine FlatMachine) error {
-	sshOptions := []execOption{withSystemIdentity()}
-	throttleAddress := machine.Address
-	if machine.HostAddress != "" {
-		throttleAddress = machine.HostAddress
-		sshOptions = append(sshOptions, withProxyCommandForHost(machine.HostAddress))
+// upgradedMachinesFile records the IDs of the machines that the
+// upgrade script has been run on, which are the ones abort rolls back.
+const upgradedMachinesFile = "upgraded-machines.json"
+
+// recordUpgradedMachines adds the machines to the upgraded machines
+// file.
+func recordUpgradedMachines(ids ...string) error {
+	upgraded, err := loadUpgradedMachines()
+	if os.IsNotExist(errors.Cause(err)) {
+		upgraded = set.NewStrings()
+	} else if err != nil {
+		return errors.Trace(err)
+	}
+	for _, id := range ids {
+		upgraded.Add(id)
 	}
+	return errors.Trace(saveUpgradedMachines(upgraded))
+}
 
-	logger.Debugf("making target dir for machine %s", machine.ID)
-	rc, err := runViaSSH(
-		machine.Address,
-		"rm -rf 1.25-agent-upgrade; mkdir 1.25-agent-upgrade; chown ubuntu:ubuntu 1.25-agent-upgrade",
-		sshOptions...,
-	)
+// loadUpgradedMachines returns the IDs in the upgraded machines file.
+func loadUpgradedMachines() (set.Strings, error) {
+	data, err := ioutil.ReadFile(path.Join(toolsDir, upgradedMachinesFile))
 	if err != nil {
-		return errors.Trace(err)
-	}
-	if rc != 0 {
-		return &cmd.RcPassthroughError{Code: rc}
+		return nil, errors.Trace(err)
 	}
-	toolsPath := toolsFilePath(ver, seriesArch(machine))
-	options := defaultSSHOptions()
-	options.SetIdentities(systemIdentity)
-	if machine.HostAddress != "" {
-		options.SetProxyCommand(makeProxyCommand(machine.HostAddress)...)
+	var ids []string
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, errors.Trace(err)
 	}
-	logger.Debugf("copying upgrade script and %s to machine %s", toolsPath, machine.ID)
-	args := []string{toolsPath, scriptPath, fmt.Sprintf("ubuntu@%s:~/1.25-agent-upgrade/", machine.Address)}
-
-	throttler.Acquire(throttleAddress)
-	defer throttler.Release(throttleAddress)
+	return set.NewStrings(ids...), nil
+}
 
-	err = ssh.Copy(args, &options)
+func saveUpgradedMachines(ids set.Strings) error {
+	if err := os.MkdirAll(toolsDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	data, err := json.Marshal(ids.SortedValues())
 	if err != nil {
 		return errors.Trace(err)
 	}
-	return nil
+	return errors.Trace(writeFile(
+		path.Join(toolsDir, upgradedMachinesFile),
+		0644,
+		bytes.NewReader(data)))
 }
 
-func (c *upgradeAgentsImplCommand) writeUpgradeScript(config *scriptConfig) (string, error) {
-	tmpl, err := template.New("upgrade-script").Parse(agentUpgradeScript)
-	if err != nil {
-		return "", errors.Trace(err)
-	}
-	var script bytes.Buffer
-	err = tmpl.Execute(&script, config)
+func (c *upgradeAgentsImplCommand) writeUpgradeScripts(config *scriptConfig) error {
+	data, err := json.Marshal(newAgentUpgradeConfig(config))
 	if err != nil {
-		return "", errors.Trace(err)
+		return errors.Trace(err)
 	}
-	scriptPath := path.Join(toolsDir, "agent-upgrade.py")
-	err = writeFile(scriptPath, 0644, &script)
+	err = writeFile(path.Join(toolsDir, agentUpgradeConfigFile), 0644, bytes.NewReader(data))
 	if err != nil {
-		return "", errors.Trace(err)
+		return errors.Trace(err)
 	}
-	return scriptPath, nil
+	// The PowerShell script doesn't need any config - the agent
+	// configs are rewritten before they're copied to the machine.
+	err = writeFile(
+		path.Join(toolsDir, "agent-upgrade.ps1"),
+		0644,
+		strings.NewReader(agentUpgradePowerShellScript))
+	return errors.Trace(err)
 }
+
 func removeAll(dir string) {
 	err := os.RemoveAll(dir)
 	if err == nil || os.IsNotExist(err) {
@@ -4,19 +4,31 @@
 package commands
 
 import (
+	"fmt"
+	"io"
 	"strings"
+	"text/tabwriter"
 
+	_ "github.com/juju/1.25-upgrade/juju2/provider/ec2"
 	_ "github.com/juju/1.25-upgrade/juju2/provider/maas"
+	_ "github.com/juju/1.25-upgrade/juju2/provider/openstack"
 	"github.com/juju/cmd"
 	"github.com/juju/description"
 	"github.com/juju/errors"
 	"golang.org/x/sync/errgroup"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
 )
 
 var verifySourceDoc = `
 The purpose of the verify-source command is to check connectivity, status, and
 viability of a 1.25 juju environment for migration into a Juju 2.x controller.
 
+Services and machines that requested networks, with --networks or the
+networks constraint, are listed with the spaces the networks are
+converted to. Spaces that end up both included and excluded are listed
+as conflicting; only the inclusion is exported.
+
 `
 
 func newVerifySourceCommand() cmd.Command {
@@ -78,6 +90,9 @@ func (c *verifySourceImplCommand) Run(ctx *cmd.Context) error {
 		return errors.Annotate(err, "getting state")
 	}
 	defer st.Close()
+	if err := addressSelection.loadSpaces(st); err != nil {
+		return errors.Annotate(err, "loading address policy")
+	}
 
 	// Check that the LXC containers can be migrated to LXD.
 	opts := MigrateLXCOptions{DryRun: true}
@@ -102,11 +117,43 @@ func (c *verifySourceImplCommand) Run(ctx *cmd.Context) error {
 		return errors.Annotate(err, "dry-running LXC migration")
 	}
 
-	model, err := exportModel(st, "")
+	model, err := exportModel(st, state.ExportOverrides{})
 	if err != nil {
 		return errors.Annotate(err, "exporting model")
 	}
-	return errors.Annotate(writeModel(ctx, model), "writing model")
+	if err := writeModel(ctx, model); err != nil {
+		return errors.Annotate(err, "writing model")
+	}
+
+	conversions, err := st.NetworkConversions()
+	if err != nil {
+		return errors.Annotate(err, "converting networks to spaces")
+	}
+	if len(conversions) > 0 {
+		fmt.Fprintln(ctx.Stderr, "\nRequested networks are converted to spaces:")
+		return errors.Trace(writeNetworkConversions(ctx.Stderr, conversions))
+	}
+	return nil
+}
+
+func writeNetworkConversions(out io.Writer, conversions []state.NetworkConversion) error {
+	w := tabwriter.NewWriter(out, 0, 1, 2, ' ', 0)
+	fmt.Fprintln(w, "ENTITY\tREQUESTED\tCONSTRAINT\tSPACES\tBINDING\tUNMAPPED\tCONFLICTING")
+	for _, conversion := range conversions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			conversion.Entity(),
+			joinOrDash(conversion.Requested),
+			joinOrDash(conversion.Constraint),
+			joinOrDash(conversion.Spaces),
+			orDash(conversion.Binding),
+			joinOrDash(conversion.Unmapped),
+			joinOrDash(conversion.Conflicting))
+	}
+	return errors.Trace(w.Flush())
+}
+
+func joinOrDash(values []string) string {
+	return orDash(strings.Join(values, ","))
 }
 
 func writeModel(ctx *cmd.Context, model description.Model) error {
@@ -0,0 +1,48 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+)
+
+type verifySourceSuite struct{}
+
+var _ = gc.Suite(&verifySourceSuite{})
+
+func (*verifySourceSuite) TestWriteNetworkConversions(c *gc.C) {
+	var out bytes.Buffer
+	err := writeNetworkConversions(&out, []state.NetworkConversion{{
+		GlobalKey:  "m#1",
+		Constraint: []string{"db", "^public"},
+		Spaces:     []string{"db", "^dmz"},
+	}, {
+		GlobalKey:   "m#2",
+		Constraint:  []string{"db", "^db-backup"},
+		Spaces:      []string{"db"},
+		Conflicting: []string{"db"},
+	}, {
+		GlobalKey: "s#mysql",
+		Requested: []string{"db-net", "backup"},
+		Spaces:    []string{"db"},
+		Unmapped:  []string{"backup"},
+	}, {
+		GlobalKey: "s#wordpress",
+		Requested: []string{"web"},
+		Spaces:    []string{"dmz"},
+		Binding:   "dmz",
+	}})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(out.String(), gc.Equals, ""+
+		"ENTITY             REQUESTED      CONSTRAINT     SPACES   BINDING  UNMAPPED  CONFLICTING\n"+
+		"machine 1          -              db,^public     db,^dmz  -        -         -\n"+
+		"machine 2          -              db,^db-backup  db       -        -         db\n"+
+		"service mysql      db-net,backup  -              db       -        backup    -\n"+
+		"service wordpress  web            -              dmz      dmz      -         -\n")
+}
@@ -0,0 +1,223 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+	"github.com/juju/utils/ssh"
+	"github.com/juju/version"
+	"gopkg.in/yaml.v2"
+
+	coretools "github.com/juju/1.25-upgrade/juju2/tools"
+)
+
+//go:generate go run ../juju2/generate/filetoconst/filetoconst.go agentUpgradePowerShellScript agent-upgrade.ps1 agentupgrade_ps_script.go 2017 commands
+
+const (
+	// windowsUser is the account used to SSH into Windows
+	// machines. Juju 1.25 doesn't set up SSH on Windows, so
+	// this relies on OpenSSH having been installed for the
+	// Administrator.
+	windowsUser      = "Administrator"
+	windowsAgentsDir = `C:\Juju\lib\juju\agents`
+)
+
+// windowsAgentUpgrader upgrades agents on Windows machines. The plugin
+// can't run there, so the agent configs are rewritten here and
+// agent-upgrade.ps1 just installs them along with the new tools.
+type windowsAgentUpgrader struct{}
+
+func (u *windowsAgentUpgrader) options() []execOption {
+	return []execOption{withUser(windowsUser), withPowerShell()}
+}
+
+// hostFiles is part of agentUpgrader. Windows machines have no
+// containers.
+func (u *windowsAgentUpgrader) hostFiles(machine FlatMachine, tools *coretools.Tools) ([]hostFile, error) {
+	return nil, nil
+}
+
+func (u *windowsAgentUpgrader) pushFiles(machine FlatMachine, tools *coretools.Tools, config *scriptConfig) error {
+	execOptions := append([]execOption{withSystemIdentity()}, u.options()...)
+
+	logger.Debugf("making target dir for machine %s", machine.ID)
+	var stdout bytes.Buffer
+	rc, err := runViaSSH(
+		machine.Address,
+		fmt.Sprintf(`
+Remove-Item -Recurse -Force -ErrorAction SilentlyContinue $HOME\%[1]s
+New-Item -ItemType Directory $HOME\%[1]s | Out-Null
+Get-ChildItem %[2]s | ForEach-Object { $_.Name }
+`, upgradeDir, windowsAgentsDir),
+		append(execOptions, withStdout(&stdout))...,
+	)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if rc != 0 {
+		return &cmd.RcPassthroughError{Code: rc}
+	}
+
+	configsDir := path.Join(toolsDir, "windows-configs", machine.ID, "configs")
+	if err := os.RemoveAll(configsDir); err != nil {
+		return errors.Trace(err)
+	}
+	if err := os.MkdirAll(configsDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	for _, agent := range strings.Fields(stdout.String()) {
+		if err := u.upgradeConfig(machine, agent, configsDir, config); err != nil {
+			return errors.Annotatef(err, "upgrading config for %s", agent)
+		}
+	}
+
+	toolsPath, err := unpackWindowsTools(tools.Version.Number, seriesArch(machine))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	scriptPath := path.Join(toolsDir, "agent-upgrade.ps1")
+	options := copyOptions(machine.Address, "")
+	logger.Debugf("copying upgrade script, configs and %s to machine %s", toolsPath, machine.ID)
+	args := []string{
+		"-r", toolsPath, scriptPath, configsDir,
+		fmt.Sprintf("%s@%s:%s/", windowsUser, machine.Address, upgradeDir),
+	}
+
+	throttleAddr := throttleAddress(machine.Address)
+	throttler.Acquire(throttleAddr)
+	defer throttler.Release(throttleAddr)
+
+	return errors.Trace(ssh.Copy(args, options))
+}
+
+// upgradeConfig reads the agent's config from the machine, converts
+// it to the 2.x format and saves it in configsDir to be copied back.
+func (u *windowsAgentUpgrader) upgradeConfig(machine FlatMachine, agent, configsDir string, config *scriptConfig) error {
+	var stdout bytes.Buffer
+	rc, err := runViaSSH(
+		machine.Address,
+		fmt.Sprintf(`Get-Content -Raw %s\%s\agent.conf`, windowsAgentsDir, agent),
+		append(u.options(), withSystemIdentity(), withStdout(&stdout))...,
+	)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if rc != 0 {
+		return &cmd.RcPassthroughError{Code: rc}
+	}
+	data, err := upgradeAgentConfig(agent, stdout.Bytes(), config)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(writeFile(
+		path.Join(configsDir, agent+".conf"),
+		0644,
+		bytes.NewReader(data),
+	))
+}
+
+func (u *windowsAgentUpgrader) upgradeScript() string {
+	return fmt.Sprintf(`& $HOME\%s\agent-upgrade.ps1`, upgradeDir)
+}
+
+func (u *windowsAgentUpgrader) rollbackScript() string {
+	return fmt.Sprintf(`& $HOME\%s\agent-upgrade.ps1 -Rollback`, upgradeDir)
+}
+
+func (u *windowsAgentUpgrader) connectionCheckScript() string {
+	return windowsConnectionCheckScript
+}
+
+// unpackWindowsTools extracts the tools tarball into a directory
+// beside it, since older versions of Windows have no way to unpack
+// it, and returns the directory.
+func unpackWindowsTools(ver version.Number, seriesArch string) (string, error) {
+	toolsPath := toolsFilePath(ver, seriesArch)
+	unpackedPath := strings.TrimSuffix(toolsPath, ".tgz")
+	if _, err := os.Stat(unpackedPath); err == nil {
+		return unpackedPath, nil
+	}
+	if err := unpackTools(toolsPath, unpackedPath); err != nil {
+		removeAll(unpackedPath)
+		return "", errors.Trace(err)
+	}
+	return unpackedPath, nil
+}
+
+const agentConfigFormat = "2.0"
+
+// oldControllerKeys are the agent config keys used by 1.25 state
+// servers that aren't needed once the machine is no longer a
+// controller.
+var oldControllerKeys = []string{
+	"stateservercert",
+	"stateserverkey",
+	"caprivatekey",
+	"apiport",
+	"stateport",
+	"sharedsecret",
+	"systemidentity",
+}
+
+// upgradeAgentConfig converts a 1.25 agent config into one that
+// points at the target controller. It makes the same changes as
+// upgradeLocalAgentConfig, but works on the YAML directly since the
+// config isn't on this machine.
+func upgradeAgentConfig(agent string, oldConfig []byte, config *scriptConfig) ([]byte, error) {
+	var data map[string]interface{}
+	if err := yaml.Unmarshal(oldConfig, &data); err != nil {
+		return nil, errors.Annotate(err, "parsing agent config")
+	}
+	if strings.HasPrefix(agent, "machine-") {
+		// None of these machines will need to manage the environ anymore.
+		data["jobs"] = []string{"JobHostUnits"}
+		// Get rid of API/mongo hosting keys.
+		for _, key := range oldControllerKeys {
+			delete(data, key)
+		}
+	}
+
+	envTag, ok := data["environment"].(string)
+	if !ok {
+		return nil, errors.New("agent config has no environment")
+	}
+	data["model"] = strings.Replace(envTag, "environment", "model", 1)
+	data["controller"] = config.ControllerTag
+	data["upgradedToVersion"] = config.Version.String()
+	data["cacert"] = config.ControllerInfo.CACert
+	data["apiaddresses"] = config.ControllerInfo.Addrs
+
+	// Get rid of unneeded attributes.
+	for _, key := range []string{"environment", "stateaddresses", "statepassword"} {
+		delete(data, key)
+	}
+
+	output, err := yaml.Marshal(data)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return append([]byte("# format "+agentConfigFormat+"\n"), output...), nil
+}
+
+const windowsConnectionCheckScript = `
+$failures = 0
+foreach ($agent in Get-ChildItem C:\Juju\lib\juju\agents) {
+    Set-Location C:\Juju\lib\juju
+    & "tools\$($agent.Name)\jujud.exe" check-connection $agent.Name
+    if ($LASTEXITCODE -eq 0) {
+        "connection check succeeded for $($agent.Name)"
+    } else {
+        "connection check failed for $($agent.Name)"
+        $failures = 1
+    }
+}
+exit $failures
+`
@@ -0,0 +1,88 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/version"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
+
+	"github.com/juju/1.25-upgrade/juju2/api"
+)
+
+type upgradeAgentConfigSuite struct{}
+
+var _ = gc.Suite(&upgradeAgentConfigSuite{})
+
+var testScriptConfig = &scriptConfig{
+	ControllerInfo: &api.Info{
+		Addrs:  []string{"10.0.0.1:17070", "10.0.0.2:17070"},
+		CACert: "new-ca-cert",
+	},
+	ControllerTag: "controller-deadbeef-0bad-400d-8000-4b1d0d06f00d",
+	Version:       version.MustParse("2.2.4"),
+}
+
+func parseUpgradedConfig(c *gc.C, data []byte) map[string]interface{} {
+	c.Assert(string(data), jc.HasPrefix, "# format 2.0\n")
+	var result map[string]interface{}
+	err := yaml.Unmarshal(data, &result)
+	c.Assert(err, jc.ErrorIsNil)
+	return result
+}
+
+func (*upgradeAgentConfigSuite) TestUnitConfig(c *gc.C) {
+	oldConfig := `
+# format 1.18
+tag: unit-mysql-0
+environment: environment-deadbeef-0bad-400d-8000-4b1d0d06f00d
+stateaddresses:
+- 10.0.0.9:37017
+statepassword: sekrit
+apipassword: apisekrit
+cacert: old-ca-cert
+`
+	data, err := upgradeAgentConfig("unit-mysql-0", []byte(oldConfig), testScriptConfig)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(parseUpgradedConfig(c, data), jc.DeepEquals, map[string]interface{}{
+		"tag":               "unit-mysql-0",
+		"model":             "model-deadbeef-0bad-400d-8000-4b1d0d06f00d",
+		"controller":        "controller-deadbeef-0bad-400d-8000-4b1d0d06f00d",
+		"upgradedToVersion": "2.2.4",
+		"apipassword":       "apisekrit",
+		"cacert":            "new-ca-cert",
+		"apiaddresses":      []interface{}{"10.0.0.1:17070", "10.0.0.2:17070"},
+	})
+}
+
+func (*upgradeAgentConfigSuite) TestMachineConfig(c *gc.C) {
+	oldConfig := `
+# format 1.18
+tag: machine-3
+environment: environment-deadbeef-0bad-400d-8000-4b1d0d06f00d
+stateaddresses:
+- 10.0.0.9:37017
+statepassword: sekrit
+jobs:
+- JobHostUnits
+- JobManageEnviron
+stateport: 37017
+sharedsecret: shh
+`
+	data, err := upgradeAgentConfig("machine-3", []byte(oldConfig), testScriptConfig)
+	c.Assert(err, jc.ErrorIsNil)
+	result := parseUpgradedConfig(c, data)
+	c.Assert(result["jobs"], jc.DeepEquals, []interface{}{"JobHostUnits"})
+	for _, key := range []string{"stateport", "sharedsecret", "environment", "statepassword"} {
+		_, found := result[key]
+		c.Check(found, jc.IsFalse, gc.Commentf("key %q", key))
+	}
+	c.Assert(result["model"], gc.Equals, "model-deadbeef-0bad-400d-8000-4b1d0d06f00d")
+}
+
+func (*upgradeAgentConfigSuite) TestMissingEnvironment(c *gc.C) {
+	_, err := upgradeAgentConfig("unit-mysql-0", []byte("tag: unit-mysql-0\n"), testScriptConfig)
+	c.Assert(err, gc.ErrorMatches, "agent config has no environment")
+}
@@ -198,6 +198,10 @@ type Config interface {
 	// the key is not found.
 	Value(key string) string
 
+	// AllValues returns a copy of all the key/value pairs in the
+	// config.
+	AllValues() map[string]string
+
 	// PreferIPv6 returns whether to prefer using IPv6 addresses (if
 	// available) when connecting to the state or API server.
 	PreferIPv6() bool
@@ -639,6 +643,14 @@ func (c *configInternal) Value(key string) string {
 	return c.values[key]
 }
 
+func (c *configInternal) AllValues() map[string]string {
+	values := make(map[string]string, len(c.values))
+	for key, value := range c.values {
+		values[key] = value
+	}
+	return values
+}
+
 func (c *configInternal) PreferIPv6() bool {
 	return c.preferIPv6
 }
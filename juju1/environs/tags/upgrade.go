@@ -0,0 +1,55 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package tags
+
+// TaggedResource describes a provider resource that belongs to an
+// environment, with the markers that tie it to the environment under
+// Juju 1.25 and Juju 2.x. Markers are usually tags, but resources
+// such as security groups are identified by name instead, so
+// providers may report other markers alongside the tags.
+type TaggedResource struct {
+	// Kind is the kind of resource, such as "server" or "volume".
+	Kind string
+
+	// Id identifies the resource in the provider.
+	Id string
+
+	// Name is the resource's name, if it has one.
+	Name string
+
+	// Juju1 holds the markers the resource has under 1.25.
+	Juju1 map[string]string
+
+	// Juju2 holds the markers the resource has under 2.x.
+	Juju2 map[string]string
+
+	// Unused is set for resources that still carry their markers but
+	// that nothing in the environment uses, such as the 1.25 security
+	// groups that are kept after an upgrade so it can be undone.
+	Unused bool
+}
+
+// TagChange describes a single change made to a provider resource
+// while upgrading or downgrading its tags.
+type TagChange struct {
+	// Kind is the kind of resource changed.
+	Kind string
+
+	// Id identifies the resource in the provider.
+	Id string
+
+	// Action describes the change, such as "set metadata" or
+	// "add security group juju-...".
+	Action string
+}
+
+// TagJournal records the changes made while upgrading or downgrading
+// tags, so that a partial failure can be diagnosed and the upgrade
+// safely run again.
+type TagJournal interface {
+	// Record records that the change was attempted, along with
+	// the error it failed with, if any. If the journal can't be
+	// written no further changes should be made.
+	Record(change TagChange, err error) error
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/juju/1.25-upgrade/juju1/environs"
 	"github.com/juju/1.25-upgrade/juju1/environs/config"
 	"github.com/juju/1.25-upgrade/juju1/environs/storage"
+	"github.com/juju/1.25-upgrade/juju1/environs/tags"
 	"github.com/juju/1.25-upgrade/juju1/instance"
 	"github.com/juju/1.25-upgrade/juju1/network"
 	"github.com/juju/1.25-upgrade/juju1/provider/common"
@@ -2018,13 +2019,19 @@ func extractInterfaces(inst instance.Instance, lshwXML []byte) (map[string]iface
 }
 
 // UpgradeTags is part of the TagUpgrader interface.
-func (environ *maasEnviron) UpgradeTags(string) error {
+func (environ *maasEnviron) UpgradeTags(string, tags.TagJournal) error {
 	// We don't track machines in environments by tag in MAAS 1.9.
 	return nil
 }
 
 // DowngradeTags is part of the TagUpgrader interface.
-func (environ *maasEnviron) DowngradeTags() error {
+func (environ *maasEnviron) DowngradeTags(tags.TagJournal) error {
 	// We don't track machines in environments by tag in MAAS 1.9.
 	return nil
 }
+
+// TagStatus is part of the TagUpgrader interface.
+func (environ *maasEnviron) TagStatus() ([]tags.TaggedResource, error) {
+	// We don't track machines in environments by tag in MAAS 1.9.
+	return nil, nil
+}
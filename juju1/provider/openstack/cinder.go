@@ -4,6 +4,7 @@
 package openstack
 
 import (
+	"fmt"
 	"math"
 	"net/url"
 	"sync"
@@ -14,6 +15,7 @@ import (
 	"gopkg.in/goose.v1/cinder"
 	"gopkg.in/goose.v1/identity"
 	"gopkg.in/goose.v1/nova"
+	cinder2 "gopkg.in/goose.v2/cinder"
 
 	"github.com/juju/1.25-upgrade/juju1/environs/config"
 	"github.com/juju/1.25-upgrade/juju1/environs/tags"
@@ -395,6 +397,7 @@ type openstackStorage interface {
 	AttachVolume(serverId, volumeId, mountPoint string) (*nova.VolumeAttachment, error)
 	DetachVolume(serverId, attachmentId string) error
 	ListVolumeAttachments(serverId string) ([]nova.VolumeAttachment, error)
+	SetVolumeMetadata(volumeId string, metadata map[string]string) (map[string]string, error)
 }
 
 type endpointResolver interface {
@@ -409,7 +412,7 @@ func getVolumeEndpointURL(client endpointResolver, region string) (*url.URL, err
 		logger.Debugf(`endpoint "volumev2" not found for %q region, trying "volume"`, region)
 		endpoint, ok = endpointMap["volume"]
 		if !ok {
-			return nil, errors.Errorf(`endpoint "volume" not found for %q region`, region)
+			return nil, errors.NewNotFound(nil, fmt.Sprintf(`endpoint "volume" not found for %q region`, region))
 		}
 	}
 	return url.Parse(endpoint)
@@ -433,12 +436,17 @@ func newOpenstackStorageAdapter(environConfig *config.Config) (openstackStorage,
 	return &openstackStorageAdapter{
 		cinderClient{cinder.Basic(endpointUrl, client.TenantId(), client.Token)},
 		novaClient{nova.New(client)},
+		cinder2.Basic(endpointUrl, client.TenantId(), client.Token),
 	}, nil
 }
 
 type openstackStorageAdapter struct {
 	cinderClient
 	novaClient
+
+	// metadataClient is only used for changing volume metadata,
+	// which the goose.v1 Cinder client can't do.
+	metadataClient *cinder2.Client
 }
 
 type cinderClient struct {
@@ -467,6 +475,11 @@ func (ga *openstackStorageAdapter) GetVolumesDetail() ([]cinder.Volume, error) {
 	return resp.Volumes, nil
 }
 
+// SetVolumeMetadata is part of the openstackStorage interface.
+func (ga *openstackStorageAdapter) SetVolumeMetadata(volumeId string, metadata map[string]string) (map[string]string, error) {
+	return ga.metadataClient.SetVolumeMetadata(volumeId, metadata)
+}
+
 // GetVolume is part of the openstackStorage interface.
 func (ga *openstackStorageAdapter) GetVolume(volumeId string) (*cinder.Volume, error) {
 	resp, err := ga.cinderClient.GetVolume(volumeId)
@@ -475,3 +488,28 @@ func (ga *openstackStorageAdapter) GetVolume(volumeId string) (*cinder.Volume, e
 	}
 	return &resp.Volume, nil
 }
+
+// changeVolumeTags sets the given metadata on each Cinder volume whose
+// metadata has key set to value. Values are set to "" rather than
+// removed, as they are for servers.
+func changeVolumeTags(storageAdapter openstackStorage, changer *tagChanger, key, value string, metadata map[string]string) error {
+	volumes, err := storageAdapter.GetVolumesDetail()
+	if err != nil {
+		return errors.Annotate(err, "listing volumes")
+	}
+	action := "set metadata " + formatMetadata(metadata)
+	for _, volume := range volumes {
+		if volume.Metadata[key] != value || metadataMatches(volume.Metadata, metadata) {
+			continue
+		}
+		id := volume.ID
+		_, err := changer.change(volumeResource, id, action, func() error {
+			_, err := storageAdapter.SetVolumeMetadata(id, metadata)
+			return err
+		})
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
@@ -236,6 +236,94 @@ func (s *cinderVolumeSourceSuite) TestListVolumes(c *gc.C) {
 	c.Check(volumeIds, jc.DeepEquals, []string{"volume-3"})
 }
 
+type recordingJournal struct {
+	changes []tags.TagChange
+	errors  []string
+}
+
+func (j *recordingJournal) Record(change tags.TagChange, err error) error {
+	j.changes = append(j.changes, change)
+	if err != nil {
+		j.errors = append(j.errors, err.Error())
+	} else {
+		j.errors = append(j.errors, "")
+	}
+	return nil
+}
+
+func (s *cinderVolumeSourceSuite) TestChangeVolumeTags(c *gc.C) {
+	envUUID := testing.EnvironmentTag.Id()
+	metadata := map[string]string{
+		"juju-model-uuid":      envUUID,
+		"juju-controller-uuid": "controller-uuid",
+		tags.JujuEnv:           "",
+	}
+	mockAdapter := &mockAdapter{
+		getVolumesDetail: func() ([]cinder.Volume, error) {
+			return []cinder.Volume{{
+				ID: "volume-1",
+			}, {
+				ID: "volume-2",
+				Metadata: map[string]string{
+					tags.JujuEnv: "something-else",
+				},
+			}, {
+				ID: "volume-3",
+				Metadata: map[string]string{
+					tags.JujuEnv: envUUID,
+				},
+			}}, nil
+		},
+	}
+	var journal recordingJournal
+	err := openstack.ChangeVolumeTags(mockAdapter, &journal, tags.JujuEnv, envUUID, metadata)
+	c.Assert(err, jc.ErrorIsNil)
+	mockAdapter.CheckCalls(c, []gitjujutesting.StubCall{
+		{"GetVolumesDetail", nil},
+		{"SetVolumeMetadata", []interface{}{"volume-3", metadata}},
+	})
+	c.Assert(journal.changes, jc.DeepEquals, []tags.TagChange{{
+		Kind:   "volume",
+		Id:     "volume-3",
+		Action: `set metadata juju-controller-uuid="controller-uuid" juju-env-uuid="" juju-model-uuid="` + envUUID + `"`,
+	}})
+	c.Assert(journal.errors, jc.DeepEquals, []string{""})
+}
+
+func (s *cinderVolumeSourceSuite) TestChangeVolumeTagsContinuesAfterError(c *gc.C) {
+	mockAdapter := &mockAdapter{
+		getVolumesDetail: func() ([]cinder.Volume, error) {
+			return []cinder.Volume{{
+				ID:       "volume-1",
+				Metadata: map[string]string{tags.JujuEnv: "env-uuid"},
+			}, {
+				ID:       "volume-2",
+				Metadata: map[string]string{tags.JujuEnv: "env-uuid"},
+			}, {
+				// Already done.
+				ID:       "volume-3",
+				Metadata: map[string]string{tags.JujuEnv: "env-uuid", "juju-model-uuid": "env-uuid"},
+			}}, nil
+		},
+		setVolumeMetadata: func(volumeId string, metadata map[string]string) (map[string]string, error) {
+			if volumeId == "volume-1" {
+				return nil, errors.New("nope")
+			}
+			return metadata, nil
+		},
+	}
+	var journal recordingJournal
+	metadata := map[string]string{"juju-model-uuid": "env-uuid"}
+	err := openstack.ChangeVolumeTags(mockAdapter, &journal, tags.JujuEnv, "env-uuid", metadata)
+	c.Assert(err, gc.ErrorMatches, `1 tag changes failed; run again to retry them`)
+	mockAdapter.CheckCalls(c, []gitjujutesting.StubCall{
+		{"GetVolumesDetail", nil},
+		{"SetVolumeMetadata", []interface{}{"volume-1", metadata}},
+		{"SetVolumeMetadata", []interface{}{"volume-2", metadata}},
+	})
+	c.Assert(journal.errors, jc.DeepEquals, []string{"nope", ""})
+}
+
 func (s *cinderVolumeSourceSuite) TestDescribeVolumes(c *gc.C) {
 	mockAdapter := &mockAdapter{
 		getVolumesDetail: func() ([]cinder.Volume, error) {
@@ -443,6 +531,7 @@ type mockAdapter struct {
 	volumeStatusNotifier  func(string, string, int, time.Duration) <-chan error
 	detachVolume          func(string, string) error
 	listVolumeAttachments func(string) ([]nova.VolumeAttachment, error)
+	setVolumeMetadata     func(string, map[string]string) (map[string]string, error)
 }
 
 func (ma *mockAdapter) GetVolume(volumeId string) (*cinder.Volume, error) {
@@ -504,6 +593,14 @@ func (ma *mockAdapter) ListVolumeAttachments(serverId string) ([]nova.VolumeAtta
 	return nil, nil
 }
 
+func (ma *mockAdapter) SetVolumeMetadata(volumeId string, metadata map[string]string) (map[string]string, error) {
+	ma.MethodCall(ma, "SetVolumeMetadata", volumeId, metadata)
+	if ma.setVolumeMetadata != nil {
+		return ma.setVolumeMetadata(volumeId, metadata)
+	}
+	return metadata, nil
+}
+
 type testEndpointResolver struct {
 	regionEndpoints map[string]identity.ServiceURLs
 }
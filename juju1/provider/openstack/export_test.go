@@ -21,6 +21,7 @@ import (
 	"github.com/juju/1.25-upgrade/juju1/environs/jujutest"
 	"github.com/juju/1.25-upgrade/juju1/environs/simplestreams"
 	envstorage "github.com/juju/1.25-upgrade/juju1/environs/storage"
+	"github.com/juju/1.25-upgrade/juju1/environs/tags"
 	"github.com/juju/1.25-upgrade/juju1/instance"
 	"github.com/juju/1.25-upgrade/juju1/network"
 	"github.com/juju/1.25-upgrade/juju1/storage"
@@ -93,6 +94,14 @@ func NewCinderVolumeSource(s OpenstackStorage) storage.VolumeSource {
 	return &cinderVolumeSource{openstackStorage(s), envName, envUUID}
 }
 
+func ChangeVolumeTags(s OpenstackStorage, journal tags.TagJournal, key, value string, metadata map[string]string) error {
+	changer := &tagChanger{journal: journal}
+	if err := changeVolumeTags(openstackStorage(s), changer, key, value, metadata); err != nil {
+		return err
+	}
+	return changer.err()
+}
+
 var indexData = `
 		{
 		 "index": {
@@ -40,7 +40,6 @@ import (
 	"github.com/juju/1.25-upgrade/juju1/provider/common"
 	"github.com/juju/1.25-upgrade/juju1/state"
 	"github.com/juju/1.25-upgrade/juju1/tools"
-	tags2 "github.com/juju/1.25-upgrade/juju2/environs/tags"
 )
 
 var logger = loggo.GetLogger("juju.provider.openstack")
@@ -1704,174 +1703,3 @@ func (e *environ) TagInstance(id instance.Id, tags map[string]string) error {
 	}
 	return nil
 }
-
-func (e *environ) changeTags(tags map[string]string) error {
-	instances, err := e.AllInstances()
-	if err != nil {
-		return errors.Trace(err)
-	}
-	for _, inst := range instances {
-		err = e.TagInstance(inst.Id(), tags)
-		if err != nil {
-			return errors.Trace(err)
-		}
-	}
-	return nil
-}
-
-// UpgradeTags is part of the TagUpgrader interface.
-func (e *environ) UpgradeTags(controllerUUID string) error {
-	modelUUID, ok := e.ecfg().UUID()
-	if !ok {
-		return errors.Errorf("no model uuid in environ config")
-	}
-	err := e.changeTags(map[string]string{
-		tags2.JujuModel: modelUUID,
-		tags.JujuEnv:    "",
-	})
-	if err != nil {
-		return errors.Trace(err)
-	}
-
-	return errors.Trace(e.upgradeGroups(controllerUUID, modelUUID))
-}
-
-func (e *environ) upgradeGroups(controllerUUID, modelUUID string) error {
-	client := e.nova()
-	groups, err := client.ListSecurityGroups()
-	if err != nil {
-		return errors.Trace(err)
-	}
-	newNames := make(map[string]string)
-	groupPrefix := e.jujuGroupName()
-	for _, group := range groups {
-		if !strings.HasPrefix(group.Name, groupPrefix) {
-			continue
-		}
-
-		rest := group.Name[len(groupPrefix):]
-		newName := fmt.Sprintf("juju-%s-%s%s", controllerUUID, modelUUID, rest)
-		newNames[group.Name] = newName
-		newRules := make([]nova.RuleInfo, len(group.Rules))
-		for i, rule := range group.Rules {
-			if rule.IPProtocol != nil {
-				newRules[i].IPProtocol = *rule.IPProtocol
-			}
-			if rule.FromPort != nil {
-				newRules[i].FromPort = *rule.FromPort
-			}
-			if rule.ToPort != nil {
-				newRules[i].ToPort = *rule.ToPort
-			}
-			newRules[i].Cidr = rule.IPRange["cidr"]
-		}
-		_, err := e.ensureGroup(newName, newRules)
-		if err != nil {
-			return errors.Trace(err)
-		}
-	}
-
-	// Add the new groups to the instances marked with the old ones.
-	err = e.forAllOpenstackInstances(func(osInst *openstackInstance) error {
-		details := osInst.getServerDetail()
-		for _, group := range details.Groups {
-			newName, ok := newNames[group.Name]
-			if !ok {
-				// Not a juju group.
-				continue
-			}
-			if err := client.AddServerSecurityGroup(details.Id, newName); err != nil {
-				return errors.Annotatef(err, "adding %q group to instance %q", newName, details.Id)
-			}
-			if err := client.RemoveServerSecurityGroup(details.Id, group.Name); err != nil {
-				return errors.Annotatef(err, "removing %q group from instance %q", group.Name, details.Id)
-			}
-		}
-		return nil
-	})
-	if err != nil {
-		return errors.Trace(err)
-	}
-
-	return nil
-}
-
-func (e *environ) forAllOpenstackInstances(f func(*openstackInstance) error) error {
-	instances, err := e.AllInstances()
-	if err != nil {
-		return errors.Trace(err)
-	}
-	for _, inst := range instances {
-		osInst := inst.(*openstackInstance)
-		if err := f(osInst); err != nil {
-			return errors.Trace(err)
-		}
-	}
-
-	return nil
-}
-
-// DowngradeTags is part of the TagUpgrader interface.
-func (e *environ) DowngradeTags() error {
-	modelUUID, ok := e.ecfg().UUID()
-	if !ok {
-		return errors.Errorf("no model uuid in environ config")
-	}
-	err := e.changeTags(map[string]string{
-		tags2.JujuModel:      "",
-		tags2.JujuController: "",
-		tags.JujuEnv:         modelUUID,
-	})
-	if err != nil {
-		return errors.Trace(err)
-	}
-
-	return errors.Trace(e.downgradeGroups(modelUUID))
-}
-
-const securityGroupPrefix = `^juju-[a-f0-9]{8}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{12}-`
-
-func (e *environ) newGroupNameToOld(newName string) string {
-	// juju-(uuid)-(uuid) = 5 + 36 + 1 + 36 = 78
-	const prefixLength = 78
-	return e.jujuGroupName() + newName[prefixLength:]
-}
-
-func (e *environ) downgradeGroups(modelUUID string) error {
-	client := e.nova()
-	groupPrefixRe, err := regexp.Compile(securityGroupPrefix + modelUUID)
-	if err != nil {
-		return errors.Trace(err)
-	}
-
-	err = e.forAllOpenstackInstances(func(osInst *openstackInstance) error {
-		details := osInst.getServerDetail()
-		for _, group := range details.Groups {
-			if !groupPrefixRe.MatchString(group.Name) {
-				continue
-			}
-			oldGroupName := e.newGroupNameToOld(group.Name)
-			if err := client.AddServerSecurityGroup(details.Id, oldGroupName); err != nil {
-				return errors.Annotatef(err, "adding %q group to instance %q", oldGroupName, details.Id)
-			}
-			if err := client.RemoveServerSecurityGroup(details.Id, group.Name); err != nil {
-				return errors.Annotatef(err, "removing %q group from instance %q", group.Name, details.Id)
-			}
-		}
-		return nil
-	})
-
-	groups, err := client.ListSecurityGroups()
-	if err != nil {
-		return errors.Trace(err)
-	}
-	for _, group := range groups {
-		if !groupPrefixRe.MatchString(group.Name) {
-			continue
-		}
-		if err := client.DeleteSecurityGroup(group.Id); err != nil {
-			return errors.Trace(err)
-		}
-	}
-	return nil
-}
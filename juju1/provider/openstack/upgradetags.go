@@ -0,0 +1,483 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package openstack
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+	"gopkg.in/goose.v1/nova"
+
+	"github.com/juju/1.25-upgrade/juju1/environs/tags"
+	"github.com/juju/1.25-upgrade/juju1/instance"
+	tags2 "github.com/juju/1.25-upgrade/juju2/environs/tags"
+)
+
+const (
+	serverResource        = "server"
+	volumeResource        = "volume"
+	securityGroupResource = "security group"
+
+	// securityGroupsMarker is reported alongside a server's tags to
+	// show the Juju security groups it's in.
+	securityGroupsMarker = "security-groups"
+
+	// groupNameMarker is reported for a security group, since
+	// groups are identified by name rather than tags.
+	groupNameMarker = "name"
+)
+
+const securityGroupPrefix = `^juju-[a-f0-9]{8}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{12}-`
+
+// tagChanger makes the changes needed to upgrade or downgrade tags,
+// recording each one in the journal. A change that fails doesn't stop
+// the rest, so as much as possible is done in one pass; everything is
+// checked before it's changed, so running again only retries the
+// changes that haven't been made.
+type tagChanger struct {
+	journal tags.TagJournal
+	failed  int
+}
+
+// change calls f to make the change and records the result, returning
+// whether it succeeded. It only returns an error if the journal can't
+// be written.
+func (c *tagChanger) change(kind, id, action string, f func() error) (bool, error) {
+	err := f()
+	if err != nil {
+		c.failed++
+		logger.Errorf("%s %s: %s: %v", kind, id, action, err)
+	}
+	if journalErr := c.journal.Record(tags.TagChange{Kind: kind, Id: id, Action: action}, err); journalErr != nil {
+		return false, errors.Annotate(journalErr, "writing tag journal")
+	}
+	return err == nil, nil
+}
+
+func (c *tagChanger) err() error {
+	if c.failed == 0 {
+		return nil
+	}
+	return errors.Errorf("%d tag changes failed; run again to retry them", c.failed)
+}
+
+// UpgradeTags is part of the TagUpgrader interface.
+func (e *environ) UpgradeTags(controllerUUID string, journal tags.TagJournal) error {
+	modelUUID, ok := e.ecfg().UUID()
+	if !ok {
+		return errors.Errorf("no model uuid in environ config")
+	}
+	changer := &tagChanger{journal: journal}
+	err := e.changeServerTags(changer, map[string]string{
+		tags2.JujuModel: modelUUID,
+		tags.JujuEnv:    "",
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	err = e.changeVolumeTags(changer, tags.JujuEnv, modelUUID, map[string]string{
+		tags2.JujuModel:      modelUUID,
+		tags2.JujuController: controllerUUID,
+		tags.JujuEnv:         "",
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := e.upgradeGroups(changer, controllerUUID, modelUUID); err != nil {
+		return errors.Trace(err)
+	}
+	return changer.err()
+}
+
+// DowngradeTags is part of the TagUpgrader interface.
+func (e *environ) DowngradeTags(journal tags.TagJournal) error {
+	modelUUID, ok := e.ecfg().UUID()
+	if !ok {
+		return errors.Errorf("no model uuid in environ config")
+	}
+	changer := &tagChanger{journal: journal}
+	err := e.changeServerTags(changer, map[string]string{
+		tags2.JujuModel:      "",
+		tags2.JujuController: "",
+		tags.JujuEnv:         modelUUID,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	err = e.changeVolumeTags(changer, tags2.JujuModel, modelUUID, map[string]string{
+		tags2.JujuModel:      "",
+		tags2.JujuController: "",
+		tags.JujuEnv:         modelUUID,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := e.downgradeGroups(changer, modelUUID); err != nil {
+		return errors.Trace(err)
+	}
+	return changer.err()
+}
+
+// TagStatus is part of the TagUpgrader interface.
+func (e *environ) TagStatus() ([]tags.TaggedResource, error) {
+	modelUUID, ok := e.ecfg().UUID()
+	if !ok {
+		return nil, errors.Errorf("no model uuid in environ config")
+	}
+	newGroupRe, err := newGroupRegexp(modelUUID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	oldGroupRe := e.oldGroupRegexp()
+
+	var resources []tags.TaggedResource
+	servers, err := e.aliveServers()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	usedGroups := make(map[string]bool)
+	for _, server := range servers {
+		resource := tags.TaggedResource{
+			Kind:  serverResource,
+			Id:    server.Id,
+			Name:  server.Name,
+			Juju1: pickMetadata(server.Metadata, tags.JujuEnv),
+			Juju2: pickMetadata(server.Metadata, tags2.JujuModel, tags2.JujuController),
+		}
+		var oldGroups, newGroups []string
+		for _, group := range server.Groups {
+			usedGroups[group.Name] = true
+			switch {
+			case oldGroupRe.MatchString(group.Name):
+				oldGroups = append(oldGroups, group.Name)
+			case newGroupRe.MatchString(group.Name):
+				newGroups = append(newGroups, group.Name)
+			}
+		}
+		addGroupsMarker(resource.Juju1, oldGroups)
+		addGroupsMarker(resource.Juju2, newGroups)
+		resources = append(resources, resource)
+	}
+
+	storageAdapter, err := e.storageAdapter()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if storageAdapter != nil {
+		volumes, err := storageAdapter.GetVolumesDetail()
+		if err != nil {
+			return nil, errors.Annotate(err, "listing volumes")
+		}
+		for _, volume := range volumes {
+			if volume.Metadata[tags.JujuEnv] != modelUUID && volume.Metadata[tags2.JujuModel] != modelUUID {
+				continue
+			}
+			resources = append(resources, tags.TaggedResource{
+				Kind:  volumeResource,
+				Id:    volume.ID,
+				Name:  volume.Name,
+				Juju1: pickMetadata(volume.Metadata, tags.JujuEnv),
+				Juju2: pickMetadata(volume.Metadata, tags2.JujuModel, tags2.JujuController),
+			})
+		}
+	}
+
+	groups, err := e.nova().ListSecurityGroups()
+	if err != nil {
+		return nil, errors.Annotate(err, "listing security groups")
+	}
+	for _, group := range groups {
+		// The 1.25 groups are kept after an upgrade so it can be
+		// undone, so they're reported as unused rather than as
+		// resources still to be upgraded.
+		resource := tags.TaggedResource{
+			Kind:   securityGroupResource,
+			Id:     group.Id,
+			Name:   group.Name,
+			Juju1:  make(map[string]string),
+			Juju2:  make(map[string]string),
+			Unused: !usedGroups[group.Name],
+		}
+		switch {
+		case oldGroupRe.MatchString(group.Name):
+			resource.Juju1[groupNameMarker] = group.Name
+		case newGroupRe.MatchString(group.Name):
+			resource.Juju2[groupNameMarker] = group.Name
+		default:
+			continue
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// pickMetadata returns the non-empty values of the keys given.
+func pickMetadata(metadata map[string]string, keys ...string) map[string]string {
+	result := make(map[string]string)
+	for _, key := range keys {
+		if value := metadata[key]; value != "" {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+func addGroupsMarker(markers map[string]string, groups []string) {
+	if len(groups) > 0 {
+		sort.Strings(groups)
+		markers[securityGroupsMarker] = strings.Join(groups, ",")
+	}
+}
+
+// aliveServers returns the details of the environment's servers.
+func (e *environ) aliveServers() ([]nova.ServerDetail, error) {
+	servers, err := e.nova().ListServersDetail(e.machinesFilter())
+	if err != nil {
+		return nil, errors.Annotate(err, "listing servers")
+	}
+	alive := make([]nova.ServerDetail, 0, len(servers))
+	for _, server := range servers {
+		if e.isAliveServer(server) {
+			alive = append(alive, server)
+		}
+	}
+	return alive, nil
+}
+
+// changeServerTags sets the metadata on each of the environment's
+// servers that doesn't already have it.
+func (e *environ) changeServerTags(changer *tagChanger, metadata map[string]string) error {
+	servers, err := e.aliveServers()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	action := "set metadata " + formatMetadata(metadata)
+	for _, server := range servers {
+		if metadataMatches(server.Metadata, metadata) {
+			continue
+		}
+		id := instance.Id(server.Id)
+		_, err := changer.change(serverResource, server.Id, action, func() error {
+			return e.TagInstance(id, metadata)
+		})
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// storageAdapter returns the adapter for the cloud's Cinder endpoint,
+// or nil if the cloud doesn't have one, since then there are no
+// volumes to worry about.
+func (e *environ) storageAdapter() (openstackStorage, error) {
+	storageAdapter, err := newOpenstackStorageAdapter(e.Config())
+	if errors.IsNotFound(errors.Cause(err)) {
+		logger.Debugf("no volumes: %v", err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return storageAdapter, nil
+}
+
+// changeVolumeTags sets the metadata on the environment's Cinder
+// volumes, picking them out by the key and value given.
+func (e *environ) changeVolumeTags(changer *tagChanger, key, value string, metadata map[string]string) error {
+	storageAdapter, err := e.storageAdapter()
+	if err != nil || storageAdapter == nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(changeVolumeTags(storageAdapter, changer, key, value, metadata))
+}
+
+func metadataMatches(current, wanted map[string]string) bool {
+	for key, value := range wanted {
+		if current[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func formatMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s=%q", key, metadata[key])
+	}
+	return strings.Join(parts, " ")
+}
+
+// oldGroupRegexp matches the names of the environment's 1.25
+// security groups.
+func (e *environ) oldGroupRegexp() *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf("^%s(-\\d+|-global)?$", regexp.QuoteMeta(e.jujuGroupName())))
+}
+
+// newGroupRegexp matches the names of the model's 2.x security groups.
+func newGroupRegexp(modelUUID string) (*regexp.Regexp, error) {
+	return regexp.Compile(securityGroupPrefix + regexp.QuoteMeta(modelUUID))
+}
+
+func (e *environ) newGroupNameToOld(newName string) string {
+	// juju-(uuid)-(uuid) = 5 + 36 + 1 + 36 = 78
+	const prefixLength = 78
+	return e.jujuGroupName() + newName[prefixLength:]
+}
+
+func serverInGroup(server nova.ServerDetail, name string) bool {
+	for _, group := range server.Groups {
+		if group.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *environ) upgradeGroups(changer *tagChanger, controllerUUID, modelUUID string) error {
+	client := e.nova()
+	groups, err := client.ListSecurityGroups()
+	if err != nil {
+		return errors.Annotate(err, "listing security groups")
+	}
+	existing := make(map[string]bool)
+	for _, group := range groups {
+		existing[group.Name] = true
+	}
+	newNames := make(map[string]string)
+	groupPrefix := e.jujuGroupName()
+	oldGroupRe := e.oldGroupRegexp()
+	for _, group := range groups {
+		if !oldGroupRe.MatchString(group.Name) {
+			continue
+		}
+
+		rest := group.Name[len(groupPrefix):]
+		newName := fmt.Sprintf("juju-%s-%s%s", controllerUUID, modelUUID, rest)
+		if existing[newName] {
+			// Copied on an earlier run.
+			newNames[group.Name] = newName
+			continue
+		}
+		newRules := make([]nova.RuleInfo, len(group.Rules))
+		for i, rule := range group.Rules {
+			if rule.IPProtocol != nil {
+				newRules[i].IPProtocol = *rule.IPProtocol
+			}
+			if rule.FromPort != nil {
+				newRules[i].FromPort = *rule.FromPort
+			}
+			if rule.ToPort != nil {
+				newRules[i].ToPort = *rule.ToPort
+			}
+			newRules[i].Cidr = rule.IPRange["cidr"]
+		}
+		created, err := changer.change(securityGroupResource, group.Id, "create copy "+newName, func() error {
+			_, err := e.ensureGroup(newName, newRules)
+			return err
+		})
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if created {
+			newNames[group.Name] = newName
+		}
+	}
+
+	// Move the instances from the old groups to the new ones.
+	servers, err := e.aliveServers()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, server := range servers {
+		for _, group := range server.Groups {
+			newName, ok := newNames[group.Name]
+			if !ok {
+				// Not a juju group.
+				continue
+			}
+			if _, err := e.moveServerGroup(changer, client, server, group.Name, newName); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	return nil
+}
+
+func (e *environ) downgradeGroups(changer *tagChanger, modelUUID string) error {
+	client := e.nova()
+	newGroupRe, err := newGroupRegexp(modelUUID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	servers, err := e.aliveServers()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	stillUsed := make(map[string]bool)
+	for _, server := range servers {
+		for _, group := range server.Groups {
+			if !newGroupRe.MatchString(group.Name) {
+				continue
+			}
+			oldName := e.newGroupNameToOld(group.Name)
+			moved, err := e.moveServerGroup(changer, client, server, group.Name, oldName)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if !moved {
+				// The group can't be deleted while it's in use.
+				stillUsed[group.Name] = true
+			}
+		}
+	}
+
+	groups, err := client.ListSecurityGroups()
+	if err != nil {
+		return errors.Annotate(err, "listing security groups")
+	}
+	for _, group := range groups {
+		if !newGroupRe.MatchString(group.Name) || stillUsed[group.Name] {
+			continue
+		}
+		groupId := group.Id
+		_, err := changer.change(securityGroupResource, groupId, "delete "+group.Name, func() error {
+			return client.DeleteSecurityGroup(groupId)
+		})
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// moveServerGroup moves the server from one security group to another,
+// skipping whichever steps have already been done. The server is only
+// taken out of the old group once it's in the new one. It returns
+// whether the move succeeded.
+func (e *environ) moveServerGroup(changer *tagChanger, client *nova.Client, server nova.ServerDetail, from, to string) (bool, error) {
+	serverId := server.Id
+	if !serverInGroup(server, to) {
+		added, err := changer.change(serverResource, serverId, "add security group "+to, func() error {
+			return client.AddServerSecurityGroup(serverId, to)
+		})
+		if err != nil || !added {
+			return false, errors.Trace(err)
+		}
+	}
+	removed, err := changer.change(serverResource, serverId, "remove security group "+from, func() error {
+		return client.RemoveServerSecurityGroup(serverId, from)
+	})
+	return removed, errors.Trace(err)
+}
@@ -0,0 +1,237 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package openstack_test
+
+import (
+	"fmt"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/goose.v1/nova"
+	"gopkg.in/goose.v1/testservices/hook"
+
+	"github.com/juju/1.25-upgrade/juju1/environs"
+	"github.com/juju/1.25-upgrade/juju1/environs/config"
+	"github.com/juju/1.25-upgrade/juju1/environs/tags"
+	"github.com/juju/1.25-upgrade/juju1/juju/testing"
+	"github.com/juju/1.25-upgrade/juju1/provider/openstack"
+	coretesting "github.com/juju/1.25-upgrade/juju1/testing"
+)
+
+const tagsControllerUUID = "deadbeef-0bad-400d-8000-4b1d0d06f00d"
+
+type tagUpgrader interface {
+	UpgradeTags(controllerUUID string, journal tags.TagJournal) error
+	DowngradeTags(journal tags.TagJournal) error
+	TagStatus() ([]tags.TaggedResource, error)
+}
+
+// tagsEnv holds an environment with one instance, and the names of
+// its security groups before and after upgrading.
+type tagsEnv struct {
+	env         environs.Environ
+	serverId    string
+	modelUUID   string
+	oldGroups   []string
+	newGroups   []string
+	oldGroupIds map[string]string
+}
+
+func (s *localServerSuite) startTagsEnv(c *gc.C) *tagsEnv {
+	cfg, err := config.New(config.NoDefaults, s.TestConfig.Merge(coretesting.Attrs{
+		"firewall-mode": config.FwInstance}))
+	c.Assert(err, jc.ErrorIsNil)
+	env, err := environs.New(cfg)
+	c.Assert(err, jc.ErrorIsNil)
+	inst, _ := testing.AssertStartInstance(c, env, "100")
+
+	name := env.Config().Name()
+	modelUUID := coretesting.EnvironmentTag.Id()
+	newPrefix := fmt.Sprintf("juju-%s-%s", tagsControllerUUID, modelUUID)
+	result := &tagsEnv{
+		env:       env,
+		serverId:  string(inst.Id()),
+		oldGroups: []string{"juju-" + name, "juju-" + name + "-100"},
+		newGroups: []string{newPrefix, newPrefix + "-100"},
+		modelUUID: modelUUID,
+	}
+	result.oldGroupIds = securityGroupIds(c, env)
+	return result
+}
+
+func securityGroupIds(c *gc.C, env environs.Environ) map[string]string {
+	groups, err := openstack.GetNovaClient(env).ListSecurityGroups()
+	c.Assert(err, jc.ErrorIsNil)
+	ids := make(map[string]string)
+	for _, group := range groups {
+		ids[group.Name] = group.Id
+	}
+	return ids
+}
+
+func getServer(c *gc.C, env environs.Environ, id string) *nova.ServerDetail {
+	server, err := openstack.GetNovaClient(env).GetServer(id)
+	c.Assert(err, jc.ErrorIsNil)
+	return server
+}
+
+// jujuGroups returns the names of the Juju security groups the server
+// is in.
+func jujuGroups(server *nova.ServerDetail) []string {
+	var names []string
+	for _, group := range server.Groups {
+		if strings.HasPrefix(group.Name, "juju-") {
+			names = append(names, group.Name)
+		}
+	}
+	return names
+}
+
+// journalEntries returns the changes in the journal as strings,
+// marking any that failed.
+func journalEntries(journal *recordingJournal) []string {
+	entries := make([]string, len(journal.changes))
+	for i, change := range journal.changes {
+		entries[i] = fmt.Sprintf("%s %s: %s", change.Kind, change.Id, change.Action)
+		if journal.errors[i] != "" {
+			entries[i] += " (failed)"
+		}
+	}
+	return entries
+}
+
+func (s *localServerSuite) upgradeTags(c *gc.C, t *tagsEnv) {
+	var journal recordingJournal
+	err := t.env.(tagUpgrader).UpgradeTags(tagsControllerUUID, &journal)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *localServerSuite) TestUpgradeTags(c *gc.C) {
+	t := s.startTagsEnv(c)
+
+	var journal recordingJournal
+	err := t.env.(tagUpgrader).UpgradeTags(tagsControllerUUID, &journal)
+	c.Assert(err, jc.ErrorIsNil)
+
+	server := getServer(c, t.env, t.serverId)
+	c.Check(server.Metadata["juju-model-uuid"], gc.Equals, t.modelUUID)
+	c.Check(server.Metadata["juju-env-uuid"], gc.Equals, "")
+	c.Check(jujuGroups(server), jc.SameContents, t.newGroups)
+	// The old groups are kept, so the upgrade can be undone.
+	assertSecurityGroups(c, t.env, append([]string{"default"}, append(t.oldGroups, t.newGroups...)...))
+
+	c.Check(journalEntries(&journal), jc.SameContents, []string{
+		fmt.Sprintf(`server %s: set metadata juju-env-uuid="" juju-model-uuid=%q`, t.serverId, t.modelUUID),
+		fmt.Sprintf("security group %s: create copy %s", t.oldGroupIds[t.oldGroups[0]], t.newGroups[0]),
+		fmt.Sprintf("security group %s: create copy %s", t.oldGroupIds[t.oldGroups[1]], t.newGroups[1]),
+		fmt.Sprintf("server %s: add security group %s", t.serverId, t.newGroups[0]),
+		fmt.Sprintf("server %s: remove security group %s", t.serverId, t.oldGroups[0]),
+		fmt.Sprintf("server %s: add security group %s", t.serverId, t.newGroups[1]),
+		fmt.Sprintf("server %s: remove security group %s", t.serverId, t.oldGroups[1]),
+	})
+}
+
+func (s *localServerSuite) TestUpgradeTagsAgainChangesNothing(c *gc.C) {
+	t := s.startTagsEnv(c)
+	s.upgradeTags(c, t)
+
+	var journal recordingJournal
+	err := t.env.(tagUpgrader).UpgradeTags(tagsControllerUUID, &journal)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(journal.changes, gc.HasLen, 0)
+
+	server := getServer(c, t.env, t.serverId)
+	c.Check(jujuGroups(server), jc.SameContents, t.newGroups)
+}
+
+// groupStatus returns whether each of the Juju security groups
+// reported by TagStatus is unused, keyed by name.
+func groupStatus(c *gc.C, env environs.Environ) map[string]bool {
+	resources, err := env.(tagUpgrader).TagStatus()
+	c.Assert(err, jc.ErrorIsNil)
+	unused := make(map[string]bool)
+	for _, resource := range resources {
+		if resource.Kind == "security group" {
+			unused[resource.Name] = resource.Unused
+		}
+	}
+	return unused
+}
+
+func (s *localServerSuite) TestTagStatusUnusedGroups(c *gc.C) {
+	t := s.startTagsEnv(c)
+	c.Check(groupStatus(c, t.env), jc.DeepEquals, map[string]bool{
+		t.oldGroups[0]: false,
+		t.oldGroups[1]: false,
+	})
+
+	// The old groups are kept after upgrading, but nothing uses them.
+	s.upgradeTags(c, t)
+	c.Check(groupStatus(c, t.env), jc.DeepEquals, map[string]bool{
+		t.oldGroups[0]: true,
+		t.oldGroups[1]: true,
+		t.newGroups[0]: false,
+		t.newGroups[1]: false,
+	})
+}
+
+func (s *localServerSuite) TestDowngradeTags(c *gc.C) {
+	t := s.startTagsEnv(c)
+	s.upgradeTags(c, t)
+	newGroupIds := securityGroupIds(c, t.env)
+
+	var journal recordingJournal
+	err := t.env.(tagUpgrader).DowngradeTags(&journal)
+	c.Assert(err, jc.ErrorIsNil)
+
+	server := getServer(c, t.env, t.serverId)
+	c.Check(server.Metadata["juju-env-uuid"], gc.Equals, t.modelUUID)
+	c.Check(server.Metadata["juju-model-uuid"], gc.Equals, "")
+	c.Check(server.Metadata["juju-controller-uuid"], gc.Equals, "")
+	c.Check(jujuGroups(server), jc.SameContents, t.oldGroups)
+	// The copies are deleted once nothing is using them.
+	assertSecurityGroups(c, t.env, append([]string{"default"}, t.oldGroups...))
+
+	c.Check(journalEntries(&journal), jc.SameContents, []string{
+		fmt.Sprintf(`server %s: set metadata juju-controller-uuid="" juju-env-uuid=%q juju-model-uuid=""`, t.serverId, t.modelUUID),
+		fmt.Sprintf("server %s: add security group %s", t.serverId, t.oldGroups[0]),
+		fmt.Sprintf("server %s: remove security group %s", t.serverId, t.newGroups[0]),
+		fmt.Sprintf("server %s: add security group %s", t.serverId, t.oldGroups[1]),
+		fmt.Sprintf("server %s: remove security group %s", t.serverId, t.newGroups[1]),
+		fmt.Sprintf("security group %s: delete %s", newGroupIds[t.newGroups[0]], t.newGroups[0]),
+		fmt.Sprintf("security group %s: delete %s", newGroupIds[t.newGroups[1]], t.newGroups[1]),
+	})
+}
+
+func (s *localServerSuite) TestDowngradeTagsRetriesFailedChanges(c *gc.C) {
+	t := s.startTagsEnv(c)
+	s.upgradeTags(c, t)
+	newGroupIds := securityGroupIds(c, t.env)
+
+	cleanup := s.srv.Nova.RegisterControlPoint(
+		"removeSecurityGroup",
+		func(sc hook.ServiceControl, args ...interface{}) error {
+			return fmt.Errorf("failed on purpose")
+		},
+	)
+	var journal recordingJournal
+	err := t.env.(tagUpgrader).DowngradeTags(&journal)
+	cleanup()
+	c.Assert(err, gc.ErrorMatches, "2 tag changes failed; run again to retry them")
+	deletes := []string{
+		fmt.Sprintf("security group %s: delete %s", newGroupIds[t.newGroups[0]], t.newGroups[0]),
+		fmt.Sprintf("security group %s: delete %s", newGroupIds[t.newGroups[1]], t.newGroups[1]),
+	}
+	entries := journalEntries(&journal)
+	c.Assert(entries, gc.HasLen, 7)
+	c.Check(entries[5:], jc.SameContents, []string{deletes[0] + " (failed)", deletes[1] + " (failed)"})
+
+	// Running again only makes the changes that failed.
+	journal = recordingJournal{}
+	err = t.env.(tagUpgrader).DowngradeTags(&journal)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(journalEntries(&journal), jc.SameContents, deletes)
+	assertSecurityGroups(c, t.env, append([]string{"default"}, t.oldGroups...))
+}
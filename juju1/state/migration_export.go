@@ -67,17 +67,105 @@ var (
 	}
 )
 
+// ExportOverrides holds the details of the exported model that should
+// differ from the 1.25 environment, so the model can be renamed or
+// given a new owner as it's imported into the target controller.
+type ExportOverrides struct {
+	// Cloud is the name of the cloud in the target controller.
+	Cloud string
+
+	// CloudRegion is the region of the cloud in the target
+	// controller. It's only used if Cloud is set.
+	CloudRegion string
+
+	// ModelName is the name to give the model.
+	ModelName string
+
+	// Owner is the user who should own the model. They're made an
+	// admin user of the model, along with the environment's users.
+	Owner names2.UserTag
+
+	// CredentialName is the name of the model's cloud credential.
+	// If it's empty the credential is named after the owner and
+	// the environment.
+	CredentialName string
+
+	// ExistingCredential is the name of a credential belonging to
+	// the owner in the target controller. If it's set the model
+	// uses that credential, and the secrets from the environment
+	// config aren't exported at all.
+	ExistingCredential string
+
+	// StoragePools maps 1.25 storage pool names, or provider types,
+	// onto the 2.x provider types and attributes to export them
+	// with. Pools in use that Juju 2.x can't support as they are
+	// must be mapped, or the export fails.
+	StoragePools map[string]StoragePoolMapping
+
+	// LocalStorageProviderTypes, if set, is called once the model
+	// config has been exported to find the storage provider types
+	// that the Juju 2.x provider built into this tool supports for
+	// the model. Each pool mapping's provider type must be one of
+	// them. The target controller isn't asked; it checks the pools
+	// itself when the model is imported.
+	LocalStorageProviderTypes func(model description.Model) ([]string, error)
+
+	// ProviderNetworks, if set, is called once the model config has
+	// been exported to find the provider's details for the
+	// environment's spaces and subnets, which 1.25 doesn't record.
+	ProviderNetworks func(model description.Model) (ProviderNetworks, error)
+}
+
+// ProviderNetworks holds the provider's details for the spaces and
+// subnets in the environment.
+type ProviderNetworks struct {
+	// SpaceProviderIds maps 1.25 space names to the provider IDs of
+	// the matching provider spaces.
+	SpaceProviderIds map[string]string
+
+	// Subnets maps subnet CIDRs to the provider's details for them.
+	Subnets map[string]ProviderSubnet
+}
+
+// ProviderSubnet holds the provider's details for a subnet.
+type ProviderSubnet struct {
+	ProviderId        string
+	ProviderNetworkId string
+
+	// SpaceName is the 1.25 space that the provider has the subnet
+	// in, if any. It's only used for subnets that aren't in a space
+	// in 1.25.
+	SpaceName string
+}
+
+// StoragePoolMapping describes how to export a 1.25 storage pool, or
+// the pools of a 1.25 storage provider type.
+type StoragePoolMapping struct {
+	// Provider is the 2.x storage provider type of the pool. If it's
+	// empty the 1.25 provider type is kept.
+	Provider string
+
+	// RenameAttributes maps 1.25 pool attribute names to the names
+	// the 2.x provider expects.
+	RenameAttributes map[string]string
+
+	// Attributes are set on the pool once the 1.25 attributes have
+	// been renamed, replacing any existing values.
+	Attributes map[string]interface{}
+}
+
 // Export the current model for the State.
-func (st *State) Export(overrideCloud string) (description.Model, error) {
+func (st *State) Export(overrides ExportOverrides) (description.Model, error) {
 	dbModel, err := st.Environment()
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
 	export := exporter{
-		st:      st,
-		dbModel: dbModel,
-		logger:  loggo.GetLogger("juju.state.export-model"),
+		st:           st,
+		dbModel:      dbModel,
+		logger:       loggo.GetLogger("juju.state.export-model"),
+		poolMappings: overrides.StoragePools,
 	}
 	if err := export.readAllStatuses(); err != nil {
 		return nil, errors.Annotate(err, "reading statuses")
@@ -97,6 +185,9 @@ func (st *State) Export(overrideCloud string) (description.Model, error) {
 	if err := export.readAllConstraints(); err != nil {
 		return nil, errors.Trace(err)
 	}
+	if err := export.readNetworkConversions(); err != nil {
+		return nil, errors.Trace(err)
+	}
 
 	blocks, err := export.readBlocks()
 	if err != nil {
@@ -114,6 +205,20 @@ func (st *State) Export(overrideCloud string) (description.Model, error) {
 	if err != nil {
 		return nil, errors.Annotate(err, "splitting environ config")
 	}
+	if overrides.ModelName != "" {
+		modelConfig["name"] = overrides.ModelName
+	}
+	if overrides.Owner != (names2.UserTag{}) {
+		creds.Owner = overrides.Owner
+		creds.Name = fmt.Sprintf("%s-%s", creds.Owner.Name(), creds.Cloud.Id())
+	}
+	if overrides.CredentialName != "" {
+		creds.Name = overrides.CredentialName
+	}
+	if overrides.ExistingCredential != "" {
+		creds.Name = overrides.ExistingCredential
+		creds.Attributes = nil
+	}
 
 	args := description.ModelArgs{
 		Cloud:       creds.Cloud.Id(),
@@ -122,13 +227,25 @@ func (st *State) Export(overrideCloud string) (description.Model, error) {
 		Config:      modelConfig,
 		Blocks:      blocks,
 	}
-	if overrideCloud != "" {
-		args.Cloud = overrideCloud
-		creds.Cloud = names2.NewCloudTag(overrideCloud)
+	if overrides.Cloud != "" {
+		args.Cloud = overrides.Cloud
+		args.CloudRegion = overrides.CloudRegion
+		creds.Cloud = names2.NewCloudTag(overrides.Cloud)
 	}
 	export.model = description.NewModel(args)
 	export.model.SetCloudCredential(creds)
 
+	// Check the pool mappings before doing the rest of the work.
+	if overrides.LocalStorageProviderTypes != nil {
+		providerTypes, err := overrides.LocalStorageProviderTypes(export.model)
+		if err != nil {
+			return nil, errors.Annotate(err, "getting Juju 2.x storage provider types")
+		}
+		if err := checkPoolMappingProviders(export.poolMappings, providerTypes); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
 	modelKey := dbModel.globalKey()
 	export.model.SetAnnotations(export.getAnnotations(modelKey))
 	if err := export.sequences(); err != nil {
@@ -155,6 +272,12 @@ func (st *State) Export(overrideCloud string) (description.Model, error) {
 	if err := export.relations(); err != nil {
 		return nil, errors.Trace(err)
 	}
+	if overrides.ProviderNetworks != nil {
+		export.networks, err = overrides.ProviderNetworks(export.model)
+		if err != nil {
+			return nil, errors.Annotate(err, "getting provider networks")
+		}
+	}
 	if err := export.spaces(); err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -168,7 +291,8 @@ func (st *State) Export(overrideCloud string) (description.Model, error) {
 	}
 	// No link layer devices in 1.25.
 
-	// No SSH host keys in 1.25
+	// No SSH host keys in 1.25; import collects them from the
+	// machines.
 
 	if err := export.storage(); err != nil {
 		return nil, errors.Trace(err)
@@ -190,6 +314,13 @@ type exporter struct {
 	model   description.Model
 	logger  loggo.Logger
 
+	poolMappings map[string]StoragePoolMapping
+	networks     ProviderNetworks
+
+	// networkConversions holds the spaces to use in place of the
+	// networks requested for services and machines, by global key.
+	networkConversions map[string]NetworkConversion
+
 	annotations             map[string]annotatorDoc
 	constraints             map[string]bson.M
 	modelSettings           map[string]bson.M
@@ -251,7 +382,8 @@ func (e *exporter) splitEnvironConfig() (map[string]interface{}, description.Clo
 		delete(modelConfig, "maas-oauth")
 		delete(modelConfig, "maas-server")
 		delete(modelConfig, "maas-agent-name")
-		// any region?
+		// There's no region in the config; import finds it by
+		// matching the maas-server against the target's clouds.
 	case "openstack":
 		creds.AuthType = modelConfig["auth-mode"].(string)
 		switch creds.AuthType {
@@ -388,6 +520,22 @@ func (e *exporter) modelUsers() error {
 		}
 		e.model.AddUser(arg)
 	}
+
+	// The owner may have been overridden with a user who doesn't
+	// have access to the environment. Import removes the owner's
+	// default access, so they need to be added explicitly.
+	owner := e.model.Owner()
+	for _, user := range e.model.Users() {
+		if user.Name() == owner {
+			return nil
+		}
+	}
+	e.model.AddUser(description.UserArgs{
+		Name:        owner,
+		CreatedBy:   owner,
+		DateCreated: time.Now(),
+		Access:      "admin",
+	})
 	return nil
 }
 
@@ -491,6 +639,12 @@ func lxcIdToLXDMachineTag(tag string) names2.MachineTag {
 	return names2.NewMachineTag(strings.Join(parts, "/"))
 }
 
+// LXDMachineId returns the id the 1.25 machine has once exported,
+// with lxc containers renamed to lxd.
+func LXDMachineId(id string) string {
+	return lxcIdToLXDMachineTag(id).Id()
+}
+
 func (e *exporter) newMachine(exParent description.Machine, machine *Machine, instances map[string]instanceData, portsData []portsDoc, blockDevices map[string][]BlockDeviceInfo) (description.Machine, error) {
 	args := description.MachineArgs{
 		Id:            lxcIdToLXDMachineTag(machine.MachineTag().Id()),
@@ -854,6 +1008,7 @@ func (e *exporter) addApplication(ctx addApplicationContext) error {
 	for _, b := range extras {
 		bindings[b] = ""
 	}
+	e.addNetworkBinding(globalKey, bindings)
 
 	args := description.ApplicationArgs{
 		Tag:         names2.NewApplicationTag(appName),
@@ -1148,10 +1303,12 @@ func (e *exporter) spaces() error {
 	e.logger.Debugf("read %d spaces", len(spaces))
 
 	for _, space := range spaces {
+		// No provider ID in 1.25; it comes from the provider, if
+		// the space could be matched.
 		e.model.AddSpace(description.SpaceArgs{
-			Name:   space.Name(),
-			Public: space.doc.IsPublic,
-			// No provider ID in 1.25
+			Name:       space.Name(),
+			Public:     space.doc.IsPublic,
+			ProviderID: e.networks.SpaceProviderIds[space.Name()],
 		})
 	}
 	return nil
@@ -1165,13 +1322,25 @@ func (e *exporter) subnets() error {
 	e.logger.Debugf("read %d subnets", len(subnets))
 
 	for _, subnet := range subnets {
-		e.model.AddSubnet(description.SubnetArgs{
+		args := description.SubnetArgs{
 			CIDR:              subnet.CIDR(),
 			ProviderId:        string(subnet.ProviderId()),
 			VLANTag:           subnet.VLANTag(),
 			AvailabilityZones: []string{subnet.AvailabilityZone()},
 			SpaceName:         subnet.SpaceName(),
-		})
+		}
+		if providerSubnet, found := e.networks.Subnets[subnet.CIDR()]; found {
+			if args.ProviderId != "" && args.ProviderId != providerSubnet.ProviderId {
+				e.logger.Warningf("subnet %s has provider ID %q, was %q in 1.25",
+					args.CIDR, providerSubnet.ProviderId, args.ProviderId)
+			}
+			args.ProviderId = providerSubnet.ProviderId
+			args.ProviderNetworkId = providerSubnet.ProviderNetworkId
+			if args.SpaceName == "" {
+				args.SpaceName = providerSubnet.SpaceName
+			}
+		}
+		e.model.AddSubnet(args)
 	}
 	return nil
 }
@@ -1515,7 +1684,7 @@ func (e *exporter) constraintsArgs(globalKey string) (description.ConstraintsArg
 	if !found {
 		// No constraints for this key.
 		e.logger.Debugf("no constraints found for key %q", globalKey)
-		return description.ConstraintsArgs{}, nil
+		return e.addNetworkSpaces(globalKey, description.ConstraintsArgs{}), nil
 	}
 	// We capture any type error using a closure to avoid having to return
 	// multiple values from the optional functions. This does mean that we will
@@ -1578,7 +1747,57 @@ func (e *exporter) constraintsArgs(globalKey string) (description.ConstraintsArg
 	if optionalErr != nil {
 		return description.ConstraintsArgs{}, errors.Trace(optionalErr)
 	}
-	return result, nil
+	return e.addNetworkSpaces(globalKey, result), nil
+}
+
+func (e *exporter) readNetworkConversions() error {
+	conversions, err := e.st.NetworkConversions()
+	if err != nil {
+		return errors.Annotate(err, "converting networks to spaces")
+	}
+	e.networkConversions = make(map[string]NetworkConversion)
+	for _, conversion := range conversions {
+		e.networkConversions[conversion.GlobalKey] = conversion
+		e.logger.Infof("%s: requested networks %v and networks constraint %v converted to spaces %v",
+			conversion.Entity(), conversion.Requested, conversion.Constraint, conversion.Spaces)
+		if len(conversion.Unmapped) > 0 {
+			e.logger.Warningf("%s: networks %v aren't in any space, dropping them",
+				conversion.Entity(), conversion.Unmapped)
+		}
+		if len(conversion.Conflicting) > 0 {
+			e.logger.Warningf("%s: spaces %v are both included and excluded, dropping the exclusions",
+				conversion.Entity(), conversion.Conflicting)
+		}
+	}
+	return nil
+}
+
+// addNetworkBinding binds all of the endpoints of a service deployed
+// with --networks in one space to that space.
+func (e *exporter) addNetworkBinding(globalKey string, bindings map[string]string) {
+	if space := e.networkConversions[globalKey].Binding; space != "" {
+		for name := range bindings {
+			bindings[name] = space
+		}
+	}
+}
+
+// addNetworkSpaces adds the spaces converted from the networks
+// requested for the entity to its spaces constraint. The 1.25
+// networks constraint isn't supported by 2.x, so it's dropped.
+func (e *exporter) addNetworkSpaces(globalKey string, args description.ConstraintsArgs) description.ConstraintsArgs {
+	conversion, found := e.networkConversions[globalKey]
+	if !found {
+		return args
+	}
+	spaces := set.NewStrings(args.Spaces...)
+	for _, space := range conversion.Spaces {
+		if !spaces.Contains(space) {
+			spaces.Add(space)
+			args.Spaces = append(args.Spaces, space)
+		}
+	}
+	return args
 }
 
 func (e *exporter) logExtras() {
@@ -1883,20 +2102,141 @@ func (e *exporter) storagePools() error {
 	if err != nil {
 		return errors.Annotate(err, "listing pools")
 	}
+	used := e.usedStoragePools()
+	// Anything used as a pool that isn't one names a provider type.
+	providerTypes := set.NewStrings(used.Values()...)
+	mapped := set.NewStrings()
+	var problems []string
 	for _, cfg := range poolConfigs {
-		if !isCommonStorageType(cfg.Provider()) && !e.storageTypeMatchesEnvProvider(cfg.Provider()) {
-			// This just represents default settings for a storage pool that shouldn't be exported.
-			continue
+		name, providerType := cfg.Name(), string(cfg.Provider())
+		mapping, found := e.poolMappings[name]
+		if found {
+			mapped.Add(name)
+		} else if mapping, found = e.poolMappings[providerType]; found {
+			mapped.Add(providerType)
+		}
+		providerTypes.Remove(name)
+		switch {
+		case found:
+			e.model.AddStoragePool(mapping.apply(name, providerType, cfg.Attrs()))
+		case e.storageTypeSupported(cfg.Provider()):
+			e.model.AddStoragePool(description.StoragePoolArgs{
+				Name:       name,
+				Provider:   providerType,
+				Attributes: cfg.Attrs(),
+			})
+		case used.Contains(name):
+			problems = append(problems, fmt.Sprintf(
+				"storage pool %q has provider type %q, which isn't supported", name, providerType))
+		default:
+			// This is most likely just the default settings for a
+			// storage pool, but say so rather than drop it silently.
+			e.logger.Warningf("not exporting unused storage pool %q with unsupported provider type %q", name, providerType)
+		}
+	}
+
+	for _, providerType := range providerTypes.SortedValues() {
+		mapping, found := e.poolMappings[providerType]
+		if found {
+			mapped.Add(providerType)
+		}
+		switch {
+		case found && mapping.Provider != "":
+			// The mapped name becomes a pool in its own right.
+			e.model.AddStoragePool(mapping.apply(providerType, providerType, nil))
+		case !e.storageTypeSupported(storage.ProviderType(providerType)):
+			problems = append(problems, fmt.Sprintf(
+				"storage provider type %q is used as a pool, but isn't supported", providerType))
+		}
+	}
+
+	for _, name := range set.NewStrings(poolMappingNames(e.poolMappings)...).Difference(mapped).SortedValues() {
+		problems = append(problems, fmt.Sprintf(
+			"storage pool mapping %q doesn't match a pool or provider type in use", name))
+	}
+	if len(problems) > 0 {
+		return errors.Errorf("can't export storage pools:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// usedStoragePools returns the pool names used by storage constraints,
+// volumes and filesystems. A pool name may just be a provider type.
+func (e *exporter) usedStoragePools() set.Strings {
+	used := set.NewStrings()
+	for _, doc := range e.modelStorageConstraints {
+		for _, cons := range doc.Constraints {
+			used.Add(cons.Pool)
 		}
-		e.model.AddStoragePool(description.StoragePoolArgs{
-			Name:       cfg.Name(),
-			Provider:   string(cfg.Provider()),
-			Attributes: cfg.Attrs(),
-		})
+	}
+	for _, volume := range e.model.Volumes() {
+		used.Add(volume.Pool())
+	}
+	for _, filesystem := range e.model.Filesystems() {
+		used.Add(filesystem.Pool())
+	}
+	used.Remove("")
+	return used
+}
+
+func (e *exporter) storageTypeSupported(t storage.ProviderType) bool {
+	return isCommonStorageType(t) || e.storageTypeMatchesEnvProvider(t)
+}
+
+// apply returns the pool as it should be exported under the mapping.
+func (m StoragePoolMapping) apply(name, providerType string, attrs map[string]interface{}) description.StoragePoolArgs {
+	if m.Provider != "" {
+		providerType = m.Provider
+	}
+	result := make(map[string]interface{})
+	for key, value := range attrs {
+		if newKey, found := m.RenameAttributes[key]; found {
+			key = newKey
+		}
+		result[key] = value
+	}
+	for key, value := range m.Attributes {
+		result[key] = value
+	}
+	return description.StoragePoolArgs{
+		Name:       name,
+		Provider:   providerType,
+		Attributes: result,
+	}
+}
+
+// checkPoolMappingProviders returns an error if any of the mappings
+// have a provider type that isn't one of providerTypes, the types the
+// local Juju 2.x provider supports. If providerTypes is nil they
+// aren't known, and nothing is checked.
+func checkPoolMappingProviders(mappings map[string]StoragePoolMapping, providerTypes []string) error {
+	if providerTypes == nil {
+		return nil
+	}
+	supported := set.NewStrings(providerTypes...)
+	var problems []string
+	for _, name := range set.NewStrings(poolMappingNames(mappings)...).SortedValues() {
+		provider := mappings[name].Provider
+		if provider != "" && !supported.Contains(provider) {
+			problems = append(problems, fmt.Sprintf(
+				"storage pool mapping %q has provider type %q, which the Juju 2.x provider doesn't support", name, provider))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.Errorf("can't export storage pools (supported provider types: %s):\n  %s",
+			strings.Join(supported.SortedValues(), ", "), strings.Join(problems, "\n  "))
 	}
 	return nil
 }
 
+func poolMappingNames(m map[string]StoragePoolMapping) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
 func (e *exporter) storageTypeMatchesEnvProvider(t storage.ProviderType) bool {
 	envProvider := e.model.Config()["type"].(string)
 	return storageProviderTypeMap[envProvider] == t
@@ -0,0 +1,194 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package state
+
+import (
+	"github.com/juju/description"
+	"github.com/juju/loggo"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	names2 "gopkg.in/juju/names.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/juju/1.25-upgrade/juju1/storage/provider/dummy"
+	"github.com/juju/1.25-upgrade/juju1/storage/provider/registry"
+)
+
+type exportStoragePoolsSuite struct{}
+
+var _ = gc.Suite(&exportStoragePoolsSuite{})
+
+func (*exportStoragePoolsSuite) SetUpTest(c *gc.C) {
+	// A provider type that 1.25 knows about but 2.x doesn't.
+	registry.RegisterProvider("oldtype", &dummy.StorageProvider{})
+}
+
+func (*exportStoragePoolsSuite) TearDownTest(c *gc.C) {
+	registry.RegisterProvider("oldtype", nil)
+}
+
+// newPoolExporter returns an exporter for an ec2 environment with
+// the given pools, using "oldtype" for the data storage constraint.
+func newPoolExporter(pools map[string]string, mappings map[string]StoragePoolMapping) *exporter {
+	e := &exporter{
+		model: description.NewModel(description.ModelArgs{
+			Owner:  names2.NewUserTag("admin"),
+			Config: map[string]interface{}{"type": "ec2"},
+		}),
+		logger:        loggo.GetLogger("juju.state.export-model"),
+		poolMappings:  mappings,
+		modelSettings: make(map[string]bson.M),
+		modelStorageConstraints: map[string]storageConstraintsDoc{
+			"s#mysql": {Constraints: map[string]StorageConstraints{
+				"data": {Pool: "oldtype"},
+			}},
+		},
+	}
+	for name, providerType := range pools {
+		e.modelSettings["pool#"+name] = bson.M{
+			"name":  name,
+			"type":  providerType,
+			"value": 42,
+		}
+	}
+	return e
+}
+
+func (*exportStoragePoolsSuite) TestUsedStoragePools(c *gc.C) {
+	e := newPoolExporter(nil, nil)
+	e.modelStorageConstraints["s#wordpress"] = storageConstraintsDoc{
+		Constraints: map[string]StorageConstraints{
+			"logs":  {Pool: "loop-pool"},
+			"cache": {},
+		},
+	}
+	e.model.AddVolume(description.VolumeArgs{Tag: names2.NewVolumeTag("0"), Pool: "ebs-ssd"})
+	e.model.AddFilesystem(description.FilesystemArgs{Tag: names2.NewFilesystemTag("0/1"), Pool: "rootfs"})
+
+	c.Assert(e.usedStoragePools().SortedValues(), jc.DeepEquals, []string{
+		"ebs-ssd", "loop-pool", "oldtype", "rootfs",
+	})
+}
+
+func (*exportStoragePoolsSuite) TestMappingApply(c *gc.C) {
+	for i, test := range []struct {
+		about    string
+		mapping  StoragePoolMapping
+		attrs    map[string]interface{}
+		expected description.StoragePoolArgs
+	}{{
+		about:   "provider type is kept if not mapped",
+		mapping: StoragePoolMapping{Attributes: map[string]interface{}{"size": 10}},
+		expected: description.StoragePoolArgs{
+			Name:       "pool",
+			Provider:   "oldtype",
+			Attributes: map[string]interface{}{"size": 10},
+		},
+	}, {
+		about: "attributes are renamed, then replaced",
+		mapping: StoragePoolMapping{
+			Provider:         "cinder",
+			RenameAttributes: map[string]string{"old-type": "volume-type", "old-size": "size"},
+			Attributes:       map[string]interface{}{"size": 20},
+		},
+		attrs: map[string]interface{}{"old-type": "ssd", "old-size": 10, "other": true},
+		expected: description.StoragePoolArgs{
+			Name:     "pool",
+			Provider: "cinder",
+			Attributes: map[string]interface{}{
+				"volume-type": "ssd",
+				"size":        20,
+				"other":       true,
+			},
+		},
+	}} {
+		c.Logf("test %d: %s", i, test.about)
+		c.Check(test.mapping.apply("pool", "oldtype", test.attrs), jc.DeepEquals, test.expected)
+	}
+}
+
+func (*exportStoragePoolsSuite) TestStoragePoolsMapped(c *gc.C) {
+	e := newPoolExporter(map[string]string{"oldtype": "oldtype"}, map[string]StoragePoolMapping{
+		"oldtype": {Provider: "loop", RenameAttributes: map[string]string{"value": "size"}},
+	})
+	c.Assert(e.storagePools(), jc.ErrorIsNil)
+
+	pools := e.model.StoragePools()
+	c.Assert(pools, gc.HasLen, 1)
+	c.Check(pools[0].Name(), gc.Equals, "oldtype")
+	c.Check(pools[0].Provider(), gc.Equals, "loop")
+	c.Check(pools[0].Attributes(), jc.DeepEquals, map[string]interface{}{"size": 42})
+}
+
+func (*exportStoragePoolsSuite) TestStoragePoolsProviderTypeMapped(c *gc.C) {
+	// The constraint names the provider type rather than a pool.
+	e := newPoolExporter(nil, map[string]StoragePoolMapping{
+		"oldtype": {Provider: "ebs", Attributes: map[string]interface{}{"volume-type": "ssd"}},
+	})
+	c.Assert(e.storagePools(), jc.ErrorIsNil)
+
+	pools := e.model.StoragePools()
+	c.Assert(pools, gc.HasLen, 1)
+	c.Check(pools[0].Name(), gc.Equals, "oldtype")
+	c.Check(pools[0].Provider(), gc.Equals, "ebs")
+	c.Check(pools[0].Attributes(), jc.DeepEquals, map[string]interface{}{"volume-type": "ssd"})
+}
+
+func (*exportStoragePoolsSuite) TestStoragePoolsSupported(c *gc.C) {
+	e := newPoolExporter(map[string]string{"fast": "loop", "unused": "oldtype"}, nil)
+	delete(e.modelStorageConstraints, "s#mysql")
+	c.Assert(e.storagePools(), jc.ErrorIsNil)
+
+	pools := e.model.StoragePools()
+	c.Assert(pools, gc.HasLen, 1)
+	c.Check(pools[0].Name(), gc.Equals, "fast")
+	c.Check(pools[0].Provider(), gc.Equals, "loop")
+}
+
+func (*exportStoragePoolsSuite) TestStoragePoolsUnsupported(c *gc.C) {
+	e := newPoolExporter(map[string]string{"old-pool": "oldtype"}, map[string]StoragePoolMapping{
+		"unused": {Provider: "loop"},
+	})
+	e.modelStorageConstraints["s#wordpress"] = storageConstraintsDoc{
+		Constraints: map[string]StorageConstraints{"logs": {Pool: "old-pool"}},
+	}
+	err := e.storagePools()
+	c.Assert(err, gc.ErrorMatches, `can't export storage pools:
+  storage pool "old-pool" has provider type "oldtype", which isn't supported
+  storage provider type "oldtype" is used as a pool, but isn't supported
+  storage pool mapping "unused" doesn't match a pool or provider type in use`)
+}
+
+func (*exportStoragePoolsSuite) TestCheckPoolMappingProviders(c *gc.C) {
+	mappings := map[string]StoragePoolMapping{
+		"fast":    {Provider: "cinder"},
+		"oldtype": {Provider: "loop"},
+		"renamed": {RenameAttributes: map[string]string{"a": "b"}},
+	}
+	err := checkPoolMappingProviders(mappings, []string{"ebs", "loop"})
+	c.Assert(err, gc.ErrorMatches, `can't export storage pools \(supported provider types: ebs, loop\):
+  storage pool mapping "fast" has provider type "cinder", which the Juju 2.x provider doesn't support`)
+
+	err = checkPoolMappingProviders(mappings, []string{"cinder", "loop"})
+	c.Assert(err, jc.ErrorIsNil)
+
+	// The supported types aren't always known.
+	err = checkPoolMappingProviders(mappings, nil)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+type machineIdSuite struct{}
+
+var _ = gc.Suite(&machineIdSuite{})
+
+func (*machineIdSuite) TestLXDMachineId(c *gc.C) {
+	for id, expected := range map[string]string{
+		"0":             "0",
+		"1/lxc/0":       "1/lxd/0",
+		"1/kvm/2":       "1/kvm/2",
+		"1/lxc/0/lxc/1": "1/lxc/0/lxc/1",
+	} {
+		c.Check(LXDMachineId(id), gc.Equals, expected, gc.Commentf("id %q", id))
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package state
+
+import (
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/utils/set"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// NetworkConversion describes how the networks requested for a
+// service or machine in 1.25, with --networks or the networks
+// constraint, are exported as 2.x spaces.
+type NetworkConversion struct {
+	// GlobalKey identifies the service or machine.
+	GlobalKey string
+
+	// Requested holds the networks requested with --networks.
+	Requested []string
+
+	// Constraint holds the networks constraint, with excluded
+	// networks prefixed by "^".
+	Constraint []string
+
+	// Spaces holds the spaces added to the spaces constraint, with
+	// excluded spaces prefixed by "^".
+	Spaces []string
+
+	// Binding is the space that a service's endpoints are bound to.
+	// It's only set when all of the service's requested networks are
+	// in the same space.
+	Binding string
+
+	// Unmapped holds the networks that aren't in any space. They're
+	// left out of the exported model.
+	Unmapped []string
+
+	// Conflicting holds the spaces that are both included and
+	// excluded, because networks in the same space were. Only the
+	// inclusion is kept in Spaces.
+	Conflicting []string
+}
+
+// Entity returns a description of the service or machine, such as
+// "service wordpress" or "machine 1/lxc/0".
+func (c NetworkConversion) Entity() string {
+	switch {
+	case strings.HasPrefix(c.GlobalKey, "s#"):
+		return "service " + strings.TrimPrefix(c.GlobalKey, "s#")
+	case strings.HasPrefix(c.GlobalKey, "m#"):
+		return "machine " + strings.TrimPrefix(c.GlobalKey, "m#")
+	case c.GlobalKey == environGlobalKey:
+		return "environment"
+	}
+	return c.GlobalKey
+}
+
+// NetworkConversions works out the spaces to use in place of the
+// networks requested in the environment, ordered by global key. A
+// network maps to the space of the subnet with the same CIDR or,
+// failing that, the space with the same name.
+func (st *State) NetworkConversions() ([]NetworkConversion, error) {
+	spaceForNetwork, err := st.networkSpaces()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	requested := make(map[string][]string)
+	requestedColl, closer := st.getCollection(requestedNetworksC)
+	defer closer()
+	var requestedDocs []requestedNetworksDoc
+	if err := requestedColl.Find(nil).All(&requestedDocs); err != nil {
+		return nil, errors.Annotate(err, "reading requested networks")
+	}
+	for _, doc := range requestedDocs {
+		if len(doc.Networks) > 0 {
+			requested[st.localID(doc.DocID)] = doc.Networks
+		}
+	}
+
+	constraint := make(map[string][]string)
+	constraintsColl, closer := st.getCollection(constraintsC)
+	defer closer()
+	var constraintsDocs []struct {
+		DocID    string   `bson:"_id"`
+		Networks []string `bson:"networks"`
+	}
+	sel := bson.D{{"networks", bson.D{{"$exists", true}}}}
+	if err := constraintsColl.Find(sel).All(&constraintsDocs); err != nil {
+		return nil, errors.Annotate(err, "reading networks constraints")
+	}
+	for _, doc := range constraintsDocs {
+		if len(doc.Networks) > 0 {
+			constraint[st.localID(doc.DocID)] = doc.Networks
+		}
+	}
+
+	keys := set.NewStrings()
+	for key := range requested {
+		keys.Add(key)
+	}
+	for key := range constraint {
+		keys.Add(key)
+	}
+	var conversions []NetworkConversion
+	for _, key := range keys.SortedValues() {
+		conversions = append(conversions, convertNetworks(key, requested[key], constraint[key], spaceForNetwork))
+	}
+	return conversions, nil
+}
+
+// networkSpaces maps the names of the environment's networks to the
+// spaces they're in.
+func (st *State) networkSpaces() (map[string]string, error) {
+	networks, err := st.AllNetworks()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	subnets, err := st.AllSubnets()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	spaces, err := st.AllSpaces()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	spaceForCIDR := make(map[string]string)
+	for _, subnet := range subnets {
+		if subnet.SpaceName() != "" {
+			spaceForCIDR[subnet.CIDR()] = subnet.SpaceName()
+		}
+	}
+	result := make(map[string]string)
+	// Networks that aren't recorded (the networks constraint can
+	// name any of the provider's networks) can still match a space by
+	// name.
+	for _, space := range spaces {
+		result[space.Name()] = space.Name()
+	}
+	for _, network := range networks {
+		if space, found := spaceForCIDR[network.CIDR()]; found {
+			result[network.Name()] = space
+		}
+	}
+	return result, nil
+}
+
+// convertNetworks converts the requested networks and networks
+// constraint for an entity into spaces.
+func convertNetworks(globalKey string, requested, constraint []string, spaceForNetwork map[string]string) NetworkConversion {
+	conversion := NetworkConversion{
+		GlobalKey:  globalKey,
+		Requested:  requested,
+		Constraint: constraint,
+	}
+	seen := set.NewStrings()
+	add := func(space string) {
+		if !seen.Contains(space) {
+			seen.Add(space)
+			conversion.Spaces = append(conversion.Spaces, space)
+		}
+	}
+
+	requestedSpaces := set.NewStrings()
+	for _, network := range requested {
+		space, found := spaceForNetwork[network]
+		if !found {
+			conversion.Unmapped = append(conversion.Unmapped, network)
+			requestedSpaces.Add("")
+			continue
+		}
+		requestedSpaces.Add(space)
+		add(space)
+	}
+	for _, network := range constraint {
+		prefix := ""
+		if strings.HasPrefix(network, "^") {
+			prefix = "^"
+			network = network[1:]
+		}
+		space, found := spaceForNetwork[network]
+		if !found {
+			conversion.Unmapped = append(conversion.Unmapped, prefix+network)
+			continue
+		}
+		add(prefix + space)
+	}
+	// A space can't be both included and excluded, so keep the
+	// inclusion: the entity is already using it.
+	var spaces []string
+	for _, space := range conversion.Spaces {
+		if strings.HasPrefix(space, "^") && seen.Contains(space[1:]) {
+			conversion.Conflicting = append(conversion.Conflicting, space[1:])
+			continue
+		}
+		spaces = append(spaces, space)
+	}
+	conversion.Spaces = spaces
+	// An unmapped requested network counts as a space of its own,
+	// since the endpoints can't be bound to it.
+	if strings.HasPrefix(globalKey, "s#") && requestedSpaces.Size() == 1 && !requestedSpaces.Contains("") {
+		conversion.Binding = requestedSpaces.Values()[0]
+	}
+	return conversion
+}
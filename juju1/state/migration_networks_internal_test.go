@@ -0,0 +1,184 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package state
+
+import (
+	"github.com/juju/description"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type networkConversionsSuite struct{}
+
+var _ = gc.Suite(&networkConversionsSuite{})
+
+var testSpaceForNetwork = map[string]string{
+	"db-net":     "db",
+	"db-backup":  "db",
+	"web":        "dmz",
+	"public":     "dmz",
+	"db":         "db",
+	"dmz":        "dmz",
+	"management": "management",
+}
+
+func (*networkConversionsSuite) TestConvertNetworks(c *gc.C) {
+	for i, test := range []struct {
+		about      string
+		globalKey  string
+		requested  []string
+		constraint []string
+		expected   NetworkConversion
+	}{{
+		about:     "requested networks in one space bind the service",
+		globalKey: "s#mysql",
+		requested: []string{"db-net", "db-backup"},
+		expected: NetworkConversion{
+			Spaces:  []string{"db"},
+			Binding: "db",
+		},
+	}, {
+		about:     "requested networks in different spaces don't",
+		globalKey: "s#wordpress",
+		requested: []string{"web", "db-net"},
+		expected: NetworkConversion{
+			Spaces: []string{"dmz", "db"},
+		},
+	}, {
+		about:     "machines aren't bound",
+		globalKey: "m#1",
+		requested: []string{"db-net"},
+		expected: NetworkConversion{
+			Spaces: []string{"db"},
+		},
+	}, {
+		about:     "unmapped requested networks stop the binding",
+		globalKey: "s#mysql",
+		requested: []string{"db-net", "storage"},
+		expected: NetworkConversion{
+			Spaces:   []string{"db"},
+			Unmapped: []string{"storage"},
+		},
+	}, {
+		about:      "constraint exclusions are kept",
+		globalKey:  "s#mysql",
+		constraint: []string{"db-net", "^public", "^backup"},
+		expected: NetworkConversion{
+			Spaces:   []string{"db", "^dmz"},
+			Unmapped: []string{"^backup"},
+		},
+	}, {
+		about:      "constraint networks in a requested space are only added once",
+		globalKey:  "s#mysql",
+		requested:  []string{"db-net"},
+		constraint: []string{"db-backup", "management"},
+		expected: NetworkConversion{
+			Spaces:  []string{"db", "management"},
+			Binding: "db",
+		},
+	}, {
+		about:      "a space both included and excluded conflicts",
+		globalKey:  "s#mysql",
+		constraint: []string{"db", "^db"},
+		expected: NetworkConversion{
+			Spaces:      []string{"db"},
+			Conflicting: []string{"db"},
+		},
+	}, {
+		about:      "exclusions conflict with requested networks",
+		globalKey:  "m#1",
+		requested:  []string{"db-net"},
+		constraint: []string{"^db-backup", "^web"},
+		expected: NetworkConversion{
+			Spaces:      []string{"db", "^dmz"},
+			Conflicting: []string{"db"},
+		},
+	}} {
+		c.Logf("test %d: %s", i, test.about)
+		test.expected.GlobalKey = test.globalKey
+		test.expected.Requested = test.requested
+		test.expected.Constraint = test.constraint
+		conversion := convertNetworks(test.globalKey, test.requested, test.constraint, testSpaceForNetwork)
+		c.Check(conversion, jc.DeepEquals, test.expected)
+	}
+}
+
+func (*networkConversionsSuite) TestEntity(c *gc.C) {
+	for globalKey, expected := range map[string]string{
+		"s#mysql":        "service mysql",
+		"m#1/lxc/0":      "machine 1/lxc/0",
+		environGlobalKey: "environment",
+		"other":          "other",
+	} {
+		c.Check(NetworkConversion{GlobalKey: globalKey}.Entity(), gc.Equals, expected)
+	}
+}
+
+func newNetworksExporter() *exporter {
+	return &exporter{
+		networkConversions: map[string]NetworkConversion{
+			"s#mysql":     {Spaces: []string{"db", "^dmz"}, Binding: "db"},
+			"s#wordpress": {Spaces: []string{"dmz", "db"}},
+			"m#1":         {},
+		},
+	}
+}
+
+func (*networkConversionsSuite) TestAddNetworkSpaces(c *gc.C) {
+	e := newNetworksExporter()
+	for i, test := range []struct {
+		about     string
+		globalKey string
+		args      description.ConstraintsArgs
+		expected  description.ConstraintsArgs
+	}{{
+		about:     "spaces are added to empty constraints",
+		globalKey: "s#mysql",
+		expected:  description.ConstraintsArgs{Spaces: []string{"db", "^dmz"}},
+	}, {
+		about:     "spaces already in the constraint are only added once",
+		globalKey: "s#wordpress",
+		args:      description.ConstraintsArgs{Memory: 1024, Spaces: []string{"db", "management"}},
+		expected:  description.ConstraintsArgs{Memory: 1024, Spaces: []string{"db", "management", "dmz"}},
+	}, {
+		about:     "entities without requested networks are unchanged",
+		globalKey: "s#other",
+		args:      description.ConstraintsArgs{Spaces: []string{"management"}},
+		expected:  description.ConstraintsArgs{Spaces: []string{"management"}},
+	}, {
+		about:     "conversions without spaces change nothing",
+		globalKey: "m#1",
+		args:      description.ConstraintsArgs{Memory: 1024},
+		expected:  description.ConstraintsArgs{Memory: 1024},
+	}} {
+		c.Logf("test %d: %s", i, test.about)
+		c.Check(e.addNetworkSpaces(test.globalKey, test.args), jc.DeepEquals, test.expected)
+	}
+}
+
+func (*networkConversionsSuite) TestAddNetworkBinding(c *gc.C) {
+	e := newNetworksExporter()
+	for i, test := range []struct {
+		about     string
+		globalKey string
+		expected  map[string]string
+	}{{
+		about:     "all endpoints are bound to the space",
+		globalKey: "s#mysql",
+		expected:  map[string]string{"server": "db", "juju-info": "db", "": "db"},
+	}, {
+		about:     "no binding without a single space",
+		globalKey: "s#wordpress",
+		expected:  map[string]string{"server": "", "juju-info": "", "": ""},
+	}, {
+		about:     "no binding without requested networks",
+		globalKey: "s#other",
+		expected:  map[string]string{"server": "", "juju-info": "", "": ""},
+	}} {
+		c.Logf("test %d: %s", i, test.about)
+		bindings := map[string]string{"server": "", "juju-info": "", "": ""}
+		e.addNetworkBinding(test.globalKey, bindings)
+		c.Check(bindings, jc.DeepEquals, test.expected)
+	}
+}
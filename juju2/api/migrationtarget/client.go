@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/juju/description"
 	"github.com/juju/errors"
 	"github.com/juju/httprequest"
 	"github.com/juju/version"
@@ -228,6 +229,25 @@ func (c *Client) CACert() (string, error) {
 	return common.NewAPIAddresser(c.caller).CACert()
 }
 
+// ValidateImport checks that the imported model is consistent and
+// has all the charms and tools it needs, and returns any problems
+// found.
+func (c *Client) ValidateImport(modelUUID string) ([]error, error) {
+	var result params.ErrorResults
+	args := params.ModelArgs{names.NewModelTag(modelUUID).String()}
+	err := c.caller.FacadeCall("ValidateImport", args, &result)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var results []error
+	for _, res := range result.Results {
+		if res.Error != nil {
+			results = append(results, errors.New(res.Error.Message))
+		}
+	}
+	return results, nil
+}
+
 // CheckMachines compares the machines in state with the ones reported
 // by the provider and reports any discrepancies.
 func (c *Client) CheckMachines(modelUUID string) ([]error, error) {
@@ -243,3 +263,55 @@ func (c *Client) CheckMachines(modelUUID string) ([]error, error) {
 	}
 	return results, nil
 }
+
+// CheckInstances reports any of the serialized model's machines whose
+// instances can't be seen by the provider using the model's
+// credential. It's called before the model is imported.
+func (c *Client) CheckInstances(bytes []byte) ([]error, error) {
+	var result params.ErrorResults
+	serialized := params.SerializedModel{Bytes: bytes}
+	err := c.caller.FacadeCall("CheckInstances", serialized, &result)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var results []error
+	for _, res := range result.Results {
+		if res.Error != nil {
+			results = append(results, errors.New(res.Error.Message))
+		}
+	}
+	return results, nil
+}
+
+// UploadedCharms returns the SHA256s of the archives of the charms
+// that have already been uploaded to the importing model, keyed by
+// charm URL.
+func (c *Client) UploadedCharms(modelUUID string) (map[string]string, error) {
+	var result params.UploadedCharmsResult
+	args := params.ModelArgs{names.NewModelTag(modelUUID).String()}
+	err := c.caller.FacadeCall("UploadedCharms", args, &result)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if result.Error != nil {
+		return nil, errors.Trace(result.Error)
+	}
+	charms := make(map[string]string)
+	for _, ch := range result.Charms {
+		charms[ch.URL] = ch.SHA256
+	}
+	return charms, nil
+}
+
+// Export returns a representation of the importing model as it is in
+// the target controller.
+func (c *Client) Export(modelUUID string) (description.Model, error) {
+	var serialized params.SerializedModel
+	args := params.ModelArgs{names.NewModelTag(modelUUID).String()}
+	err := c.caller.FacadeCall("Export", args, &serialized)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	model, err := description.Deserialize(serialized.Bytes)
+	return model, errors.Trace(err)
+}
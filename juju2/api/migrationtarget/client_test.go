@@ -105,6 +105,70 @@ func (s *ClientSuite) TestActivate(c *gc.C) {
 	s.AssertModelCall(c, stub, names.NewModelTag(uuid), "Activate", err, true)
 }
 
+func (s *ClientSuite) TestValidateImport(c *gc.C) {
+	var stub jujutesting.Stub
+	apiCaller := apitesting.APICallerFunc(func(objType string, version int, id, request string, arg, result interface{}) error {
+		stub.AddCall(objType+"."+request, id, arg)
+		out := result.(*params.ErrorResults)
+		*out = params.ErrorResults{Results: []params.ErrorResult{
+			{Error: &params.Error{Message: "charm 100% missing"}},
+			{},
+		}}
+		return nil
+	})
+	client := migrationtarget.NewClient(apiCaller)
+
+	problems, err := client.ValidateImport("fake")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0].Error(), gc.Equals, "charm 100% missing")
+	stub.CheckCalls(c, []jujutesting.StubCall{
+		{"MigrationTarget.ValidateImport", []interface{}{"", params.ModelArgs{ModelTag: names.NewModelTag("fake").String()}}},
+	})
+}
+
+func (s *ClientSuite) TestCheckInstances(c *gc.C) {
+	var stub jujutesting.Stub
+	apiCaller := apitesting.APICallerFunc(func(objType string, version int, id, request string, arg, result interface{}) error {
+		stub.AddCall(objType+"."+request, id, arg)
+		out := result.(*params.ErrorResults)
+		*out = params.ErrorResults{Results: []params.ErrorResult{
+			{},
+			{Error: &params.Error{Message: "machine 1 instance %s not found"}},
+		}}
+		return nil
+	})
+	client := migrationtarget.NewClient(apiCaller)
+
+	problems, err := client.CheckInstances([]byte("model"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0].Error(), gc.Equals, "machine 1 instance %s not found")
+	stub.CheckCalls(c, []jujutesting.StubCall{
+		{"MigrationTarget.CheckInstances", []interface{}{"", params.SerializedModel{Bytes: []byte("model")}}},
+	})
+}
+
+func (s *ClientSuite) TestUploadedCharms(c *gc.C) {
+	var stub jujutesting.Stub
+	apiCaller := apitesting.APICallerFunc(func(objType string, version int, id, request string, arg, result interface{}) error {
+		stub.AddCall(objType+"."+request, id, arg)
+		out := result.(*params.UploadedCharmsResult)
+		*out = params.UploadedCharmsResult{Charms: []params.UploadedCharm{
+			{URL: "cs:trusty/mysql-1", SHA256: "abc123"},
+		}}
+		return nil
+	})
+	client := migrationtarget.NewClient(apiCaller)
+
+	charms, err := client.UploadedCharms("fake")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(charms, jc.DeepEquals, map[string]string{"cs:trusty/mysql-1": "abc123"})
+	stub.CheckCalls(c, []jujutesting.StubCall{
+		{"MigrationTarget.UploadedCharms", []interface{}{"", params.ModelArgs{ModelTag: names.NewModelTag("fake").String()}}},
+	})
+}
+
 func (s *ClientSuite) TestOpenLogTransferStream(c *gc.C) {
 	caller := fakeConnector{Stub: &jujutesting.Stub{}}
 	client := migrationtarget.NewClient(caller)
@@ -288,15 +288,49 @@ func (h *charmsHandler) processPost(r *http.Request, st *state.State) (*charm.UR
 		return nil, errors.Errorf("unsupported schema %q", schema)
 	}
 
-	// Now we need to repackage it with the reserved URL, upload it to
-	// provider storage and update the state.
-	err = h.repackageAndUploadCharm(st, archive, curl)
+	// Charms uploaded while a model is being imported are stored
+	// exactly as they were sent, so the importer can tell from their
+	// SHA256 which ones are already there. Otherwise we need to
+	// repackage it with the reserved URL, upload it to provider
+	// storage and update the state.
+	if isImporting, err := modelIsImporting(st); err != nil {
+		return nil, errors.Trace(err)
+	} else if isImporting {
+		err = storeImportedCharm(st, archive, curl, charmFileName)
+	} else {
+		err = h.repackageAndUploadCharm(st, archive, curl)
+	}
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 	return curl, nil
 }
 
+// storeImportedCharm stores the charm archive at path as it is, with
+// the SHA256 of its contents.
+func storeImportedCharm(st *state.State, archive *charm.CharmArchive, curl *charm.URL, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return errors.Annotate(err, "cannot read uploaded charm")
+	}
+	if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+		return errors.Trace(err)
+	}
+	return application.StoreCharmArchive(st, application.CharmArchive{
+		ID:     curl,
+		Charm:  archive,
+		Data:   f,
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	})
+}
+
 // processUploadedArchive opens the given charm archive from path,
 // inspects it to see if it has all files at the root of the archive
 // or it has subdirs. It repackages the archive so it has all the
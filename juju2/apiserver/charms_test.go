@@ -372,6 +372,11 @@ func (s *charmsSuite) TestNonLocalCharmUpload(c *gc.C) {
 	c.Assert(sch.URL(), gc.DeepEquals, expectedURL)
 	c.Assert(sch.Revision(), gc.Equals, 1)
 	c.Assert(sch.IsUploaded(), jc.IsTrue)
+
+	// The archive is stored as it was uploaded.
+	hash, _, err := utils.ReadFileSHA256(ch.Path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(sch.BundleSha256(), gc.Equals, hash)
 }
 
 func (s *charmsSuite) TestUnsupportedSchema(c *gc.C) {
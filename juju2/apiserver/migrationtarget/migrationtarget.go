@@ -4,9 +4,14 @@
 package migrationtarget
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/juju/description"
 	"github.com/juju/errors"
+	"github.com/juju/utils/set"
 	"gopkg.in/juju/names.v2"
 
 	"github.com/juju/1.25-upgrade/juju2/apiserver/common"
@@ -14,6 +19,8 @@ import (
 	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
 	coremigration "github.com/juju/1.25-upgrade/juju2/core/migration"
 	"github.com/juju/1.25-upgrade/juju2/environs"
+	"github.com/juju/1.25-upgrade/juju2/environs/config"
+	"github.com/juju/1.25-upgrade/juju2/instance"
 	"github.com/juju/1.25-upgrade/juju2/migration"
 	"github.com/juju/1.25-upgrade/juju2/permission"
 	"github.com/juju/1.25-upgrade/juju2/state"
@@ -30,6 +37,7 @@ type API struct {
 	resources  facade.Resources
 	pool       *state.StatePool
 	getEnviron stateenvirons.NewEnvironFunc
+	newEnviron environs.NewEnvironFunc
 }
 
 // addresser implements the subset of common.APIAddresser
@@ -38,9 +46,10 @@ type addresser interface {
 	CACert() params.BytesResult
 }
 
-// NewAPI returns a new API. Accepts a NewEnvironFunc for testing
-// purposes.
-func NewAPI(ctx facade.Context, getEnviron stateenvirons.NewEnvironFunc) (*API, error) {
+// NewAPI returns a new API. Accepts the functions for getting a
+// model's environ and opening one for a model that hasn't been
+// imported yet for testing purposes.
+func NewAPI(ctx facade.Context, getEnviron stateenvirons.NewEnvironFunc, newEnviron environs.NewEnvironFunc) (*API, error) {
 	auth := ctx.Auth()
 	st := ctx.State()
 	if err := checkAuth(auth, st); err != nil {
@@ -53,13 +62,14 @@ func NewAPI(ctx facade.Context, getEnviron stateenvirons.NewEnvironFunc) (*API,
 		resources:  ctx.Resources(),
 		pool:       ctx.StatePool(),
 		getEnviron: getEnviron,
+		newEnviron: newEnviron,
 		addresser:  addresser,
 	}, nil
 }
 
 // NewFacade is used for API registration.
 func NewFacade(ctx facade.Context) (*API, error) {
-	return NewAPI(ctx, stateenvirons.GetNewEnvironFunc(environs.New))
+	return NewAPI(ctx, stateenvirons.GetNewEnvironFunc(environs.New), environs.New)
 }
 
 func checkAuth(authorizer facade.Authorizer, st *state.State) error {
@@ -107,10 +117,107 @@ func (api *API) Import(serialized params.SerializedModel) error {
 		return err
 	}
 	defer st.Close()
-	// TODO(mjs) - post import checks
-	// NOTE(fwereade) - checks here would be sensible, but we will
-	// also need to check after the binaries are imported too.
-	return err
+	// The binaries haven't been uploaded yet, so only the model
+	// itself can be checked here - ValidateImport checks the
+	// binaries before the model is activated.
+	model, err := st.Export()
+	if err != nil {
+		return errors.Annotate(err, "exporting imported model")
+	}
+	if problems := migration.ValidateImportedModel(model); len(problems) > 0 {
+		return errors.Errorf("imported model is inconsistent: %s", joinErrors(problems))
+	}
+	return nil
+}
+
+// ValidateImport checks that the imported model is consistent and has
+// all of the charms and tools it needs, reporting any problems. It
+// should be called before the model is activated.
+func (api *API) ValidateImport(args params.ModelArgs) (params.ErrorResults, error) {
+	var empty params.ErrorResults
+	model, err := api.getImportingModel(args)
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	st, release, err := api.pool.Get(model.UUID())
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	defer release()
+
+	problems, err := migration.ValidateImport(migration.ImportValidationShim(st))
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	results := make([]params.ErrorResult, len(problems))
+	for i, problem := range problems {
+		results[i].Error = common.ServerError(problem)
+	}
+	return params.ErrorResults{Results: results}, nil
+}
+
+// Export returns a serialized representation of the importing model,
+// so it can be compared with the model that was imported.
+func (api *API) Export(args params.ModelArgs) (params.SerializedModel, error) {
+	var empty params.SerializedModel
+	model, err := api.getImportingModel(args)
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	st, release, err := api.pool.Get(model.UUID())
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	defer release()
+
+	exported, err := st.Export()
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	bytes, err := description.Serialize(exported)
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	return params.SerializedModel{Bytes: bytes}, nil
+}
+
+// UploadedCharms returns the URLs and archive SHA256s of the charms
+// that have already been uploaded to the importing model, so they
+// don't need to be sent again.
+func (api *API) UploadedCharms(args params.ModelArgs) (params.UploadedCharmsResult, error) {
+	var empty params.UploadedCharmsResult
+	model, err := api.getImportingModel(args)
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	st, release, err := api.pool.Get(model.UUID())
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	defer release()
+
+	charms, err := st.AllCharms()
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	var result []params.UploadedCharm
+	for _, ch := range charms {
+		if ch.IsUploaded() && !ch.IsPlaceholder() {
+			result = append(result, params.UploadedCharm{
+				URL:    ch.URL().String(),
+				SHA256: ch.BundleSha256(),
+			})
+		}
+	}
+	return params.UploadedCharmsResult{Charms: result}, nil
+}
+
+func joinErrors(errs []error) string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
 }
 
 func (api *API) getModel(modelTag string) (*state.Model, error) {
@@ -203,6 +310,165 @@ func (api *API) LatestLogTime(args params.ModelArgs) (time.Time, error) {
 	return time.Unix(0, timestamp).In(time.UTC), nil
 }
 
+// CheckMachines compares the machines in state with the ones reported
+// by the provider and reports any discrepancies.
+func (api *API) CheckMachines(args params.ModelArgs) (params.ErrorResults, error) {
+	var empty params.ErrorResults
+	model, err := api.getModel(args.ModelTag)
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	st, release, err := api.pool.Get(model.UUID())
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	defer release()
+
+	machinesByInstance, err := providerMachines(st)
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+
+	env, err := api.getEnviron(st)
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	instances, err := env.AllInstances()
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+
+	var results []params.ErrorResult
+	instanceIds := set.NewStrings()
+	for _, instance := range instances {
+		id := string(instance.Id())
+		instanceIds.Add(id)
+		if _, found := machinesByInstance[id]; !found {
+			results = append(results, errorResult("no machine with instance %q", id))
+		}
+	}
+	for _, instanceId := range sortedKeys(machinesByInstance) {
+		if !instanceIds.Contains(instanceId) {
+			results = append(results, errorResult(
+				"couldn't find instance %q for machine %s", instanceId, machinesByInstance[instanceId]))
+		}
+	}
+	return params.ErrorResults{Results: results}, nil
+}
+
+// CheckInstances reports any of the serialized model's machines whose
+// instances can't be seen by the provider using the model's
+// credential, which must already be on the controller. It's called
+// before the model is imported, so a credential problem doesn't leave
+// an imported model behind. The instances are still tagged as
+// belonging to the source environment, so they're looked up by ID
+// without restricting them to the model's instances.
+func (api *API) CheckInstances(serialized params.SerializedModel) (params.ErrorResults, error) {
+	var empty params.ErrorResults
+	model, err := description.Deserialize(serialized.Bytes)
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	cfg, err := config.New(config.NoDefaults, model.Config())
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	var credentialTag names.CloudCredentialTag
+	if creds := model.CloudCredential(); creds != nil {
+		credID := fmt.Sprintf("%s/%s/%s", creds.Cloud(), creds.Owner(), creds.Name())
+		if !names.IsValidCloudCredential(credID) {
+			return empty, errors.NotValidf("model credential %q", credID)
+		}
+		credentialTag = names.NewCloudCredentialTag(credID)
+	}
+	spec, err := stateenvirons.CloudSpec(api.state, model.Cloud(), model.CloudRegion(), credentialTag)
+	if err != nil {
+		return empty, errors.Annotate(err, "getting cloud spec")
+	}
+	env, err := api.newEnviron(environs.OpenParams{Cloud: spec, Config: cfg})
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	lookup := env.Instances
+	if byID, ok := env.(instanceLookup); ok {
+		lookup = byID.InstancesByID
+	}
+
+	var results []params.ErrorResult
+	for _, machine := range model.Machines() {
+		// Containers are nested under their hosts, so these are
+		// all machines with instances at the provider level.
+		if strings.HasPrefix(machine.Nonce(), manualMachinePrefix) || machine.Instance() == nil {
+			continue
+		}
+		instanceId := machine.Instance().InstanceId()
+		// Instances are requested one at a time, since some
+		// providers filter by the model when given several.
+		found, err := lookup([]instance.Id{instance.Id(instanceId)})
+		if err != nil && err != environs.ErrNoInstances {
+			return empty, errors.Annotatef(err, "getting instance %q", instanceId)
+		}
+		if err == environs.ErrNoInstances || found[0] == nil {
+			results = append(results, errorResult(
+				"instance %q for machine %s can't be seen with credential %q",
+				instanceId, machine.Id(), credentialTag.Id()))
+		}
+	}
+	return params.ErrorResults{Results: results}, nil
+}
+
+// manualMachinePrefix is the nonce prefix of manually provisioned
+// machines, which have no instances in the provider.
+const manualMachinePrefix = "manual:"
+
+// instanceLookup is implemented by environs whose Instances method
+// only returns the instances tagged as belonging to the model, and
+// that can also look instances up regardless of their tags.
+type instanceLookup interface {
+	InstancesByID(ids []instance.Id) ([]instance.Instance, error)
+}
+
+// providerMachines returns the IDs of the model's machines that have
+// instances in the provider, keyed by instance ID.
+func providerMachines(st *state.State) (map[string]string, error) {
+	machines, err := st.AllMachines()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	machinesByInstance := make(map[string]string)
+	for _, machine := range machines {
+		if machine.IsContainer() {
+			// Containers don't correspond to instances at the
+			// provider level.
+			continue
+		}
+		if manual, err := machine.IsManual(); err != nil {
+			return nil, errors.Trace(err)
+		} else if manual {
+			continue
+		}
+		instanceId, err := machine.InstanceId()
+		if err != nil {
+			return nil, errors.Annotatef(err, "getting instance id for machine %s", machine.Id())
+		}
+		machinesByInstance[string(instanceId)] = machine.Id()
+	}
+	return machinesByInstance, nil
+}
+
+func errorResult(format string, args ...interface{}) params.ErrorResult {
+	return params.ErrorResult{Error: common.ServerError(errors.Errorf(format, args...))}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // AdoptResources asks the cloud provider to update the controller
 // tags for a model's resources. This prevents the resources from
 // being destroyed if the source controller is destroyed after the
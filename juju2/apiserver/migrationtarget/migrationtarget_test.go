@@ -22,11 +22,13 @@ import (
 	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
 	apiservertesting "github.com/juju/1.25-upgrade/juju2/apiserver/testing"
 	"github.com/juju/1.25-upgrade/juju2/environs"
+	"github.com/juju/1.25-upgrade/juju2/instance"
 	"github.com/juju/1.25-upgrade/juju2/provider/dummy"
 	"github.com/juju/1.25-upgrade/juju2/state"
 	"github.com/juju/1.25-upgrade/juju2/state/stateenvirons"
 	statetesting "github.com/juju/1.25-upgrade/juju2/state/testing"
 	jujutesting "github.com/juju/1.25-upgrade/juju2/testing"
+	"github.com/juju/1.25-upgrade/juju2/testing/factory"
 )
 
 type Suite struct {
@@ -131,6 +133,18 @@ func (s *Suite) TestImport(c *gc.C) {
 	c.Assert(model.MigrationMode(), gc.Equals, state.MigrationModeImporting)
 }
 
+func (s *Suite) TestExport(c *gc.C) {
+	api := s.mustNewAPI(c)
+	tag := s.importModel(c, api)
+
+	serialized, err := api.Export(params.ModelArgs{ModelTag: tag.String()})
+	c.Assert(err, jc.ErrorIsNil)
+	model, err := description.Deserialize(serialized.Bytes)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(model.Tag(), gc.Equals, tag)
+	c.Assert(model.Config()["name"], gc.Equals, "some-model")
+}
+
 func (s *Suite) TestAbort(c *gc.C) {
 	api := s.mustNewAPI(c)
 	tag := s.importModel(c, api)
@@ -256,14 +270,98 @@ func (s *Suite) TestAdoptResources(c *gc.C) {
 	env.Stub.CheckCall(c, 0, "AdoptResources", st.ControllerUUID(), version.MustParse("3.2.1"))
 }
 
+func (s *Suite) TestCheckMachines(c *gc.C) {
+	st := s.Factory.MakeModel(c, nil)
+	defer st.Close()
+	fact := factory.NewFactory(st)
+
+	fact.MakeMachine(c, &factory.MachineParams{InstanceId: "eriatarka"})
+	m := fact.MakeMachine(c, &factory.MachineParams{InstanceId: "volta"})
+	fact.MakeMachineNested(c, m.Id(), nil)
+	fact.MakeMachine(c, &factory.MachineParams{InstanceId: "dinosaur"})
+
+	env := mockEnviron{
+		Stub:      &testing.Stub{},
+		instances: []*mockInstance{{id: "volta"}, {id: "eriatarka"}, {id: "ilyan"}},
+	}
+	api, ctx, err := s.newAPI(func(envSt *state.State) (environs.Environ, error) {
+		c.Assert(envSt.ModelUUID(), gc.Equals, st.ModelUUID())
+		return &env, nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer ctx.StatePool().Close()
+
+	results, err := api.CheckMachines(params.ModelArgs{ModelTag: st.ModelTag().String()})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, gc.DeepEquals, params.ErrorResults{Results: []params.ErrorResult{
+		{Error: &params.Error{Message: `no machine with instance "ilyan"`}},
+		{Error: &params.Error{Message: `couldn't find instance "dinosaur" for machine 2`}},
+	}})
+}
+
+func (s *Suite) TestCheckMachinesMatch(c *gc.C) {
+	st := s.Factory.MakeModel(c, nil)
+	defer st.Close()
+	fact := factory.NewFactory(st)
+	fact.MakeMachine(c, &factory.MachineParams{InstanceId: "eriatarka"})
+
+	env := mockEnviron{
+		Stub:      &testing.Stub{},
+		instances: []*mockInstance{{id: "eriatarka"}},
+	}
+	api, ctx, err := s.newAPI(func(*state.State) (environs.Environ, error) {
+		return &env, nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer ctx.StatePool().Close()
+
+	results, err := api.CheckMachines(params.ModelArgs{ModelTag: st.ModelTag().String()})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results.Results, gc.HasLen, 0)
+}
+
+func (s *Suite) TestCheckInstances(c *gc.C) {
+	s.Factory.MakeMachine(c, &factory.MachineParams{InstanceId: "eriatarka"})
+	s.Factory.MakeMachine(c, &factory.MachineParams{InstanceId: "dinosaur"})
+	_, bytes := s.makeExportedModel(c)
+
+	env := mockEnviron{
+		Stub:      &testing.Stub{},
+		instances: []*mockInstance{{id: "eriatarka"}},
+	}
+	api, ctx, err := s.newAPIWithEnvirons(nil, func(args environs.OpenParams) (environs.Environ, error) {
+		env.MethodCall(&env, "Open", args.Config.UUID())
+		return &env, nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer ctx.StatePool().Close()
+
+	results, err := api.CheckInstances(params.SerializedModel{Bytes: bytes})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results.Results, gc.HasLen, 1)
+	c.Assert(results.Results[0].Error, gc.ErrorMatches, `instance "dinosaur" for machine 1 can't be seen with credential .*`)
+	// The instances are looked up without the model filter, and
+	// nothing has been imported.
+	env.CheckCallNames(c, "Open", "InstancesByID", "InstancesByID")
+	_, err = s.State.GetModel(names.NewModelTag(env.Calls()[0].Args[0].(string)))
+	c.Assert(errors.IsNotFound(err), jc.IsTrue)
+}
+
 func (s *Suite) newAPI(environFunc stateenvirons.NewEnvironFunc) (*migrationtarget.API, *facadetest.Context, error) {
+	return s.newAPIWithEnvirons(environFunc, nil)
+}
+
+func (s *Suite) newAPIWithEnvirons(
+	environFunc stateenvirons.NewEnvironFunc,
+	newEnviron environs.NewEnvironFunc,
+) (*migrationtarget.API, *facadetest.Context, error) {
 	ctx := facadetest.Context{
 		State_:     s.State,
 		Resources_: s.resources,
 		Auth_:      s.authorizer,
 		StatePool_: state.NewStatePool(s.State),
 	}
-	api, err := migrationtarget.NewAPI(ctx, environFunc)
+	api, err := migrationtarget.NewAPI(ctx, environFunc, newEnviron)
 	return api, &ctx, err
 }
 
@@ -299,6 +397,44 @@ func (s *Suite) controllerVersion(c *gc.C) version.Number {
 type mockEnviron struct {
 	environs.Environ
 	*testing.Stub
+
+	instances []*mockInstance
+}
+
+func (e *mockEnviron) AllInstances() ([]instance.Instance, error) {
+	e.MethodCall(e, "AllInstances")
+	results := make([]instance.Instance, len(e.instances))
+	for i, anInstance := range e.instances {
+		results[i] = anInstance
+	}
+	return results, e.NextErr()
+}
+
+func (e *mockEnviron) InstancesByID(ids []instance.Id) ([]instance.Instance, error) {
+	e.MethodCall(e, "InstancesByID", ids)
+	results := make([]instance.Instance, len(ids))
+	found := false
+	for i, id := range ids {
+		for _, anInstance := range e.instances {
+			if anInstance.Id() == id {
+				results[i] = anInstance
+				found = true
+			}
+		}
+	}
+	if !found {
+		return nil, environs.ErrNoInstances
+	}
+	return results, e.NextErr()
+}
+
+type mockInstance struct {
+	instance.Instance
+	id string
+}
+
+func (i *mockInstance) Id() instance.Id {
+	return instance.Id(i.id)
 }
 
 func (e *mockEnviron) AdoptResources(controllerUUID string, sourceVersion version.Number) error {
@@ -109,6 +109,20 @@ type SerializedModelResourceRevision struct {
 	Username       string    `json:"username,omitempty"`
 }
 
+// UploadedCharmsResult holds the charms whose archives have already
+// been uploaded to an importing model.
+type UploadedCharmsResult struct {
+	Charms []UploadedCharm `json:"charms"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+// UploadedCharm holds the URL of an uploaded charm and the SHA256 of
+// its archive.
+type UploadedCharm struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
 // ModelArgs wraps a simple model tag.
 type ModelArgs struct {
 	ModelTag string `json:"model-tag"`
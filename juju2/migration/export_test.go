@@ -3,4 +3,6 @@
 
 package migration
 
-var ()
+var (
+	ControllerVersionCompatible = controllerVersionCompatible
+)
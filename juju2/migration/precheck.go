@@ -177,6 +177,10 @@ func TargetPrecheck(backend PrecheckBackend, modelInfo coremigration.ModelInfo)
 	}
 
 	if !controllerVersionCompatible(modelInfo.ControllerAgentVersion, controllerVersion) {
+		if modelInfo.ControllerAgentVersion.Major < controllerVersion.Major {
+			return errors.Errorf("source controller version %s can't be migrated to target controller (%s)",
+				modelInfo.ControllerAgentVersion, controllerVersion)
+		}
 		return errors.Errorf("source controller has higher version than target controller (%s > %s)",
 			modelInfo.ControllerAgentVersion, controllerVersion)
 	}
@@ -205,6 +209,10 @@ func TargetPrecheck(backend PrecheckBackend, modelInfo coremigration.ModelInfo)
 	return nil
 }
 
+// legacySourceVersion is the major.minor version of the Juju 1.x
+// environments that can be imported into a 2.x controller.
+var legacySourceVersion = version.Number{Major: 1, Minor: 25}
+
 func controllerVersionCompatible(sourceVersion, targetVersion version.Number) bool {
 	// Compare source controller version to target controller version, only
 	// considering major and minor version numbers. Downgrades between
@@ -212,6 +220,11 @@ func controllerVersionCompatible(sourceVersion, targetVersion version.Number) bo
 	// ok. Tag differences are ok too.
 	sourceVersion = versionToMajMin(sourceVersion)
 	targetVersion = versionToMajMin(targetVersion)
+	if sourceVersion.Major == 1 && targetVersion.Major > 1 {
+		// Juju 1.x environments can only be upgraded into a 2.x
+		// controller, and only from 1.25.
+		return sourceVersion == legacySourceVersion && targetVersion.Major == 2
+	}
 	return sourceVersion.Compare(targetVersion) <= 0
 }
 
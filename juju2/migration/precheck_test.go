@@ -410,6 +410,25 @@ func (s *TargetPrecheckSuite) TestSourceControllerTagMismatch(c *gc.C) {
 	c.Assert(migration.TargetPrecheck(backend, s.modelInfo), jc.ErrorIsNil)
 }
 
+func (s *TargetPrecheckSuite) TestControllerVersionCompatibleLegacySource(c *gc.C) {
+	for i, test := range []struct {
+		source     string
+		target     string
+		compatible bool
+	}{
+		{"1.25.13", "2.2.4", true},
+		{"1.25.0", "2.0.0", true},
+		{"1.24.7", "2.2.4", false},
+		{"1.25.13", "3.0.0", false},
+		{"2.1.3", "2.2.4", true},
+	} {
+		c.Logf("test %d: %s -> %s", i, test.source, test.target)
+		compatible := migration.ControllerVersionCompatible(
+			version.MustParse(test.source), version.MustParse(test.target))
+		c.Check(compatible, gc.Equals, test.compatible)
+	}
+}
+
 func (s *TargetPrecheckSuite) TestDying(c *gc.C) {
 	backend := newFakeBackend()
 	backend.model.life = state.Dying
@@ -0,0 +1,256 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migration
+
+import (
+	"fmt"
+
+	"github.com/juju/description"
+	"github.com/juju/errors"
+	"github.com/juju/utils/set"
+	"github.com/juju/version"
+	"gopkg.in/juju/charm.v6-unstable"
+	"gopkg.in/juju/names.v2"
+)
+
+// ImportValidationBackend defines the state functionality needed to
+// check that the binaries an imported model needs are in storage.
+type ImportValidationBackend interface {
+	// Export generates an abstract representation of the model.
+	Export() (description.Model, error)
+
+	// CharmUploaded reports whether the charm's archive is in
+	// the model's storage.
+	CharmUploaded(curl *charm.URL) (bool, error)
+
+	// ToolsUploaded reports whether the tools are in the model's
+	// storage.
+	ToolsUploaded(vers version.Binary) (bool, error)
+}
+
+// ValidateImport checks that the imported model is consistent and
+// that everything it needs has been uploaded, returning a list of the
+// problems found. It should be called after the binaries have been
+// uploaded and before the model is activated.
+func ValidateImport(backend ImportValidationBackend) ([]error, error) {
+	model, err := backend.Export()
+	if err != nil {
+		return nil, errors.Annotate(err, "exporting imported model")
+	}
+	problems := ValidateImportedModel(model)
+	binaryProblems, err := checkBinaries(backend, model)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return append(problems, binaryProblems...), nil
+}
+
+// ValidateImportedModel checks that the relations, storage and
+// leadership in the imported model refer to things that exist in it,
+// returning a list of the problems found.
+func ValidateImportedModel(model description.Model) []error {
+	units := make(map[string]string)
+	for _, app := range model.Applications() {
+		for _, unit := range app.Units() {
+			units[unit.Name()] = app.Name()
+		}
+	}
+	machines := set.NewStrings()
+	for _, machine := range allMachines(model.Machines()) {
+		machines.Add(machine.Id())
+	}
+
+	var problems []error
+	problems = append(problems, checkLeaders(model, units)...)
+	problems = append(problems, checkRelationScopes(model, units)...)
+	problems = append(problems, checkStorage(model, units, machines)...)
+	return problems
+}
+
+func checkLeaders(model description.Model, units map[string]string) []error {
+	var problems []error
+	for _, app := range model.Applications() {
+		leader := app.Leader()
+		if leader == "" {
+			continue
+		}
+		if units[leader] != app.Name() {
+			problems = append(problems, errors.Errorf(
+				"application %q leader %q is not one of its units", app.Name(), leader))
+		}
+	}
+	return problems
+}
+
+// checkRelationScopes checks that only units of each endpoint's
+// application are in scope. Units of the application may be missing
+// from scope: they might not have joined the relation yet, and the
+// exporter skips relation units that aren't valid, such as those of a
+// subordinate related to two principals.
+func checkRelationScopes(model description.Model, units map[string]string) []error {
+	var problems []error
+	for _, rel := range model.Relations() {
+		for _, ep := range rel.Endpoints() {
+			inScope := ep.AllSettings()
+			for unitName := range inScope {
+				appName, found := units[unitName]
+				if !found {
+					problems = append(problems, errors.Errorf(
+						"relation %q has unknown unit %q in scope", rel.Key(), unitName))
+				} else if appName != ep.ApplicationName() {
+					problems = append(problems, errors.Errorf(
+						"relation %q has unit %q in scope for application %q",
+						rel.Key(), unitName, ep.ApplicationName()))
+				}
+			}
+		}
+	}
+	return problems
+}
+
+func checkStorage(model description.Model, units map[string]string, machines set.Strings) []error {
+	var problems []error
+	storageIds := set.NewStrings()
+	for _, storage := range model.Storages() {
+		id := storage.Tag().Id()
+		storageIds.Add(id)
+		owner, err := storage.Owner()
+		if err != nil {
+			problems = append(problems, errors.Annotatef(err, "storage %q owner", id))
+		} else if owner != nil && !tagExists(owner, model, units) {
+			problems = append(problems, errors.Errorf(
+				"storage %q is owned by unknown %s", id, names.ReadableString(owner)))
+		}
+		for _, unit := range storage.Attachments() {
+			if _, found := units[unit.Id()]; !found {
+				problems = append(problems, errors.Errorf(
+					"storage %q is attached to unknown unit %q", id, unit.Id()))
+			}
+		}
+	}
+
+	for _, volume := range model.Volumes() {
+		id := volume.Tag().Id()
+		if storage := volume.Storage(); storage.Id() != "" && !storageIds.Contains(storage.Id()) {
+			problems = append(problems, errors.Errorf(
+				"volume %q is for unknown storage %q", id, storage.Id()))
+		}
+		for _, attachment := range volume.Attachments() {
+			if !machines.Contains(attachment.Machine().Id()) {
+				problems = append(problems, errors.Errorf(
+					"volume %q is attached to unknown machine %q", id, attachment.Machine().Id()))
+			}
+		}
+	}
+
+	for _, filesystem := range model.Filesystems() {
+		id := filesystem.Tag().Id()
+		if storage := filesystem.Storage(); storage.Id() != "" && !storageIds.Contains(storage.Id()) {
+			problems = append(problems, errors.Errorf(
+				"filesystem %q is for unknown storage %q", id, storage.Id()))
+		}
+		for _, attachment := range filesystem.Attachments() {
+			if !machines.Contains(attachment.Machine().Id()) {
+				problems = append(problems, errors.Errorf(
+					"filesystem %q is attached to unknown machine %q", id, attachment.Machine().Id()))
+			}
+		}
+	}
+	return problems
+}
+
+func tagExists(tag names.Tag, model description.Model, units map[string]string) bool {
+	switch tag.Kind() {
+	case names.UnitTagKind:
+		_, found := units[tag.Id()]
+		return found
+	case names.ApplicationTagKind:
+		for _, app := range model.Applications() {
+			if app.Name() == tag.Id() {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// charmUser records a charm needed by the imported model, and the
+// entity that needs it.
+type charmUser struct {
+	url  string
+	user string
+}
+
+func checkBinaries(backend ImportValidationBackend, model description.Model) ([]error, error) {
+	var problems []error
+	// Units can be running a different charm revision from their
+	// application, and they need it too. Each charm is only checked
+	// once, and reported against the first entity that uses it.
+	var charmsNeeded []charmUser
+	charmsSeen := set.NewStrings()
+	addCharm := func(url, user string) {
+		if url == "" || charmsSeen.Contains(url) {
+			return
+		}
+		charmsSeen.Add(url)
+		charmsNeeded = append(charmsNeeded, charmUser{url, user})
+	}
+	for _, app := range model.Applications() {
+		addCharm(app.CharmURL(), fmt.Sprintf("application %q", app.Name()))
+		for _, unit := range app.Units() {
+			addCharm(unit.CharmURL(), fmt.Sprintf("unit %q", unit.Name()))
+		}
+	}
+	for _, needed := range charmsNeeded {
+		curl, err := charm.ParseURL(needed.url)
+		if err != nil {
+			return nil, errors.Annotatef(err, "%s charm URL", needed.user)
+		}
+		uploaded, err := backend.CharmUploaded(curl)
+		if err != nil {
+			return nil, errors.Annotatef(err, "checking charm %q", curl)
+		}
+		if !uploaded {
+			problems = append(problems, errors.Errorf(
+				"charm %q for %s has not been uploaded", curl, needed.user))
+		}
+	}
+
+	toolsNeeded := make(map[version.Binary]string)
+	for _, machine := range allMachines(model.Machines()) {
+		if tools := machine.Tools(); tools != nil {
+			toolsNeeded[tools.Version()] = "machine " + machine.Id()
+		}
+	}
+	for _, app := range model.Applications() {
+		for _, unit := range app.Units() {
+			if tools := unit.Tools(); tools != nil {
+				toolsNeeded[tools.Version()] = "unit " + unit.Name()
+			}
+		}
+	}
+	for vers, user := range toolsNeeded {
+		uploaded, err := backend.ToolsUploaded(vers)
+		if err != nil {
+			return nil, errors.Annotatef(err, "checking tools %s", vers)
+		}
+		if !uploaded {
+			problems = append(problems, errors.Errorf(
+				"tools %s for %s have not been uploaded", vers, user))
+		}
+	}
+	return problems, nil
+}
+
+// allMachines returns the machines along with all of their
+// containers.
+func allMachines(machines []description.Machine) []description.Machine {
+	var result []description.Machine
+	for _, machine := range machines {
+		result = append(result, machine)
+		result = append(result, allMachines(machine.Containers())...)
+	}
+	return result
+}
@@ -0,0 +1,169 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migration_test
+
+import (
+	"github.com/juju/description"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/version"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v6-unstable"
+	"gopkg.in/juju/names.v2"
+
+	"github.com/juju/1.25-upgrade/juju2/migration"
+	"github.com/juju/1.25-upgrade/juju2/testing"
+)
+
+type ValidateSuite struct {
+	testing.BaseSuite
+}
+
+var _ = gc.Suite(&ValidateSuite{})
+
+var validateToolsVersion = version.MustParseBinary("2.2.4-trusty-amd64")
+
+// makeValidModel returns a model with a machine running a unit of
+// mysql, which is related to itself and has some storage.
+func makeValidModel() description.Model {
+	model := description.NewModel(description.ModelArgs{
+		Owner:  names.NewUserTag("owner"),
+		Config: map[string]interface{}{"name": "model", "uuid": "model-uuid"},
+	})
+	machine := model.AddMachine(description.MachineArgs{Id: names.NewMachineTag("0")})
+	machine.SetTools(description.AgentToolsArgs{Version: validateToolsVersion})
+
+	app := model.AddApplication(description.ApplicationArgs{
+		Tag:      names.NewApplicationTag("mysql"),
+		CharmURL: "cs:trusty/mysql-1",
+		Leader:   "mysql/0",
+	})
+	unit := app.AddUnit(description.UnitArgs{
+		Tag:     names.NewUnitTag("mysql/0"),
+		Machine: names.NewMachineTag("0"),
+	})
+	unit.SetTools(description.AgentToolsArgs{Version: validateToolsVersion})
+
+	rel := model.AddRelation(description.RelationArgs{Id: 1, Key: "mysql:cluster"})
+	ep := rel.AddEndpoint(description.EndpointArgs{ApplicationName: "mysql", Name: "cluster"})
+	ep.SetUnitSettings("mysql/0", map[string]interface{}{})
+
+	model.AddStorage(description.StorageArgs{
+		Tag:         names.NewStorageTag("data/0"),
+		Kind:        "block",
+		Owner:       names.NewUnitTag("mysql/0"),
+		Name:        "data",
+		Attachments: []names.UnitTag{names.NewUnitTag("mysql/0")},
+	})
+	return model
+}
+
+func (*ValidateSuite) TestValidModel(c *gc.C) {
+	c.Assert(migration.ValidateImportedModel(makeValidModel()), gc.HasLen, 0)
+}
+
+func (*ValidateSuite) TestBadLeader(c *gc.C) {
+	model := makeValidModel()
+	model.AddApplication(description.ApplicationArgs{
+		Tag:      names.NewApplicationTag("wordpress"),
+		CharmURL: "cs:trusty/wordpress-1",
+		Leader:   "mysql/0",
+	})
+	problems := migration.ValidateImportedModel(model)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0], gc.ErrorMatches, `application "wordpress" leader "mysql/0" is not one of its units`)
+}
+
+func (*ValidateSuite) TestUnknownUnitInScope(c *gc.C) {
+	model := makeValidModel()
+	model.Relations()[0].Endpoints()[0].SetUnitSettings("mysql/7", map[string]interface{}{})
+	problems := migration.ValidateImportedModel(model)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0], gc.ErrorMatches, `relation "mysql:cluster" has unknown unit "mysql/7" in scope`)
+}
+
+func (*ValidateSuite) TestUnitMissingFromScope(c *gc.C) {
+	// Units that haven't joined the relation, or whose relation
+	// units aren't valid, aren't exported in scope.
+	model := makeValidModel()
+	model.Applications()[0].AddUnit(description.UnitArgs{
+		Tag:     names.NewUnitTag("mysql/1"),
+		Machine: names.NewMachineTag("0"),
+	})
+	problems := migration.ValidateImportedModel(model)
+	c.Assert(problems, gc.HasLen, 0)
+}
+
+func (*ValidateSuite) TestStorageAttachedToUnknownUnit(c *gc.C) {
+	model := makeValidModel()
+	model.AddStorage(description.StorageArgs{
+		Tag:         names.NewStorageTag("logs/1"),
+		Kind:        "filesystem",
+		Name:        "logs",
+		Attachments: []names.UnitTag{names.NewUnitTag("mysql/3")},
+	})
+	problems := migration.ValidateImportedModel(model)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0], gc.ErrorMatches, `storage "logs/1" is attached to unknown unit "mysql/3"`)
+}
+
+func (*ValidateSuite) TestValidateImportBinaries(c *gc.C) {
+	backend := &fakeValidationBackend{
+		model:  makeValidModel(),
+		charms: map[string]bool{},
+		tools:  map[version.Binary]bool{validateToolsVersion: true},
+	}
+	problems, err := migration.ValidateImport(backend)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0], gc.ErrorMatches, `charm "cs:trusty/mysql-1" for application "mysql" has not been uploaded`)
+
+	backend.charms["cs:trusty/mysql-1"] = true
+	backend.tools[validateToolsVersion] = false
+	problems, err = migration.ValidateImport(backend)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0], gc.ErrorMatches, `tools 2.2.4-trusty-amd64 for (machine 0|unit mysql/0) have not been uploaded`)
+}
+
+func (*ValidateSuite) TestValidateImportUnitCharms(c *gc.C) {
+	model := makeValidModel()
+	app := model.Applications()[0]
+	for _, id := range []string{"mysql/1", "mysql/2"} {
+		app.AddUnit(description.UnitArgs{
+			Tag:      names.NewUnitTag(id),
+			Machine:  names.NewMachineTag("0"),
+			CharmURL: "cs:trusty/mysql-2",
+		})
+	}
+	backend := &fakeValidationBackend{
+		model:  model,
+		charms: map[string]bool{"cs:trusty/mysql-1": true},
+		tools:  map[version.Binary]bool{validateToolsVersion: true},
+	}
+	problems, err := migration.ValidateImport(backend)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0], gc.ErrorMatches, `charm "cs:trusty/mysql-2" for unit "mysql/1" has not been uploaded`)
+	c.Assert(backend.charmChecks, gc.Equals, 2)
+}
+
+type fakeValidationBackend struct {
+	model       description.Model
+	charms      map[string]bool
+	charmChecks int
+	tools       map[version.Binary]bool
+}
+
+func (b *fakeValidationBackend) Export() (description.Model, error) {
+	return b.model, nil
+}
+
+func (b *fakeValidationBackend) CharmUploaded(curl *charm.URL) (bool, error) {
+	b.charmChecks++
+	return b.charms[curl.String()], nil
+}
+
+func (b *fakeValidationBackend) ToolsUploaded(vers version.Binary) (bool, error) {
+	return b.tools[vers], nil
+}
@@ -771,6 +771,18 @@ func isNotFoundError(err error) bool {
 
 // Instances is part of the environs.Environ interface.
 func (e *environ) Instances(ids []instance.Id) ([]instance.Instance, error) {
+	return e.instances(ids, true)
+}
+
+// InstancesByID returns the instances with the given ids like
+// Instances, but without restricting them to the ones tagged as
+// belonging to the model. It's used to check that a credential can see
+// a 1.25 environment's instances before their tags are upgraded.
+func (e *environ) InstancesByID(ids []instance.Id) ([]instance.Instance, error) {
+	return e.instances(ids, false)
+}
+
+func (e *environ) instances(ids []instance.Id, modelOnly bool) ([]instance.Instance, error) {
 	if len(ids) == 0 {
 		return nil, nil
 	}
@@ -789,7 +801,9 @@ func (e *environ) Instances(ids []instance.Id) ([]instance.Instance, error) {
 		filter := ec2.NewFilter()
 		filter.Add("instance-state-name", aliveInstanceStates...)
 		filter.Add("instance-id", need...)
-		e.addModelFilter(filter)
+		if modelOnly {
+			e.addModelFilter(filter)
+		}
 		err = e.gatherInstances(ids, insts, filter)
 		if err == nil || err != environs.ErrPartialInstances {
 			break
@@ -1530,6 +1530,32 @@ func (t *localServerSuite) TestInstanceTags(c *gc.C) {
 	})
 }
 
+func (t *localServerSuite) TestInstancesByIDIgnoresModel(c *gc.C) {
+	env := t.prepareAndBootstrap(c)
+	instances, err := env.AllInstances()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(instances, gc.HasLen, 1)
+	id := instances[0].Id()
+
+	// Tag the instance as belonging to another model, as a 1.25
+	// environment's instances are until their tags are upgraded.
+	_, err = ec2.EnvironEC2(env).CreateTags([]string{string(id)}, []amzec2.Tag{
+		{"juju-model-uuid", "another-model"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, err = env.Instances([]instance.Id{id})
+	c.Assert(err, gc.Equals, environs.ErrNoInstances)
+	byID, ok := env.(interface {
+		InstancesByID([]instance.Id) ([]instance.Instance, error)
+	})
+	c.Assert(ok, jc.IsTrue)
+	found, err := byID.InstancesByID([]instance.Id{id})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(found, gc.HasLen, 1)
+	c.Assert(found[0].Id(), gc.Equals, id)
+}
+
 func (t *localServerSuite) TestRootDiskTags(c *gc.C) {
 	env := t.prepareAndBootstrap(c)
 
@@ -94,7 +94,13 @@ func (st *State) Import(model description.Model) (_ *Model, _ *State, err error)
 
 		existingCreds, err := st.CloudCredential(credTag)
 
-		if errors.IsNotFound(err) {
+		// A credential without attributes refers to one that's
+		// already on the controller, rather than carrying the
+		// secrets itself.
+		reference := len(creds.Attributes()) == 0
+		if errors.IsNotFound(err) && reference {
+			return nil, nil, errors.NotFoundf("existing credential %q", credID)
+		} else if errors.IsNotFound(err) {
 			credential := cloud.NewCredential(
 				cloud.AuthType(creds.AuthType()),
 				creds.Attributes())
@@ -103,6 +109,10 @@ func (st *State) Import(model description.Model) (_ *Model, _ *State, err error)
 			}
 		} else if err != nil {
 			return nil, nil, errors.Trace(err)
+		} else if reference {
+			if existingCreds.Revoked {
+				return nil, nil, errors.Errorf("credential %q is revoked", credID)
+			}
 		} else {
 			// ensure existing creds match
 			if string(existingCreds.AuthType()) != creds.AuthType() {